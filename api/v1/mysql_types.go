@@ -37,8 +37,14 @@ type Policy struct {
 	Annotations       map[string]string   `json:"annotations,omitempty"`
 	Affinity          *corev1.Affinity    `json:"affinity,omitempty"`
 	PriorityClassName string              `json:"priorityClassName,omitempty"`
+	NodeSelector      map[string]string   `json:"nodeSelector,omitempty"`
 	Tolerations       []corev1.Toleration `json:"tolerations,omitempty"`
 
+	// TopologySpreadConstraints of the pods. If both affinity and topologySpreadConstraints
+	// are empty, the pods are spread across nodes and zones when possible.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
 	// ExtraResources defines quotas for containers other than mysql or xenon.
 	// These containers take up less resources, so quotas are set uniformly.
 	// +optional
@@ -46,13 +52,68 @@ type Policy struct {
 	ExtraResources corev1.ResourceRequirements `json:"extraResources,omitempty"`
 }
 
+// ComponentPolicy overrides spec.podpolicy for the pods of a single component.
+// Fields that are not set fall back to spec.podpolicy, labels, annotations and the node
+// selector are merged.
+type ComponentPolicy struct {
+	// +optional
+	// +kubebuilder:validation:Enum=Always;IfNotPresent;Never
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	Labels            map[string]string   `json:"labels,omitempty"`
+	Annotations       map[string]string   `json:"annotations,omitempty"`
+	Affinity          *corev1.Affinity    `json:"affinity,omitempty"`
+	PriorityClassName string              `json:"priorityClassName,omitempty"`
+	NodeSelector      map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations       []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// TopologySpreadConstraints of the pods.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+}
+
+// BackupTarget is where a backup is written to, a volume claim or an S3 bucket.
+type BackupTarget struct {
+	// PersistentVolumeClaim the backup is written to.
+	// +optional
+	PersistentVolumeClaim *corev1.PersistentVolumeClaimVolumeSource `json:"persistentVolumeClaim,omitempty"`
+
+	// S3 is the S3-compatible bucket the backup is uploaded to.
+	// +optional
+	S3 *S3Target `json:"s3,omitempty"`
+}
+
+// S3Target is an S3-compatible bucket, e.g. AWS S3 or MinIO.
+type S3Target struct {
+	// Bucket is the name of the bucket.
+	Bucket string `json:"bucket"`
+
+	// Prefix is the path in the bucket the backups are written under.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// Endpoint is the url of the S3 service, e.g. http://minio.minio:9000.
+	// +optional
+	// +kubebuilder:default:="https://s3.amazonaws.com"
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// CredentialsSecret holds the keys accessKeyId and secretAccessKey.
+	CredentialsSecret corev1.LocalObjectReference `json:"credentialsSecret"`
+
+	// Image is the S3 client image uploading the backup, it needs the minio client mc.
+	// +optional
+	// +kubebuilder:default:="minio/mc:latest"
+	Image string `json:"image,omitempty"`
+}
+
 // Persistence is the desired spec for storing mysql data. Only one of its
 // members may be specified.
 type Persistence struct {
 	// Create a volume to store data.
+	// If false, data is stored in an emptyDir and lost when the pod is deleted.
 	// +optional
 	// +kubebuilder:default:=true
-	Enabled bool `json:"enabled,omitempty"`
+	Enabled *bool `json:"enabled,omitempty"`
 
 	// AccessModes contains the desired access modes the volume should have.
 	// More info: https://kubernetes.io/docs/concepts/storage/persistent-volumes#access-modes-1
@@ -69,6 +130,12 @@ type Persistence struct {
 	// +optional
 	// +kubebuilder:default:="10Gi"
 	Size string `json:"size,omitempty"`
+
+	// HostPath is the directory on the node to store data in instead of a dynamically
+	// provisioned volume. Each member uses <hostPath>/<namespace>/<name>-<ordinal> and
+	// is pinned to the node it is first placed on.
+	// +optional
+	HostPath string `json:"hostPath,omitempty"`
 }
 
 // MysqlSpec defines the desired state of Mysql
@@ -76,9 +143,11 @@ type MysqlSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Replicas is the number of pods.
+	// Replicas is the number of mysql members, an odd number from 1 to 9.
 	// +optional
-	// +kubebuilder:validation:Enum=0;3
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=9
+	// +kubebuilder:validation:XValidation:rule="self % 2 == 1",message="must be odd to keep a group replication quorum"
 	// +kubebuilder:default:=3
 	Replica int32 `json:"replica,omitempty"`
 
@@ -94,6 +163,68 @@ type MysqlSpec struct {
 
 	// +optional
 	Persistence Persistence `json:"persistence,omitempty"`
+
+	// DeletionPolicy decides what happens to the mysql data when the cluster is deleted.
+	// Retain keeps the volumes labeled for a new cluster of the same name to adopt them,
+	// Delete removes them, BackupThenDelete writes a final dump to finalBackup first.
+	// +optional
+	// +kubebuilder:validation:Enum=Retain;Delete;BackupThenDelete
+	// +kubebuilder:default:="Retain"
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+
+	// FinalBackup is the target of the final dump of the BackupThenDelete deletion policy,
+	// the file is named <namespace>-<name>-<time>.sql. Only a volume claim is supported.
+	// +optional
+	FinalBackup *BackupTarget `json:"finalBackup,omitempty"`
+
+	// PodDisruptionBudget creates pod disruption budgets for the mysql members and the routers,
+	// so that a node drain never evicts more members than the group quorum allows.
+	// +optional
+	// +kubebuilder:default:=true
+	PodDisruptionBudget *bool `json:"podDisruptionBudget,omitempty"`
+
+	// TLS encrypts the client, group replication and router connections with verified
+	// certificates. Without it mysql uses its self-signed certificates.
+	// +optional
+	TLS *TLS `json:"tls,omitempty"`
+}
+
+// TLS selects where the certificates come from: an existing secret, a cert-manager issuer
+// or, when neither is set, a CA generated by the operator. The server certificate is valid
+// for the host names of every member and of the router services.
+type TLS struct {
+	// SecretName is an existing secret with the keys tls.crt, tls.key and ca.crt.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// IssuerRef is the cert-manager issuer of the certificate.
+	// +optional
+	IssuerRef *IssuerReference `json:"issuerRef,omitempty"`
+
+	// Duration is the validity of the certificates issued by cert-manager or the operator.
+	// +optional
+	// +kubebuilder:default:="2160h"
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// RenewBefore is how long before its expiry a certificate is renewed, the members and
+	// routers restart one by one with the new one.
+	// +optional
+	// +kubebuilder:default:="720h"
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+}
+
+// IssuerReference is a reference to a cert-manager Issuer or ClusterIssuer.
+type IssuerReference struct {
+	Name string `json:"name"`
+	// Kind is Issuer or ClusterIssuer.
+	// +optional
+	// +kubebuilder:default:="Issuer"
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	Kind string `json:"kind,omitempty"`
+	// Group is the api group of the issuer.
+	// +optional
+	// +kubebuilder:default:="cert-manager.io"
+	Group string `json:"group,omitempty"`
 }
 
 type MysqlOpts struct {
@@ -104,42 +235,133 @@ type MysqlOpts struct {
 	MysqlImage string `json:"mysqlimage,omitempty"`
 
 	// MysqlConfTemplate is the configmap name of the template for mysql config.
-	// The configmap should contain the keys `mysql.cnf` and `plugin.cnf` at least, key `init.sql` is optional.
-	// If empty, operator will generate a default template named <spec.metadata.name>-mysql.
+	// The configmap may contain the keys `mysql.cnf`, `plugin.cnf` and `init.sql`, missing cnf keys fall back to the built-in defaults.
+	// The rendered config is stored in the configmap named <spec.metadata.name>-mysql.
 	// +optional
 	MysqlConfTemplate string `json:"mysqlConfTemplate,omitempty"`
 
-	// If empty, operator will generate a default template named <spec.metadata.name>-mysql.
+	// PluginConfTemplate is the configmap name of the template for plugin config.
+	// Its key `plugin.cnf` takes precedence over the one of mysqlConfTemplate.
 	// +optional
 	PluginConfTemplate string `json:"pluginConfTemplate,omitempty"`
 	// A map[string]string that will be passed to my.cnf file.
-	// The key/value pairs is persisted in the configmap.
-	// Delete key is not valid, it is recommended to edit the configmap directly.
+	// The key/value pairs are merged into the [mysqld] section of the template.
+	// Deleting a key restores the value of the template.
+	// Dynamic variables are applied online with SET PERSIST, static ones restart the members.
 	// +optional
 	MysqlConf MysqlConf `json:"mysqlConf,omitempty"`
 
 	// A map[string]string that will be passed to plugin.cnf file.
-	// The key/value pairs is persisted in the configmap.
-	// Delete key is not valid, it is recommended to edit the configmap directly.
+	// The key/value pairs are merged into the [mysqld] section of the template.
+	// Deleting a key restores the value of the template.
 	// +optional
 	PluginConf MysqlConf `json:"pluginConf,omitempty"`
 
+	// CredentialsSecretRef is the secret holding the mysql credentials.
+	// The secret should contain the key `rootPassword` at least, keys `user` and `password` are optional.
+	// If empty, operator will generate a secret named <spec.metadata.name>-secret with random passwords.
 	// +optional
-	// +kubebuilder:default:="axe_operator"
-	RootPassword string `json:"rootPassword"`
-
-	// +optional
-	// +kubebuilder:default:="axe"
-	MysqlUser string `json:"mysqlUser"`
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
 
+	// PodPolicy of the mysql pods, it takes precedence over spec.podpolicy.
 	// +optional
-	// +kubebuilder:default:="123456"
-	MysqlPassword string `json:"mysqlPassword"`
+	PodPolicy *ComponentPolicy `json:"podpolicy,omitempty"`
 
 	// The compute resource requirements.
 	// +optional
 	// +kubebuilder:default:={limits: {cpu: "2048m", memory: "2Gi"}, requests: {cpu: "1024m", memory: "256Mi"}}
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// PreferredPrimary is the ordinal of the member that should be the primary. The primary
+	// is switched back to it once it is online and caught up with the group, also after a
+	// switchover requested with the database.wufan/switchover annotation.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	PreferredPrimary *int32 `json:"preferredPrimary,omitempty"`
+
+	// TopologyMode is SinglePrimary, where one member accepts writes, or MultiPrimary, where
+	// every member does. It is applied when the cluster is created and switched online after.
+	// +optional
+	// +kubebuilder:validation:Enum=SinglePrimary;MultiPrimary
+	// +kubebuilder:default:="SinglePrimary"
+	TopologyMode string `json:"topologyMode,omitempty"`
+
+	// GroupReplication tunes group replication.
+	// +optional
+	GroupReplication GroupReplication `json:"groupReplication,omitempty"`
+
+	// MemberWeights sets group_replication_member_weight of members, the online member of
+	// the highest weight is elected when the primary fails. Other members keep
+	// groupReplication.memberWeight.
+	// +optional
+	// +listType=map
+	// +listMapKey=ordinal
+	MemberWeights []MemberWeight `json:"memberWeights,omitempty"`
+}
+
+// GroupReplication are the group replication settings, unset fields keep the mysql defaults.
+// The AdminAPI options are passed to createCluster and addInstance and changed online with
+// setOption, messageCacheSize and flowControlMode are rendered into plugin.cnf.
+type GroupReplication struct {
+	// Consistency is the transaction consistency guarantee of the group.
+	// +optional
+	// +kubebuilder:validation:Enum=EVENTUAL;BEFORE_ON_PRIMARY_FAILOVER;BEFORE;AFTER;BEFORE_AND_AFTER
+	Consistency string `json:"consistency,omitempty"`
+
+	// ExpelTimeout is how many seconds a suspected member is waited for before it is expelled.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=3600
+	ExpelTimeout *int32 `json:"expelTimeout,omitempty"`
+
+	// AutoRejoinTries is how many times an expelled member tries to rejoin the group by itself.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=2016
+	AutoRejoinTries *int32 `json:"autoRejoinTries,omitempty"`
+
+	// ExitStateAction is what a member does when it leaves the group involuntarily.
+	// +optional
+	// +kubebuilder:validation:Enum=READ_ONLY;OFFLINE_MODE;ABORT_SERVER
+	ExitStateAction string `json:"exitStateAction,omitempty"`
+
+	// MemberWeight is the election weight of the members not listed in memberWeights.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	MemberWeight *int32 `json:"memberWeight,omitempty"`
+
+	// MessageCacheSize is the size of the cache of messages for members that are
+	// temporarily unreachable, at least 128Mi.
+	// +optional
+	MessageCacheSize string `json:"messageCacheSize,omitempty"`
+
+	// FlowControlMode is QUOTA to throttle writers when members fall behind, DISABLED otherwise.
+	// +optional
+	// +kubebuilder:validation:Enum=QUOTA;DISABLED
+	FlowControlMode string `json:"flowControlMode,omitempty"`
+
+	// CommunicationStack is the stack of the group messages, XCOM or MYSQL. It can only be
+	// set when the cluster is created.
+	// +optional
+	// +kubebuilder:validation:Enum=XCOM;MYSQL
+	CommunicationStack string `json:"communicationStack,omitempty"`
+
+	// IPAllowlist is the comma separated list of hosts and subnets allowed to join the group,
+	// only used by the XCOM communication stack.
+	// +optional
+	IPAllowlist string `json:"ipAllowlist,omitempty"`
+}
+
+// MemberWeight is the election weight of a member.
+type MemberWeight struct {
+	// Ordinal is the pod ordinal of the member.
+	// +kubebuilder:validation:Minimum=0
+	Ordinal int32 `json:"ordinal"`
+	// Weight is the group_replication_member_weight of the member.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
 }
 
 type RouterOpts struct {
@@ -159,17 +381,21 @@ type RouterOpts struct {
 	// +kubebuilder:default:={limits: {cpu: "2048m", memory: "2Gi"}, requests: {cpu: "1024m", memory: "256Mi"}}
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
 
-	// MysqlConfTemplate is the configmap name of the template for mysql config.
-	// The configmap should contain the keys `mysql.cnf` and `plugin.cnf` at least, key `init.sql` is optional.
-	// If empty, operator will generate a default template named <spec.metadata.name>-mysql.
+	// RouterConfTemplate is the configmap name of the template for router config.
+	// The configmap should contain the key `mysqlrouter.conf`, if empty the built-in default is used.
+	// The rendered config is stored in the configmap named <spec.metadata.name>-router.
 	// +optional
-	RouterConfTemplate string `json:"mysqlConfTemplate,omitempty"`
+	RouterConfTemplate string `json:"routerConfTemplate,omitempty"`
 
-	// A map[string]string that will be passed to my.cnf file.
-	// The key/value pairs is persisted in the configmap.
-	// Delete key is not valid, it is recommended to edit the configmap directly.
+	// A map[string]string of router options merged into the template, e.g.
+	// `DEFAULT.max_total_connections`, `logger.level` or `routing:bootstrap_rw.bind_port`.
+	// Keys without a section belong to [DEFAULT]. A change restarts the router pods.
 	// +optional
-	RouterConf RouterConf `json:"mysqlConf,omitempty"`
+	RouterConf RouterConf `json:"routerConf,omitempty"`
+
+	// PodPolicy of the router pods, it takes precedence over spec.podpolicy.
+	// +optional
+	PodPolicy *ComponentPolicy `json:"podpolicy,omitempty"`
 }
 
 const (
@@ -185,6 +411,23 @@ const (
 	ClusterScaleInState string = "ScaleIn"
 	// ClusterScaleOutState indicates whether the cluster replicas is increasing.
 	ClusterScaleOutState string = "ScaleOut"
+	// ClusterDeletingState indicates the cluster is being deleted.
+	ClusterDeletingState string = "Deleting"
+)
+
+const (
+	// PhaseProvisioning indicates the first member is not reachable yet.
+	PhaseProvisioning string = "Provisioning"
+	// PhaseBootstrapping indicates the innodb cluster is being created on the first member.
+	PhaseBootstrapping string = "Bootstrapping"
+	// PhaseAddingMembers indicates members are being added to the innodb cluster.
+	PhaseAddingMembers string = "AddingMembers"
+	// PhaseReady indicates all members are online.
+	PhaseReady string = "Ready"
+	// PhaseDegraded indicates some members are not online.
+	PhaseDegraded string = "Degraded"
+	// PhaseRecovering indicates some members are catching up with the group.
+	PhaseRecovering string = "Recovering"
 )
 
 const (
@@ -202,14 +445,71 @@ const (
 	ConditionScaleIn string = "ScaleIn"
 	// ConditionScaleOut indicates whether the cluster replicas is increasing.
 	ConditionScaleOut string = "ScaleOut"
+	// ConditionDeleting indicates the progress of the deletion policy.
+	ConditionDeleting string = "Deleting"
+	// ConditionRecovery indicates whether the operator is recovering members of the group,
+	// the reason is the recovery action taken, or what it waits for, or the registered
+	// members that are missing.
+	ConditionRecovery string = "Recovery"
+	// ConditionTopology indicates whether the group is switching its topology mode.
+	ConditionTopology string = "TopologyChange"
+	// ConditionSwitchover indicates whether the primary is being switched over, the reason of
+	// the last switchover is Completed or Failed.
+	ConditionSwitchover string = "Switchover"
+	// ConditionLegacyVolumes indicates whether the statefulset keeps volume claim templates
+	// that differ from spec.persistence, they can not change on an existing statefulset.
+	ConditionLegacyVolumes string = "LegacyVolumes"
+)
+
+const (
+	// SwitchoverAnnotation requests a one-shot switchover to the member whose ordinal or pod
+	// name is its value. The annotation is removed once the switchover completed or failed.
+	SwitchoverAnnotation string = "database.wufan/switchover"
+	// ServerIDBaseAnnotation is the server_id of the first member, the member of ordinal n
+	// gets base+n. The operator sets it when the cluster is created, it never changes.
+	ServerIDBaseAnnotation string = "database.wufan/server-id-base"
+	// MaxPrimaryChanges is the number of primary changes kept in the status.
+	MaxPrimaryChanges = 10
+)
+
+const (
+	// PrimaryChangeSwitchover is a switchover requested with the switchover annotation.
+	PrimaryChangeSwitchover string = "Switchover"
+	// PrimaryChangePreferred is a switchover back to spec.mysql.preferredPrimary.
+	PrimaryChangePreferred string = "PreferredPrimary"
+	// PrimaryChangeElection is a primary elected by the group, when the cluster is created
+	// or after the primary failed.
+	PrimaryChangeElection string = "Election"
+)
+
+const (
+	// TopologySinglePrimary is a group where only the primary accepts writes.
+	TopologySinglePrimary string = "SinglePrimary"
+	// TopologyMultiPrimary is a group where every member accepts writes.
+	TopologyMultiPrimary string = "MultiPrimary"
 )
 
 const (
-	MgrNOTinstalled string = "MGR_NOT_INSTALLED"
-	Mgrinstalled    string = "MGR_INSTALLED"
-	MgrISinstall    string = "MGR_IS_INSTALL"
-	MYSQLAPP        string = "mysql"
-	MYSQLROUTERAPP  string = "mysql-router"
+	// DeletionPolicyRetain keeps the mysql data when the cluster is deleted.
+	DeletionPolicyRetain string = "Retain"
+	// DeletionPolicyDelete removes the mysql data when the cluster is deleted.
+	DeletionPolicyDelete string = "Delete"
+	// DeletionPolicyBackupThenDelete dumps the databases before the mysql data is removed.
+	DeletionPolicyBackupThenDelete string = "BackupThenDelete"
+)
+
+const (
+	// PersistenceModePVC stores data in a persistent volume claim per member.
+	PersistenceModePVC string = "PersistentVolumeClaim"
+	// PersistenceModeHostPath stores data in a host path pinned to the node of each member.
+	PersistenceModeHostPath string = "HostPath"
+	// PersistenceModeEmptyDir stores data in an emptyDir, data is lost with the pod.
+	PersistenceModeEmptyDir string = "EmptyDir"
+)
+
+const (
+	MYSQLAPP       string = "mysql"
+	MYSQLROUTERAPP string = "mysql-router"
 )
 
 const (
@@ -223,30 +523,171 @@ const (
 	NodeConditionReplicating string = "Replicating"
 )
 
+const (
+	// MemberStateOnline indicates the member is an active group member.
+	MemberStateOnline string = "ONLINE"
+	// MemberStateRecovering indicates the member is catching up with the group.
+	MemberStateRecovering string = "RECOVERING"
+	// MemberStateOffline indicates group replication is not running on the member.
+	MemberStateOffline string = "OFFLINE"
+	// MemberStateError indicates the member left the group because of an error.
+	MemberStateError string = "ERROR"
+	// MemberStateUnreachable indicates the member is not reachable by the group.
+	MemberStateUnreachable string = "UNREACHABLE"
+	// MemberStateMissing indicates the operator can not connect to the member.
+	MemberStateMissing string = "MISSING"
+)
+
+const (
+	// MemberRolePrimary is the role of the member accepting writes.
+	MemberRolePrimary string = "PRIMARY"
+	// MemberRoleSecondary is the role of a read only member.
+	MemberRoleSecondary string = "SECONDARY"
+)
+
+// MemberStatus is the observed state of a group replication member.
+type MemberStatus struct {
+	// Name is the pod name of the member.
+	Name string `json:"name"`
+	// State is the group replication member state.
+	State string `json:"state,omitempty"`
+	// Role is the member role, PRIMARY or SECONDARY.
+	Role string `json:"role,omitempty"`
+	// GtidExecuted is the gtid set executed by the member.
+	GtidExecuted string `json:"gtidExecuted,omitempty"`
+	// Lag is the number of transactions waiting in the applier queue of the member.
+	Lag int64 `json:"lag,omitempty"`
+	// Conditions contains the Lagged, Leader, ReadOnly and Replicating conditions of the member.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// VariableApplied indicates the variable is in effect on every member.
+	VariableApplied string = "Applied"
+	// VariablePending indicates the variable could not be set on every member yet.
+	VariablePending string = "Pending"
+	// VariableRestartRequired indicates the variable is static and takes effect once the members restarted.
+	VariableRestartRequired string = "RestartRequired"
+)
+
+// VariableStatus is the state of a mysqld variable changed in the rendered config.
+type VariableStatus struct {
+	// Name is the normalized name of the variable.
+	Name string `json:"name"`
+	// Value is the configured value, empty for a bare flag or a removed variable.
+	Value string `json:"value,omitempty"`
+	// Removed is set when the variable was removed from the config, it is reset to its default.
+	Removed bool `json:"removed,omitempty"`
+	// State is Applied, Pending or RestartRequired.
+	State string `json:"state"`
+}
+
+// PrimaryChange is a change of the primary member.
+type PrimaryChange struct {
+	// From is the name of the former primary, empty if there was none.
+	From string `json:"from,omitempty"`
+	// To is the name of the new primary.
+	To string `json:"to"`
+	// Reason is Switchover, PreferredPrimary or Election.
+	Reason string `json:"reason"`
+	// Time is when the operator observed the change.
+	Time metav1.Time `json:"time"`
+}
+
+// TLSStatus is the state of the certificates.
+type TLSStatus struct {
+	// SecretName is the secret holding the certificate in use.
+	SecretName string `json:"secretName,omitempty"`
+	// NotAfter is when the server certificate expires.
+	// +optional
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+	// CANotAfter is when the CA certificate expires.
+	// +optional
+	CANotAfter *metav1.Time `json:"caNotAfter,omitempty"`
+	// CARotation is TrustingNewCA while the members and routers restart trusting the new CA
+	// generated by the operator, the certificate is signed by the previous CA until they all did.
+	// +optional
+	CARotation string `json:"caRotation,omitempty"`
+}
+
+const (
+	// CARotationTrusting is the phase of a CA rotation in which the new CA is rolled out
+	// along with the previous one.
+	CARotationTrusting string = "TrustingNewCA"
+)
+
+// BootstrapStatus is the state of the creation of the innodb cluster. Until it completes
+// it is reconstructed from the members on every reconcile.
+type BootstrapStatus struct {
+	// Completed reports whether the innodb cluster was created and every member joined it.
+	Completed bool `json:"completed,omitempty"`
+	// Seed is the name of the member the cluster was created on or found running on.
+	Seed string `json:"seed,omitempty"`
+	// Adopted reports whether the cluster already existed on the members.
+	Adopted bool `json:"adopted,omitempty"`
+	// CompletionTime is when the bootstrap completed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
 // MysqlStatus defines the observed state of Mysql
 type MysqlStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
-
+	// ObservedGeneration is the most recent generation observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// ReadyNodes represents number of the nodes that are in ready state.
 	ReadyNodes int `json:"readyNodes,omitempty"`
-	// State
+	// State is the cluster state.
 	State string `json:"state,omitempty"`
+	// Phase is the lifecycle phase of the innodb cluster: Provisioning, Bootstrapping,
+	// AddingMembers, Ready, Degraded or Recovering.
+	Phase string `json:"phase,omitempty"`
+	// Bootstrap is the state of the creation of the innodb cluster.
+	// +optional
+	Bootstrap BootstrapStatus `json:"bootstrap,omitempty"`
+	// Leader is the name of the primary member, empty in multi-primary mode.
+	Leader string `json:"leader,omitempty"`
+	// TopologyMode is the mode the group runs in, SinglePrimary or MultiPrimary.
+	TopologyMode string `json:"topologyMode,omitempty"`
+	// GroupReplication contains the group replication settings in effect on the primary.
+	// +optional
+	GroupReplication *GroupReplication `json:"groupReplication,omitempty"`
 	// Conditions contains the list of the cluster conditions fulfilled.
-	// Nodes contains the list of the node status fulfilled.
-	Nodes string `json:"nodes,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Members contains the status of every member.
+	// +optional
+	Members []MemberStatus `json:"members,omitempty"`
+	// Persistence is the storage mode of the mysql data.
+	Persistence string `json:"persistence,omitempty"`
+	// Selector is the label selector of the mysql pods, used by the scale subresource.
+	Selector string `json:"selector,omitempty"`
+	// Variables contains the mysqld variables changed in the config and whether they are in effect.
+	// +optional
+	Variables []VariableStatus `json:"variables,omitempty"`
+	// TLS is the state of the certificates of spec.tls.
+	// +optional
+	TLS *TLSStatus `json:"tls,omitempty"`
+	// PrimaryChanges is the history of the last primary changes, oldest first.
+	// +optional
+	PrimaryChanges []PrimaryChange `json:"primaryChanges,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
-// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.readyNodes
+// +kubebuilder:subresource:scale:specpath=.spec.replica,statuspath=.status.readyNodes,selectorpath=.status.selector
 // +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state",description="The cluster status"
-// +kubebuilder:printcolumn:name="Desired",type="integer",JSONPath=".spec.replicas",description="The number of desired replicas"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="The lifecycle phase of the innodb cluster"
+// +kubebuilder:printcolumn:name="Desired",type="integer",JSONPath=".spec.replica",description="The number of desired replicas"
 // +kubebuilder:printcolumn:name="Current",type="integer",JSONPath=".status.readyNodes",description="The number of current replicas"
-// +kubebuilder:printcolumn:name="Leader",type="string",JSONPath=".status.nodes",description="Name of the leader node"
+// +kubebuilder:printcolumn:name="Leader",type="string",JSONPath=".status.leader",description="Name of the leader node"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:resource:shortName=mysql
 // Mysql is the Schema for the mysqls API
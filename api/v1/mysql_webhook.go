@@ -0,0 +1,531 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var mysqllog = logf.Log.WithName("mysql-resource")
+
+const (
+	DefaultMysqlImage  = "mysql:8.0.32"
+	DefaultRouterImage = "mysql/mysql-router:latest"
+	DefaultReplica     = 3
+	DefaultSize        = "10Gi"
+	// MaxReplica is the maximum number of members of a group.
+	MaxReplica = 9
+
+	DefaultTLSDuration    = 90 * 24 * time.Hour
+	DefaultTLSRenewBefore = 30 * 24 * time.Hour
+)
+
+// forbiddenMysqlOptions are mysqld options that can not be set in mysqlConf or pluginConf,
+// either because the operator manages them or because they break the cluster.
+var forbiddenMysqlOptions = map[string]string{
+	"skip_grant_tables":        "disables authentication",
+	"skip_networking":          "members can not reach each other",
+	"init_file":                "use the init.sql key of the config template",
+	"gtid_mode":                "required by group replication",
+	"enforce_gtid_consistency": "required by group replication",
+	"skip_log_bin":             "required by group replication",
+	"disable_log_bin":          "required by group replication",
+	"server_id":                "managed by the operator",
+	"report_host":              "managed by the operator",
+	"port":                     "managed by the operator",
+	"datadir":                  "managed by the operator",
+	"socket":                   "managed by the operator",
+	"user":                     "managed by the operator",
+
+	"group_replication_single_primary_mode":              "managed by spec.mysql.topologyMode",
+	"group_replication_enforce_update_everywhere_checks": "managed by spec.mysql.topologyMode",
+	"group_replication_consistency":                      "managed by spec.mysql.groupReplication",
+	"group_replication_member_expel_timeout":             "managed by spec.mysql.groupReplication",
+	"group_replication_autorejoin_tries":                 "managed by spec.mysql.groupReplication",
+	"group_replication_exit_state_action":                "managed by spec.mysql.groupReplication",
+	"group_replication_member_weight":                    "managed by spec.mysql.groupReplication",
+	"group_replication_message_cache_size":               "managed by spec.mysql.groupReplication",
+	"group_replication_flow_control_mode":                "managed by spec.mysql.groupReplication",
+	"group_replication_communication_stack":              "managed by spec.mysql.groupReplication",
+	"group_replication_ip_allowlist":                     "managed by spec.mysql.groupReplication",
+
+	"ssl_ca":                                            "managed by spec.tls",
+	"ssl_cert":                                          "managed by spec.tls",
+	"ssl_key":                                           "managed by spec.tls",
+	"group_replication_ssl_mode":                        "managed by spec.tls",
+	"group_replication_recovery_use_ssl":                "managed by spec.tls",
+	"group_replication_recovery_ssl_ca":                 "managed by spec.tls",
+	"group_replication_recovery_ssl_cert":               "managed by spec.tls",
+	"group_replication_recovery_ssl_key":                "managed by spec.tls",
+	"group_replication_recovery_ssl_verify_server_cert": "managed by spec.tls",
+}
+
+// minMessageCacheSize is the lower bound of group_replication_message_cache_size.
+var minMessageCacheSize = resource.MustParse("128Mi")
+
+// forbiddenRouterOptions are router options written by the bootstrap that can not be set in routerConf.
+var forbiddenRouterOptions = map[string]bool{
+	"user":             true,
+	"router_id":        true,
+	"cluster_type":     true,
+	"metadata_cluster": true,
+	"destinations":     true,
+	"keyring_path":     true,
+	"master_key_path":  true,
+	"data_folder":      true,
+	"runtime_folder":   true,
+	"logging_folder":   true,
+	"dynamic_state":    true,
+}
+
+var routerOptionRegexp = regexp.MustCompile(`^([A-Za-z0-9_:]+\.)?[a-z_]+$`)
+
+// immutableMysqlOptions can only be set when the data directory is initialized.
+var immutableMysqlOptions = []string{
+	"lower_case_table_names",
+	"innodb_page_size",
+}
+
+var imageRegexp = regexp.MustCompile(`^[a-zA-Z0-9]+([._-][a-zA-Z0-9]+)*(:[0-9]+)?(/[a-z0-9]+([._-][a-z0-9]+)*)*(:[\w][\w.-]{0,127})?(@sha256:[a-f0-9]{64})?$`)
+
+var versionRegexp = regexp.MustCompile(`^(\d+)\.(\d+)(\.(\d+))?`)
+
+func (r *Mysql) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-database-wufan-v1-mysql,mutating=true,failurePolicy=fail,sideEffects=None,groups=database.wufan,resources=mysqls,verbs=create;update,versions=v1,name=mmysql.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &Mysql{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type.
+// The crd defaults are not applied when a parent object is missing, so they are repeated here.
+func (r *Mysql) Default() {
+	mysqllog.Info("default", "name", r.Name)
+
+	if r.Spec.Replica == 0 {
+		r.Spec.Replica = DefaultReplica
+	}
+	if r.Spec.Mysql.MysqlImage == "" {
+		r.Spec.Mysql.MysqlImage = DefaultMysqlImage
+	}
+	if r.Spec.Router.RouterImage == "" {
+		r.Spec.Router.RouterImage = DefaultRouterImage
+	}
+	if r.Spec.PodPolicy.ImagePullPolicy == "" {
+		r.Spec.PodPolicy.ImagePullPolicy = corev1.PullIfNotPresent
+	}
+	if r.Spec.Persistence.Enabled == nil {
+		enabled := true
+		r.Spec.Persistence.Enabled = &enabled
+	}
+	if len(r.Spec.Persistence.AccessModes) == 0 {
+		r.Spec.Persistence.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	}
+	if r.Spec.Persistence.Size == "" {
+		r.Spec.Persistence.Size = DefaultSize
+	}
+	if r.Spec.Mysql.TopologyMode == "" {
+		r.Spec.Mysql.TopologyMode = TopologySinglePrimary
+	}
+	if r.Spec.DeletionPolicy == "" {
+		r.Spec.DeletionPolicy = DeletionPolicyRetain
+	}
+	if r.Spec.PodDisruptionBudget == nil {
+		enabled := true
+		r.Spec.PodDisruptionBudget = &enabled
+	}
+	if tls := r.Spec.TLS; tls != nil {
+		if tls.Duration == nil {
+			tls.Duration = &metav1.Duration{Duration: DefaultTLSDuration}
+		}
+		if tls.RenewBefore == nil {
+			tls.RenewBefore = &metav1.Duration{Duration: DefaultTLSRenewBefore}
+		}
+		if tls.IssuerRef != nil && tls.IssuerRef.Kind == "" {
+			tls.IssuerRef.Kind = "Issuer"
+		}
+		if tls.IssuerRef != nil && tls.IssuerRef.Group == "" {
+			tls.IssuerRef.Group = "cert-manager.io"
+		}
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-database-wufan-v1-mysql,mutating=false,failurePolicy=fail,sideEffects=None,groups=database.wufan,resources=mysqls,verbs=create;update,versions=v1,name=vmysql.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Mysql{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Mysql) ValidateCreate() (admission.Warnings, error) {
+	mysqllog.Info("validate create", "name", r.Name)
+
+	warnings, errs := r.ValidateSpec()
+	errs = append(errs, r.validateSwitchover()...)
+	errs = append(errs, r.validateServerIDBase(nil)...)
+	return warnings, r.invalid(errs)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Mysql) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	mysqllog.Info("validate update", "name", r.Name)
+
+	oldMysql, ok := old.(*Mysql)
+	if !ok {
+		return nil, fmt.Errorf("expected a Mysql but got a %T", old)
+	}
+
+	warnings, errs := r.ValidateSpec()
+	errs = append(errs, r.validateSwitchover()...)
+	errs = append(errs, r.validateServerIDBase(oldMysql)...)
+	errs = append(errs, r.validateImmutable(oldMysql)...)
+	return warnings, r.invalid(errs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Mysql) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (r *Mysql) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "Mysql"}, r.Name, errs)
+}
+
+// ValidateSpec checks the spec of a new or updated cluster.
+// It is also called by the controller in case the webhook is not deployed.
+func (r *Mysql) ValidateSpec() (admission.Warnings, field.ErrorList) {
+	var warnings admission.Warnings
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+
+	if r.Spec.Replica < 1 || r.Spec.Replica > MaxReplica {
+		errs = append(errs, field.Invalid(spec.Child("replica"), r.Spec.Replica, fmt.Sprintf("must be between 1 and %d", MaxReplica)))
+	} else if r.Spec.Replica%2 == 0 {
+		errs = append(errs, field.Invalid(spec.Child("replica"), r.Spec.Replica, "must be odd to keep a group replication quorum"))
+	}
+
+	mysqlPath := spec.Child("mysql")
+	w, e := validateImage(mysqlPath.Child("mysqlimage"), r.Spec.Mysql.MysqlImage)
+	warnings, errs = append(warnings, w...), append(errs, e...)
+	errs = append(errs, validateResources(mysqlPath.Child("resources"), r.Spec.Mysql.Resources)...)
+	if r.Spec.Mysql.Resources.Limits.Memory().IsZero() {
+		errs = append(errs, field.Required(mysqlPath.Child("resources", "limits", "memory"), "used to size innodb_buffer_pool_size"))
+	}
+	errs = append(errs, validateMysqlConf(mysqlPath.Child("mysqlConf"), r.Spec.Mysql.MysqlConf)...)
+	errs = append(errs, validateMysqlConf(mysqlPath.Child("pluginConf"), r.Spec.Mysql.PluginConf)...)
+	errs = append(errs, r.validateTopologyMode(mysqlPath)...)
+	errs = append(errs, validateGroupReplication(mysqlPath.Child("groupReplication"), r.Spec.Mysql.GroupReplication)...)
+	if p := r.Spec.Mysql.PreferredPrimary; p != nil && (*p < 0 || *p >= r.Spec.Replica) {
+		errs = append(errs, field.Invalid(mysqlPath.Child("preferredPrimary"), *p, "must be the ordinal of a member"))
+	}
+	for i, w := range r.Spec.Mysql.MemberWeights {
+		if w.Ordinal < 0 || w.Ordinal >= r.Spec.Replica {
+			errs = append(errs, field.Invalid(mysqlPath.Child("memberWeights").Index(i).Child("ordinal"), w.Ordinal, "must be the ordinal of a member"))
+		}
+		if w.Weight < 0 || w.Weight > 100 {
+			errs = append(errs, field.Invalid(mysqlPath.Child("memberWeights").Index(i).Child("weight"), w.Weight, "must be between 0 and 100"))
+		}
+	}
+
+	routerPath := spec.Child("router")
+	w, e = validateImage(routerPath.Child("routerimage"), r.Spec.Router.RouterImage)
+	warnings, errs = append(warnings, w...), append(errs, e...)
+	errs = append(errs, validateResources(routerPath.Child("resources"), r.Spec.Router.Resources)...)
+	errs = append(errs, validateRouterConf(routerPath.Child("routerConf"), r.Spec.Router.RouterConf)...)
+
+	errs = append(errs, validateResources(spec.Child("podpolicy", "extraResources"), r.Spec.PodPolicy.ExtraResources)...)
+
+	persistencePath := spec.Child("persistence")
+	if _, err := resource.ParseQuantity(r.Spec.Persistence.Size); err != nil {
+		errs = append(errs, field.Invalid(persistencePath.Child("size"), r.Spec.Persistence.Size, err.Error()))
+	}
+	if r.Spec.Persistence.HostPath != "" && !strings.HasPrefix(r.Spec.Persistence.HostPath, "/") {
+		errs = append(errs, field.Invalid(persistencePath.Child("hostPath"), r.Spec.Persistence.HostPath, "must be an absolute path"))
+	}
+
+	errs = append(errs, validateTLS(spec.Child("tls"), r.Spec.TLS)...)
+
+	if r.Spec.DeletionPolicy == DeletionPolicyBackupThenDelete &&
+		(r.Spec.FinalBackup == nil || r.Spec.FinalBackup.PersistentVolumeClaim == nil) {
+		errs = append(errs, field.Required(spec.Child("finalBackup", "persistentVolumeClaim"), "required by the BackupThenDelete deletion policy"))
+	}
+	if r.Spec.FinalBackup != nil && r.Spec.FinalBackup.S3 != nil {
+		errs = append(errs, field.Forbidden(spec.Child("finalBackup", "s3"), "the final backup is only written to a volume claim"))
+	}
+
+	return warnings, errs
+}
+
+// validateTopologyMode checks the prerequisites of multi-primary mode.
+func (r *Mysql) validateTopologyMode(mysqlPath *field.Path) field.ErrorList {
+	if r.Spec.Mysql.TopologyMode != TopologyMultiPrimary {
+		return nil
+	}
+	var errs field.ErrorList
+	for _, conf := range []struct {
+		name string
+		conf MysqlConf
+	}{{"mysqlConf", r.Spec.Mysql.MysqlConf}, {"pluginConf", r.Spec.Mysql.PluginConf}} {
+		for _, option := range []string{"transaction_isolation", "tx_isolation"} {
+			key, value := lookupMysqlOption(conf.conf, option)
+			if strings.EqualFold(value, "SERIALIZABLE") {
+				errs = append(errs, field.Invalid(mysqlPath.Child(conf.name).Key(key), value, "SERIALIZABLE is not supported in multi-primary mode"))
+			}
+		}
+	}
+	if r.Spec.Mysql.PreferredPrimary != nil {
+		errs = append(errs, field.Forbidden(mysqlPath.Child("preferredPrimary"), "every member is a primary in multi-primary mode"))
+	}
+	return errs
+}
+
+func validateGroupReplication(path *field.Path, gr GroupReplication) field.ErrorList {
+	var errs field.ErrorList
+	if gr.MessageCacheSize != "" {
+		size, err := resource.ParseQuantity(gr.MessageCacheSize)
+		if err != nil {
+			errs = append(errs, field.Invalid(path.Child("messageCacheSize"), gr.MessageCacheSize, err.Error()))
+		} else if size.Cmp(minMessageCacheSize) < 0 {
+			errs = append(errs, field.Invalid(path.Child("messageCacheSize"), gr.MessageCacheSize, "must be at least 128Mi"))
+		}
+	}
+	if gr.IPAllowlist != "" && gr.CommunicationStack == "MYSQL" {
+		errs = append(errs, field.Forbidden(path.Child("ipAllowlist"), "not used by the MYSQL communication stack"))
+	}
+	return errs
+}
+
+func validateTLS(path *field.Path, tls *TLS) field.ErrorList {
+	if tls == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	if tls.SecretName != "" && tls.IssuerRef != nil {
+		errs = append(errs, field.Forbidden(path.Child("issuerRef"), "can not be set together with secretName"))
+	}
+	if tls.IssuerRef != nil && tls.IssuerRef.Name == "" {
+		errs = append(errs, field.Required(path.Child("issuerRef", "name"), ""))
+	}
+	if tls.Duration != nil && tls.RenewBefore != nil && tls.RenewBefore.Duration >= tls.Duration.Duration {
+		errs = append(errs, field.Invalid(path.Child("renewBefore"), tls.RenewBefore.Duration.String(), "must be shorter than duration"))
+	}
+	return errs
+}
+
+// SwitchoverTarget returns the member ordinal of the switchover annotation, -1 without one.
+func (r *Mysql) SwitchoverTarget() (int, error) {
+	value, ok := r.Annotations[SwitchoverAnnotation]
+	if !ok {
+		return -1, nil
+	}
+	ordinal, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(value), r.Name+"-"))
+	if err != nil || ordinal < 0 || ordinal >= int(r.Spec.Replica) {
+		return -1, fmt.Errorf("%q is not the ordinal or pod name of a member", value)
+	}
+	return ordinal, nil
+}
+
+// validateSwitchover checks the switchover annotation, it is not part of ValidateSpec so
+// that a bad annotation does not stop the controller, which drops it instead.
+func (r *Mysql) validateSwitchover() field.ErrorList {
+	if _, found := r.Annotations[SwitchoverAnnotation]; found && r.Spec.Mysql.TopologyMode == TopologyMultiPrimary {
+		return field.ErrorList{field.Forbidden(field.NewPath("metadata", "annotations").Key(SwitchoverAnnotation),
+			"every member is a primary in multi-primary mode")}
+	}
+	if _, err := r.SwitchoverTarget(); err != nil {
+		return field.ErrorList{field.Invalid(field.NewPath("metadata", "annotations").Key(SwitchoverAnnotation),
+			r.Annotations[SwitchoverAnnotation], err.Error())}
+	}
+	return nil
+}
+
+// ServerIDBase returns the base of the server ids of the server id annotation, 0 without one.
+func (r *Mysql) ServerIDBase() (int64, error) {
+	value, ok := r.Annotations[ServerIDBaseAnnotation]
+	if !ok {
+		return 0, nil
+	}
+	base, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || base < 1 || base > math.MaxUint32-MaxReplica {
+		return 0, fmt.Errorf("must be a number between 1 and %d", math.MaxUint32-MaxReplica)
+	}
+	return base, nil
+}
+
+// validateServerIDBase checks the server id annotation, which can not change once set.
+func (r *Mysql) validateServerIDBase(old *Mysql) field.ErrorList {
+	path := field.NewPath("metadata", "annotations").Key(ServerIDBaseAnnotation)
+	value, found := r.Annotations[ServerIDBaseAnnotation]
+	if _, err := r.ServerIDBase(); err != nil {
+		return field.ErrorList{field.Invalid(path, value, err.Error())}
+	}
+	if old != nil {
+		if before, ok := old.Annotations[ServerIDBaseAnnotation]; ok && (!found || before != value) {
+			return field.ErrorList{field.Invalid(path, value, "annotation is immutable")}
+		}
+	}
+	return nil
+}
+
+func (r *Mysql) validateImmutable(old *Mysql) field.ErrorList {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+
+	immutable := func(path *field.Path, new, old interface{}) {
+		if !reflect.DeepEqual(new, old) {
+			errs = append(errs, field.Invalid(path, new, "field is immutable"))
+		}
+	}
+
+	persistencePath := spec.Child("persistence")
+	immutable(persistencePath.Child("enabled"), r.Spec.Persistence.Enabled, old.Spec.Persistence.Enabled)
+	immutable(persistencePath.Child("storageClass"), r.Spec.Persistence.StorageClass, old.Spec.Persistence.StorageClass)
+	immutable(persistencePath.Child("accessModes"), r.Spec.Persistence.AccessModes, old.Spec.Persistence.AccessModes)
+	immutable(persistencePath.Child("size"), r.Spec.Persistence.Size, old.Spec.Persistence.Size)
+	immutable(persistencePath.Child("hostPath"), r.Spec.Persistence.HostPath, old.Spec.Persistence.HostPath)
+	immutable(spec.Child("mysql", "credentialsSecretRef"), r.Spec.Mysql.CredentialsSecretRef, old.Spec.Mysql.CredentialsSecretRef)
+	immutable(spec.Child("mysql", "groupReplication", "communicationStack"),
+		r.Spec.Mysql.GroupReplication.CommunicationStack, old.Spec.Mysql.GroupReplication.CommunicationStack)
+
+	for _, option := range immutableMysqlOptions {
+		newKey, newValue := lookupMysqlOption(r.Spec.Mysql.MysqlConf, option)
+		_, oldValue := lookupMysqlOption(old.Spec.Mysql.MysqlConf, option)
+		if newValue != oldValue {
+			if newKey == "" {
+				newKey = option
+			}
+			errs = append(errs, field.Invalid(spec.Child("mysql", "mysqlConf").Key(newKey), newValue, "field is immutable"))
+		}
+	}
+	return errs
+}
+
+// NormalizeMysqlOption returns the canonical name of a mysqld option, so that
+// `loose-skip-grant-tables` and `skip_grant_tables` are the same option.
+func NormalizeMysqlOption(key string) string {
+	key = strings.ToLower(strings.TrimSpace(key))
+	key = strings.ReplaceAll(key, "-", "_")
+	return strings.TrimPrefix(key, "loose_")
+}
+
+func lookupMysqlOption(conf MysqlConf, option string) (string, string) {
+	for k, v := range conf {
+		if NormalizeMysqlOption(k) == option {
+			return k, v
+		}
+	}
+	return "", ""
+}
+
+func validateMysqlConf(path *field.Path, conf MysqlConf) field.ErrorList {
+	var errs field.ErrorList
+	for k := range conf {
+		if reason, ok := forbiddenMysqlOptions[NormalizeMysqlOption(k)]; ok {
+			errs = append(errs, field.Forbidden(path.Key(k), reason))
+		}
+	}
+	return errs
+}
+
+// validateRouterConf checks the `section.option` keys of routerConf. The options are passed to
+// the bootstrap on the command line, so values must not contain white space.
+func validateRouterConf(path *field.Path, conf RouterConf) field.ErrorList {
+	var errs field.ErrorList
+	for k, v := range conf {
+		option := k[strings.LastIndex(k, ".")+1:]
+		switch {
+		case !routerOptionRegexp.MatchString(k):
+			errs = append(errs, field.Invalid(path.Key(k), k, "must be an option name, optionally prefixed with its section and a dot"))
+		case forbiddenRouterOptions[option]:
+			errs = append(errs, field.Forbidden(path.Key(k), "managed by the router bootstrap"))
+		case v == "" || strings.ContainsAny(v, " \t\n\r"):
+			errs = append(errs, field.Invalid(path.Key(k), v, "must be a non-empty value without white space"))
+		}
+	}
+	return errs
+}
+
+func validateResources(path *field.Path, res corev1.ResourceRequirements) field.ErrorList {
+	var errs field.ErrorList
+	for name, request := range res.Requests {
+		limit, ok := res.Limits[name]
+		if ok && request.Cmp(limit) > 0 {
+			errs = append(errs, field.Invalid(path.Child("requests").Key(string(name)), request.String(),
+				fmt.Sprintf("must be less than or equal to %s limit %s", name, limit.String())))
+		}
+	}
+	return errs
+}
+
+// validateImage checks the image reference. The operator relies on mysql 8.0.17+ features
+// like the clone plugin, other versions are rejected, unknown tags only warned about.
+func validateImage(path *field.Path, image string) (admission.Warnings, field.ErrorList) {
+	if image == "" {
+		return nil, nil
+	}
+	if !imageRegexp.MatchString(image) {
+		return nil, field.ErrorList{field.Invalid(path, image, "invalid image reference")}
+	}
+
+	tag := ""
+	name := strings.SplitN(image, "@", 2)[0]
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		tag = name[i+1:]
+	}
+
+	m := versionRegexp.FindStringSubmatch(tag)
+	if m == nil {
+		return admission.Warnings{fmt.Sprintf("%s: can not tell the version of image %s, mysql 8.0 is expected", path, image)}, nil
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	if major != 8 {
+		return nil, field.ErrorList{field.NotSupported(path, image, []string{"8.0"})}
+	}
+	if minor == 0 && m[4] != "" {
+		if patch, _ := strconv.Atoi(m[4]); patch < 17 {
+			return nil, field.ErrorList{field.Invalid(path, image, "mysql 8.0.17 or later is required")}
+		}
+	}
+	if minor != 0 {
+		return admission.Warnings{fmt.Sprintf("%s: image %s is not tested, mysql 8.0 is expected", path, image)}, nil
+	}
+	return nil, nil
+}
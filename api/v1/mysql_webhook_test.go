@@ -0,0 +1,231 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newMysql() *Mysql {
+	ins := &Mysql{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql-axe", Namespace: "default"},
+	}
+	ins.Spec.Mysql.Resources.Limits = corev1.ResourceList{
+		corev1.ResourceMemory: resource.MustParse("2Gi"),
+	}
+	ins.Default()
+	return ins
+}
+
+var _ = Describe("Mysql Webhook", func() {
+
+	Context("When creating Mysql under Defaulting Webhook", func() {
+		It("Should fill in the default value if a required field is empty", func() {
+			ins := &Mysql{}
+			ins.Default()
+			Expect(ins.Spec.Replica).To(Equal(int32(DefaultReplica)))
+			Expect(ins.Spec.Mysql.MysqlImage).To(Equal(DefaultMysqlImage))
+			Expect(*ins.Spec.Persistence.Enabled).To(BeTrue())
+			Expect(ins.Spec.Persistence.Size).To(Equal(DefaultSize))
+		})
+	})
+
+	Context("When creating Mysql under Validating Webhook", func() {
+		It("Should admit a valid spec", func() {
+			_, err := newMysql().ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny an even replica count", func() {
+			ins := newMysql()
+			ins.Spec.Replica = 4
+			_, err := ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.replica")))
+		})
+
+		It("Should deny a replica count out of range", func() {
+			ins := newMysql()
+			ins.Spec.Replica = 11
+			_, err := ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("between 1 and 9")))
+		})
+
+		It("Should deny router options managed by the bootstrap", func() {
+			ins := newMysql()
+			ins.Spec.Router.RouterConf = RouterConf{"logger.level": "DEBUG", "metadata_cache:bootstrap.user": "admin"}
+			_, err := ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.router.routerConf[metadata_cache:bootstrap.user]")))
+			Expect(err).NotTo(MatchError(ContainSubstring("logger.level")))
+		})
+
+		It("Should require a final backup target for BackupThenDelete", func() {
+			ins := newMysql()
+			ins.Spec.DeletionPolicy = DeletionPolicyBackupThenDelete
+			_, err := ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.finalBackup.persistentVolumeClaim")))
+
+			ins.Spec.FinalBackup = &BackupTarget{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "backup"}}
+			_, err = ins.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny an unparseable size", func() {
+			ins := newMysql()
+			ins.Spec.Persistence.Size = "ten gigs"
+			_, err := ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.persistence.size")))
+		})
+
+		It("Should deny requests above limits", func() {
+			ins := newMysql()
+			ins.Spec.Mysql.Resources.Requests = corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("4Gi"),
+			}
+			_, err := ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.mysql.resources.requests[memory]")))
+		})
+
+		It("Should deny dangerous mysqld options", func() {
+			ins := newMysql()
+			ins.Spec.Mysql.MysqlConf = MysqlConf{"loose-skip-grant-tables": "ON"}
+			_, err := ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.mysql.mysqlConf[loose-skip-grant-tables]")))
+		})
+
+		It("Should deny unsupported mysql versions and warn about unknown tags", func() {
+			ins := newMysql()
+			ins.Spec.Mysql.MysqlImage = "mysql:5.7.44"
+			_, err := ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.mysql.mysqlimage")))
+
+			ins.Spec.Mysql.MysqlImage = "mysql:8.0.32"
+			warnings, err := ins.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("spec.router.routerimage")))
+		})
+
+		It("Should deny a preferred primary or switchover target that is not a member", func() {
+			ins := newMysql()
+			preferred := int32(3)
+			ins.Spec.Mysql.PreferredPrimary = &preferred
+			_, err := ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.mysql.preferredPrimary")))
+
+			preferred = 2
+			ins.Annotations = map[string]string{SwitchoverAnnotation: "mysql-axe-1"}
+			_, err = ins.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ins.SwitchoverTarget()).To(Equal(1))
+
+			ins.Annotations[SwitchoverAnnotation] = "5"
+			_, err = ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring(SwitchoverAnnotation)))
+		})
+
+		It("Should check the multi-primary prerequisites", func() {
+			ins := newMysql()
+			Expect(ins.Spec.Mysql.TopologyMode).To(Equal(TopologySinglePrimary))
+			ins.Spec.Mysql.TopologyMode = TopologyMultiPrimary
+			ins.Spec.Mysql.MysqlConf = MysqlConf{"transaction-isolation": "serializable"}
+			_, err := ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.mysql.mysqlConf[transaction-isolation]")))
+
+			ins.Spec.Mysql.MysqlConf = MysqlConf{"group_replication_single_primary_mode": "OFF"}
+			_, err = ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("managed by spec.mysql.topologyMode")))
+
+			ins.Spec.Mysql.MysqlConf = nil
+			ins.Annotations = map[string]string{SwitchoverAnnotation: "1"}
+			_, err = ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("multi-primary mode")))
+		})
+
+		It("Should validate the group replication settings", func() {
+			ins := newMysql()
+			ins.Spec.Mysql.PluginConf = MysqlConf{"loose-group_replication_consistency": "BEFORE"}
+			_, err := ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("managed by spec.mysql.groupReplication")))
+
+			ins.Spec.Mysql.PluginConf = nil
+			ins.Spec.Mysql.GroupReplication = GroupReplication{MessageCacheSize: "64Mi"}
+			_, err = ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.mysql.groupReplication.messageCacheSize")))
+
+			ins.Spec.Mysql.GroupReplication = GroupReplication{MessageCacheSize: "1Gi", CommunicationStack: "MYSQL", IPAllowlist: "10.0.0.0/8"}
+			_, err = ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.mysql.groupReplication.ipAllowlist")))
+		})
+
+		It("Should validate the tls settings", func() {
+			ins := newMysql()
+			ins.Spec.TLS = &TLS{IssuerRef: &IssuerReference{Name: "ca"}}
+			ins.Default()
+			Expect(ins.Spec.TLS.IssuerRef.Kind).To(Equal("Issuer"))
+			Expect(ins.Spec.TLS.RenewBefore.Duration).To(BeNumerically("<", ins.Spec.TLS.Duration.Duration))
+			_, err := ins.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			ins.Spec.TLS.SecretName = "mysql-tls"
+			ins.Spec.TLS.RenewBefore.Duration = ins.Spec.TLS.Duration.Duration
+			_, err = ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.tls.issuerRef")))
+			Expect(err).To(MatchError(ContainSubstring("spec.tls.renewBefore")))
+
+			ins.Spec.TLS = nil
+			ins.Spec.Mysql.MysqlConf = MysqlConf{"ssl-cert": "/tmp/server.pem"}
+			_, err = ins.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("managed by spec.tls")))
+		})
+	})
+
+	Context("When updating Mysql under Validating Webhook", func() {
+		It("Should deny changes of immutable fields", func() {
+			old := newMysql()
+			old.Spec.Mysql.MysqlConf = MysqlConf{"lower_case_table_names": "1"}
+
+			ins := newMysql()
+			ins.Spec.Persistence.StorageClass = "fast"
+			ins.Spec.Mysql.MysqlConf = MysqlConf{"lower-case-table-names": "0"}
+			_, err := ins.ValidateUpdate(old)
+			Expect(err).To(MatchError(ContainSubstring("spec.persistence.storageClass")))
+			Expect(err).To(MatchError(ContainSubstring("spec.mysql.mysqlConf[lower-case-table-names]")))
+		})
+
+		It("Should keep the server id base", func() {
+			old := newMysql()
+			old.Annotations = map[string]string{ServerIDBaseAnnotation: "42000"}
+
+			ins := newMysql()
+			_, err := ins.ValidateUpdate(old)
+			Expect(err).To(MatchError(ContainSubstring(ServerIDBaseAnnotation)))
+
+			ins.Annotations = map[string]string{ServerIDBaseAnnotation: "42000"}
+			_, err = ins.ValidateUpdate(old)
+			Expect(err).NotTo(HaveOccurred())
+
+			old.Annotations = nil
+			ins.Annotations[ServerIDBaseAnnotation] = "0"
+			_, err = ins.ValidateUpdate(old)
+			Expect(err).To(MatchError(ContainSubstring("must be a number between 1 and")))
+		})
+	})
+})
@@ -0,0 +1,122 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MysqlBackupSpec defines the desired state of MysqlBackup
+type MysqlBackupSpec struct {
+	// ClusterName is the Mysql cluster to back up, in the namespace of the backup.
+	ClusterName string `json:"clusterName"`
+
+	// Method is Logical, a dump of mysqlsh util.dumpInstance, or Physical, a copy of the
+	// data directory made with the clone plugin.
+	// +optional
+	// +kubebuilder:validation:Enum=Logical;Physical
+	// +kubebuilder:default:="Logical"
+	Method string `json:"method,omitempty"`
+
+	// Target is where the backup is written to.
+	Target BackupTarget `json:"target"`
+}
+
+// MysqlBackupStatus defines the observed state of MysqlBackup
+type MysqlBackupStatus struct {
+	// Phase is Pending, Running, Completed or Failed.
+	// +optional
+	Phase string `json:"phase,omitempty"`
+	// Message explains the phase.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// JobName is the job taking the backup.
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+	// SourceMember is the member the backup is taken from.
+	// +optional
+	SourceMember string `json:"sourceMember,omitempty"`
+	// StartTime is when the backup job was created.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the backup completed or failed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Size of the backup.
+	// +optional
+	Size string `json:"size,omitempty"`
+	// GtidExecuted is gtid_executed of the backup, the transactions it contains.
+	// +optional
+	GtidExecuted string `json:"gtidExecuted,omitempty"`
+	// Location is the url of the backup, pvc://<claim>/<dir> or s3://<bucket>/<prefix>/<dir>.
+	// +optional
+	Location string `json:"location,omitempty"`
+}
+
+const (
+	// BackupMethodLogical is a dump of mysqlsh util.dumpInstance.
+	BackupMethodLogical string = "Logical"
+	// BackupMethodPhysical is a copy of the data directory made with the clone plugin.
+	BackupMethodPhysical string = "Physical"
+)
+
+const (
+	// BackupPhasePending indicates the backup waits for its cluster.
+	BackupPhasePending string = "Pending"
+	// BackupPhaseRunning indicates the backup job is running.
+	BackupPhaseRunning string = "Running"
+	// BackupPhaseCompleted indicates the backup was written to its target.
+	BackupPhaseCompleted string = "Completed"
+	// BackupPhaseFailed indicates the backup job failed.
+	BackupPhaseFailed string = "Failed"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterName",description="The backed up cluster"
+//+kubebuilder:printcolumn:name="Method",type="string",JSONPath=".spec.method",description="Logical or physical backup"
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="The phase of the backup"
+//+kubebuilder:printcolumn:name="Size",type="string",JSONPath=".status.size",description="The size of the backup"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+//+kubebuilder:resource:shortName=mysqlbackup
+
+// MysqlBackup is the Schema for the mysqlbackups API, a one-shot backup of a Mysql cluster.
+type MysqlBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MysqlBackupSpec   `json:"spec,omitempty"`
+	Status MysqlBackupStatus `json:"status,omitempty"`
+}
+
+// Finished reports whether the backup completed or failed.
+func (b *MysqlBackup) Finished() bool {
+	return b.Status.Phase == BackupPhaseCompleted || b.Status.Phase == BackupPhaseFailed
+}
+
+//+kubebuilder:object:root=true
+
+// MysqlBackupList contains a list of MysqlBackup
+type MysqlBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MysqlBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MysqlBackup{}, &MysqlBackupList{})
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var mysqlbackuplog = logf.Log.WithName("mysqlbackup-resource")
+
+const (
+	DefaultS3Endpoint = "https://s3.amazonaws.com"
+	DefaultS3Image    = "minio/mc:latest"
+)
+
+var bucketRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+func (r *MysqlBackup) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-database-wufan-v1-mysqlbackup,mutating=true,failurePolicy=fail,sideEffects=None,groups=database.wufan,resources=mysqlbackups,verbs=create;update,versions=v1,name=mmysqlbackup.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &MysqlBackup{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *MysqlBackup) Default() {
+	mysqlbackuplog.Info("default", "name", r.Name)
+
+	if r.Spec.Method == "" {
+		r.Spec.Method = BackupMethodLogical
+	}
+	r.Spec.Target.Default()
+}
+
+// Default fills in the defaults of the S3 target.
+func (t *BackupTarget) Default() {
+	if t.S3 == nil {
+		return
+	}
+	if t.S3.Endpoint == "" {
+		t.S3.Endpoint = DefaultS3Endpoint
+	}
+	if t.S3.Image == "" {
+		t.S3.Image = DefaultS3Image
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-database-wufan-v1-mysqlbackup,mutating=false,failurePolicy=fail,sideEffects=None,groups=database.wufan,resources=mysqlbackups,verbs=create;update,versions=v1,name=vmysqlbackup.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &MysqlBackup{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *MysqlBackup) ValidateCreate() (admission.Warnings, error) {
+	mysqlbackuplog.Info("validate create", "name", r.Name)
+
+	return nil, r.invalid(r.ValidateSpec())
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+// A backup is taken once, its spec can not be changed.
+func (r *MysqlBackup) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	mysqlbackuplog.Info("validate update", "name", r.Name)
+
+	oldBackup, ok := old.(*MysqlBackup)
+	if !ok {
+		return nil, fmt.Errorf("expected a MysqlBackup but got a %T", old)
+	}
+	errs := r.ValidateSpec()
+	if !reflect.DeepEqual(r.Spec, oldBackup.Spec) {
+		errs = append(errs, field.Forbidden(field.NewPath("spec"), "is immutable, create a new backup"))
+	}
+	return nil, r.invalid(errs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *MysqlBackup) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (r *MysqlBackup) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "MysqlBackup"}, r.Name, errs)
+}
+
+// ValidateSpec checks the spec of a new backup.
+// It is also called by the controller in case the webhook is not deployed.
+func (r *MysqlBackup) ValidateSpec() field.ErrorList {
+	spec := field.NewPath("spec")
+	var errs field.ErrorList
+	if r.Spec.ClusterName == "" {
+		errs = append(errs, field.Required(spec.Child("clusterName"), ""))
+	}
+	if r.Spec.Method != BackupMethodLogical && r.Spec.Method != BackupMethodPhysical {
+		errs = append(errs, field.NotSupported(spec.Child("method"), r.Spec.Method, []string{BackupMethodLogical, BackupMethodPhysical}))
+	}
+	return append(errs, r.Spec.Target.validate(spec.Child("target"))...)
+}
+
+// validate checks that the target is either a volume claim or an S3 bucket.
+func (t *BackupTarget) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	switch {
+	case t.PersistentVolumeClaim == nil && t.S3 == nil:
+		errs = append(errs, field.Required(path, "one of persistentVolumeClaim or s3 is required"))
+	case t.PersistentVolumeClaim != nil && t.S3 != nil:
+		errs = append(errs, field.Forbidden(path.Child("s3"), "can not be set together with persistentVolumeClaim"))
+	case t.PersistentVolumeClaim != nil && t.PersistentVolumeClaim.ClaimName == "":
+		errs = append(errs, field.Required(path.Child("persistentVolumeClaim", "claimName"), ""))
+	case t.S3 != nil:
+		s3 := path.Child("s3")
+		if !bucketRegexp.MatchString(t.S3.Bucket) {
+			errs = append(errs, field.Invalid(s3.Child("bucket"), t.S3.Bucket, "must be a bucket name"))
+		}
+		if t.S3.CredentialsSecret.Name == "" {
+			errs = append(errs, field.Required(s3.Child("credentialsSecret", "name"), ""))
+		}
+		if !strings.HasPrefix(t.S3.Endpoint, "http://") && !strings.HasPrefix(t.S3.Endpoint, "https://") {
+			errs = append(errs, field.Invalid(s3.Child("endpoint"), t.S3.Endpoint, "must be an http or https url"))
+		}
+		if strings.ContainsAny(t.S3.Prefix, " \t\n\r'\"") {
+			errs = append(errs, field.Invalid(s3.Child("prefix"), t.S3.Prefix, "must not contain white space or quotes"))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newMysqlBackup() *MysqlBackup {
+	backup := &MysqlBackup{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql-axe-backup", Namespace: "default"},
+		Spec: MysqlBackupSpec{
+			ClusterName: "mysql-axe",
+			Target: BackupTarget{
+				S3: &S3Target{
+					Bucket:            "mysql-backups",
+					CredentialsSecret: corev1.LocalObjectReference{Name: "minio-credentials"},
+				},
+			},
+		},
+	}
+	backup.Default()
+	return backup
+}
+
+var _ = Describe("MysqlBackup Webhook", func() {
+
+	Context("When creating MysqlBackup under Defaulting Webhook", func() {
+		It("Should fill in the method and the S3 client", func() {
+			backup := newMysqlBackup()
+			Expect(backup.Spec.Method).To(Equal(BackupMethodLogical))
+			Expect(backup.Spec.Target.S3.Endpoint).To(Equal(DefaultS3Endpoint))
+			Expect(backup.Spec.Target.S3.Image).To(Equal(DefaultS3Image))
+		})
+	})
+
+	Context("When creating MysqlBackup under Validating Webhook", func() {
+		It("Should admit a valid spec", func() {
+			_, err := newMysqlBackup().ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should validate the target", func() {
+			backup := newMysqlBackup()
+			backup.Spec.Target.S3.Bucket = "Backups"
+			backup.Spec.Target.S3.Endpoint = "minio:9000"
+			_, err := backup.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.target.s3.bucket")))
+			Expect(err).To(MatchError(ContainSubstring("spec.target.s3.endpoint")))
+
+			backup.Spec.Target.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "backups"}
+			_, err = backup.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("can not be set together with persistentVolumeClaim")))
+
+			backup.Spec.Target.S3 = nil
+			_, err = backup.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When updating MysqlBackup under Validating Webhook", func() {
+		It("Should deny changes of the spec", func() {
+			old := newMysqlBackup()
+			backup := newMysqlBackup()
+			backup.Spec.Method = BackupMethodPhysical
+			_, err := backup.ValidateUpdate(old)
+			Expect(err).To(MatchError(ContainSubstring("is immutable")))
+		})
+	})
+})
@@ -0,0 +1,163 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MysqlBackupScheduleSpec defines the desired state of MysqlBackupSchedule
+type MysqlBackupScheduleSpec struct {
+	// Schedule is a cron expression in UTC, e.g. "0 3 * * *", or a descriptor like @daily.
+	// A CRON_TZ= prefix selects another time zone.
+	Schedule string `json:"schedule"`
+
+	// Suspend stops creating backups, the retention still applies.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// ConcurrencyPolicy is what happens when a backup is due while the previous one still
+	// runs: Allow takes both, Forbid skips the new one, Replace deletes the running one.
+	// +optional
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	// +kubebuilder:default:="Forbid"
+	ConcurrencyPolicy string `json:"concurrencyPolicy,omitempty"`
+
+	// StartingDeadlineSeconds is how late a backup may start after its scheduled time, e.g.
+	// after an operator restart. A missed backup is skipped. Unset means no deadline.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
+	// Retention is how long the completed backups are kept. Expired backups are deleted along
+	// with their data on the target.
+	// +optional
+	Retention BackupRetention `json:"retention,omitempty"`
+
+	// BackupTemplate is the spec of the created backups.
+	BackupTemplate MysqlBackupSpec `json:"backupTemplate"`
+}
+
+// BackupRetention limits the completed backups of a schedule, a backup is kept as long as
+// every limit keeps it. Failed backups are deleted once they drop out of the history.
+type BackupRetention struct {
+	// KeepLast is the number of the latest completed backups to keep.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	KeepLast *int32 `json:"keepLast,omitempty"`
+
+	// KeepFor is how long a completed backup is kept, e.g. 168h.
+	// +optional
+	KeepFor *metav1.Duration `json:"keepFor,omitempty"`
+}
+
+// BackupRun is a backup created by a schedule.
+type BackupRun struct {
+	// Name is the name of the MysqlBackup.
+	Name string `json:"name"`
+	// ScheduledTime is the time the backup was due.
+	ScheduledTime metav1.Time `json:"scheduledTime"`
+	// Phase is the phase of the backup, Deleted once the retention removed it.
+	// +optional
+	Phase string `json:"phase,omitempty"`
+	// CompletionTime is when the backup completed or failed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Size of the backup.
+	// +optional
+	Size string `json:"size,omitempty"`
+	// Location is the url of the backup.
+	// +optional
+	Location string `json:"location,omitempty"`
+}
+
+// MysqlBackupScheduleStatus defines the observed state of MysqlBackupSchedule
+type MysqlBackupScheduleStatus struct {
+	// LastScheduleTime is the last time a backup was due.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// LastSuccessfulTime is the completion time of the last completed backup.
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// NextScheduleTime is the next time a backup is due.
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+	// Active are the backups that did not finish yet.
+	// +optional
+	Active []string `json:"active,omitempty"`
+	// History contains the latest backups, newest first.
+	// +optional
+	History []BackupRun `json:"history,omitempty"`
+	// Message explains why the last backup was skipped or the schedule is invalid.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	// ConcurrencyPolicyAllow takes a new backup while the previous one runs.
+	ConcurrencyPolicyAllow string = "Allow"
+	// ConcurrencyPolicyForbid skips a new backup while the previous one runs.
+	ConcurrencyPolicyForbid string = "Forbid"
+	// ConcurrencyPolicyReplace deletes the running backup for the new one.
+	ConcurrencyPolicyReplace string = "Replace"
+)
+
+const (
+	// BackupScheduleLabel is the label of the backups created by a schedule, its value is
+	// the schedule name.
+	BackupScheduleLabel = "database.wufan/backup-schedule"
+	// BackupScheduledTimeAnnotation is the time a backup of a schedule was due, in RFC 3339.
+	BackupScheduledTimeAnnotation = "database.wufan/scheduled-time"
+	// BackupArtifactsFinalizer deletes the data of a backup on its target along with it.
+	// It is set on the backups of a schedule, and may be set on any backup.
+	BackupArtifactsFinalizer = "database.wufan/backup-artifacts"
+	// BackupPhaseDeleted is the phase of a backup in the history of its schedule once it
+	// was deleted.
+	BackupPhaseDeleted string = "Deleted"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.backupTemplate.clusterName",description="The backed up cluster"
+//+kubebuilder:printcolumn:name="Schedule",type="string",JSONPath=".spec.schedule",description="The cron schedule"
+//+kubebuilder:printcolumn:name="Suspend",type="boolean",JSONPath=".spec.suspend",description="Whether the schedule is suspended"
+//+kubebuilder:printcolumn:name="Last Schedule",type="date",JSONPath=".status.lastScheduleTime",description="The last time a backup was due"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+//+kubebuilder:resource:shortName=mysqlbackupschedule
+
+// MysqlBackupSchedule is the Schema for the mysqlbackupschedules API, it creates MysqlBackups
+// on a cron schedule and deletes them once they expire. Its backups are kept when it is deleted.
+type MysqlBackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MysqlBackupScheduleSpec   `json:"spec,omitempty"`
+	Status MysqlBackupScheduleStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MysqlBackupScheduleList contains a list of MysqlBackupSchedule
+type MysqlBackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MysqlBackupSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MysqlBackupSchedule{}, &MysqlBackupScheduleList{})
+}
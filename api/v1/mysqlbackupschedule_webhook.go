@@ -0,0 +1,125 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+
+	"github.com/robfig/cron/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var mysqlbackupschedulelog = logf.Log.WithName("mysqlbackupschedule-resource")
+
+func (r *MysqlBackupSchedule) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-database-wufan-v1-mysqlbackupschedule,mutating=true,failurePolicy=fail,sideEffects=None,groups=database.wufan,resources=mysqlbackupschedules,verbs=create;update,versions=v1,name=mmysqlbackupschedule.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &MysqlBackupSchedule{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *MysqlBackupSchedule) Default() {
+	mysqlbackupschedulelog.Info("default", "name", r.Name)
+
+	if r.Spec.ConcurrencyPolicy == "" {
+		r.Spec.ConcurrencyPolicy = ConcurrencyPolicyForbid
+	}
+	if r.Spec.BackupTemplate.Method == "" {
+		r.Spec.BackupTemplate.Method = BackupMethodLogical
+	}
+	r.Spec.BackupTemplate.Target.Default()
+}
+
+//+kubebuilder:webhook:path=/validate-database-wufan-v1-mysqlbackupschedule,mutating=false,failurePolicy=fail,sideEffects=None,groups=database.wufan,resources=mysqlbackupschedules,verbs=create;update,versions=v1,name=vmysqlbackupschedule.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &MysqlBackupSchedule{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *MysqlBackupSchedule) ValidateCreate() (admission.Warnings, error) {
+	mysqlbackupschedulelog.Info("validate create", "name", r.Name)
+
+	return nil, r.invalid(r.ValidateSpec())
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+// The template only applies to the backups created after the update.
+func (r *MysqlBackupSchedule) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	mysqlbackupschedulelog.Info("validate update", "name", r.Name)
+
+	if _, ok := old.(*MysqlBackupSchedule); !ok {
+		return nil, fmt.Errorf("expected a MysqlBackupSchedule but got a %T", old)
+	}
+	return nil, r.invalid(r.ValidateSpec())
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *MysqlBackupSchedule) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (r *MysqlBackupSchedule) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "MysqlBackupSchedule"}, r.Name, errs)
+}
+
+// ValidateSpec checks the schedule, the retention and the backup template.
+// It is also called by the controller in case the webhook is not deployed.
+func (r *MysqlBackupSchedule) ValidateSpec() field.ErrorList {
+	spec := field.NewPath("spec")
+	var errs field.ErrorList
+	if _, err := cron.ParseStandard(r.Spec.Schedule); err != nil {
+		errs = append(errs, field.Invalid(spec.Child("schedule"), r.Spec.Schedule, err.Error()))
+	}
+	switch r.Spec.ConcurrencyPolicy {
+	case ConcurrencyPolicyAllow, ConcurrencyPolicyForbid, ConcurrencyPolicyReplace:
+	default:
+		errs = append(errs, field.NotSupported(spec.Child("concurrencyPolicy"), r.Spec.ConcurrencyPolicy,
+			[]string{ConcurrencyPolicyAllow, ConcurrencyPolicyForbid, ConcurrencyPolicyReplace}))
+	}
+	if d := r.Spec.StartingDeadlineSeconds; d != nil && *d < 0 {
+		errs = append(errs, field.Invalid(spec.Child("startingDeadlineSeconds"), *d, "must not be negative"))
+	}
+	retention := spec.Child("retention")
+	if n := r.Spec.Retention.KeepLast; n != nil && *n < 1 {
+		errs = append(errs, field.Invalid(retention.Child("keepLast"), *n, "must keep at least one backup"))
+	}
+	if d := r.Spec.Retention.KeepFor; d != nil && d.Duration <= 0 {
+		errs = append(errs, field.Invalid(retention.Child("keepFor"), d.Duration.String(), "must be positive"))
+	}
+
+	// the template is checked as the spec of a backup
+	backup := &MysqlBackup{Spec: r.Spec.BackupTemplate}
+	for _, err := range backup.ValidateSpec() {
+		err.Field = spec.Child("backupTemplate").String() + err.Field[len("spec"):]
+		errs = append(errs, err)
+	}
+	return errs
+}
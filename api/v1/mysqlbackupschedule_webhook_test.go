@@ -0,0 +1,66 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newMysqlBackupSchedule() *MysqlBackupSchedule {
+	schedule := &MysqlBackupSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql-axe-daily", Namespace: "default"},
+		Spec: MysqlBackupScheduleSpec{
+			Schedule:       "0 3 * * *",
+			BackupTemplate: newMysqlBackup().Spec,
+		},
+	}
+	schedule.Default()
+	return schedule
+}
+
+var _ = Describe("MysqlBackupSchedule Webhook", func() {
+
+	Context("When creating MysqlBackupSchedule under Defaulting Webhook", func() {
+		It("Should forbid concurrent backups", func() {
+			Expect(newMysqlBackupSchedule().Spec.ConcurrencyPolicy).To(Equal(ConcurrencyPolicyForbid))
+		})
+	})
+
+	Context("When creating MysqlBackupSchedule under Validating Webhook", func() {
+		It("Should admit a valid spec", func() {
+			schedule := newMysqlBackupSchedule()
+			schedule.Spec.Schedule = "CRON_TZ=Asia/Shanghai @daily"
+			_, err := schedule.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should validate the schedule, the retention and the template", func() {
+			schedule := newMysqlBackupSchedule()
+			schedule.Spec.Schedule = "0 3 * *"
+			keepLast := int32(0)
+			schedule.Spec.Retention.KeepLast = &keepLast
+			schedule.Spec.BackupTemplate.ClusterName = ""
+			_, err := schedule.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("spec.schedule")))
+			Expect(err).To(MatchError(ContainSubstring("spec.retention.keepLast")))
+			Expect(err).To(MatchError(ContainSubstring("spec.backupTemplate.clusterName")))
+		})
+	})
+})
@@ -0,0 +1,301 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+	"fmt"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// BackupLabel is the label of the jobs of a MysqlBackup, its value is the backup name.
+	BackupLabel = "database.wufan/backup"
+
+	// S3AccessKeyIDKey is the key of the access key id in the S3 credentials secret.
+	S3AccessKeyIDKey = "accessKeyId"
+	// S3SecretAccessKeyKey is the key of the secret access key in the S3 credentials secret.
+	S3SecretAccessKeyKey = "secretAccessKey"
+)
+
+// BackupResult is what a backup job reports in its termination message.
+type BackupResult struct {
+	GtidExecuted string `json:"gtidExecuted"`
+	// Size is the size of the backup in bytes.
+	Size int64 `json:"size"`
+}
+
+// BackupJobName returns the name of the job taking the backup.
+func BackupJobName(backup *databasev1.MysqlBackup) string {
+	return backup.Name + "-backup"
+}
+
+// backupDir returns the directory of the backup on its target, <namespace>-<backup name>.
+func backupDir(backup *databasev1.MysqlBackup) string {
+	return backup.Namespace + "-" + backup.Name
+}
+
+// BackupLocation returns the url of the backup, pvc://<claim>/<dir> or s3://<bucket>/<prefix>/<dir>.
+func BackupLocation(backup *databasev1.MysqlBackup) string {
+	target := backup.Spec.Target
+	if target.S3 != nil {
+		return "s3://" + s3Path(target.S3) + "/" + backupDir(backup)
+	}
+	return "pvc://" + target.PersistentVolumeClaim.ClaimName + "/" + backupDir(backup)
+}
+
+func s3Path(s3 *databasev1.S3Target) string {
+	if prefix := strings.Trim(s3.Prefix, "/"); prefix != "" {
+		return s3.Bucket + "/" + prefix
+	}
+	return s3.Bucket
+}
+
+// logicalBackupScript dumps host with mysqlsh util.dumpInstance into dir.
+func logicalBackupScript(host string, dir string) string {
+	return fmt.Sprintf(`printf '%%s\n' "$MYSQL_PWD" | mysqlsh --passwords-from-stdin --no-wizard --js --uri root@%s:3306 \
+  -e 'util.dumpInstance("%s", {consistent: true, threads: 4})'
+GTID=$(sed -n 's/.*"gtidExecuted": *"\([^"]*\)".*/\1/p' "%s/@.json" | head -n1)
+`, host, dir, dir)
+}
+
+// physicalBackupScript clones the data directory of host into dir. A temporary mysqld is
+// started as the clone recipient, the donor is only read.
+func physicalBackupScript(host string, dir string) string {
+	return fmt.Sprintf(`rm -rf /tmp/recipient
+mysqld --no-defaults --initialize-insecure --user=root --datadir=/tmp/recipient
+mysqld --no-defaults --user=root --datadir=/tmp/recipient --socket=/tmp/recipient.sock --skip-networking \
+  --plugin-load-add=mysql_clone.so --clone-valid-donor-list=%s:3306 &
+until MYSQL_PWD= mysqladmin --socket=/tmp/recipient.sock -uroot ping >/dev/null 2>&1; do sleep 1; done
+DONOR_PWD=$(printf '%%s' "$MYSQL_PWD" | sed "s/'/''/g")
+MYSQL_PWD= mysql --socket=/tmp/recipient.sock -uroot \
+  -e "CLONE INSTANCE FROM 'root'@'%s':3306 IDENTIFIED BY '$DONOR_PWD' DATA DIRECTORY = '%s'"
+GTID=$(MYSQL_PWD= mysql --socket=/tmp/recipient.sock -uroot -N -e "SELECT GTID_EXECUTED FROM performance_schema.clone_status")
+MYSQL_PWD= mysqladmin --socket=/tmp/recipient.sock -uroot shutdown
+`, host, host, dir)
+}
+
+// BackupJob builds the job backing up the member at host. The backup is written to the
+// claim of the target, or to a scratch volume an S3 client uploads it from. A retried job
+// starts over. The job reports a BackupResult in the termination message of its last
+// container, it is also written next to the backup as <dir>.json.
+func BackupJob(ins *databasev1.Mysql, backup *databasev1.MysqlBackup, host string) *batchv1.Job {
+	dir := "/backup/" + backupDir(backup)
+	script := "set -e\nrm -rf " + dir + " " + dir + ".json\n"
+	if backup.Spec.Method == databasev1.BackupMethodPhysical {
+		script += physicalBackupScript(host, dir)
+	} else {
+		script += logicalBackupScript(host, dir)
+	}
+	script += fmt.Sprintf(`GTID=$(printf '%%s' "$GTID" | sed 's/\\n//g' | tr -d '\n ')
+SIZE=$(du -sb %s | cut -f1)
+printf '{"gtidExecuted":"%%s","size":%%s}' "$GTID" "$SIZE" > %s.json
+cp %s.json /dev/termination-log
+`, dir, dir, dir)
+
+	job := cleanupJob(ins, BackupJobName(backup), script)
+	job.Labels[BackupLabel] = backup.Name
+	job.Spec.Template.Labels[BackupLabel] = backup.Name
+	spec := &job.Spec.Template.Spec
+	spec.Containers[0].Name = "backup"
+	spec.Containers[0].Env = []corev1.EnvVar{
+		secretEnv(ins, "MYSQL_PWD", RootPasswordKey, false),
+	}
+	spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+		{
+			Name:      "backup",
+			MountPath: "/backup",
+		},
+	}
+
+	target := backup.Spec.Target
+	if target.PersistentVolumeClaim != nil {
+		pvc := *target.PersistentVolumeClaim
+		pvc.ReadOnly = false
+		spec.Volumes = []corev1.Volume{
+			{
+				Name: "backup",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &pvc,
+				},
+			},
+		}
+		return job
+	}
+
+	// the backup is taken first, then uploaded
+	spec.Volumes = []corev1.Volume{
+		{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+	}
+	spec.InitContainers = spec.Containers
+	spec.Containers = []corev1.Container{s3UploadContainer(target.S3, dir)}
+	return job
+}
+
+// s3UploadContainer uploads dir and its result file to the bucket with the minio client.
+func s3UploadContainer(s3 *databasev1.S3Target, dir string) corev1.Container {
+	script := fmt.Sprintf(`set -e
+mc alias set target "$S3_ENDPOINT" "$AWS_ACCESS_KEY_ID" "$AWS_SECRET_ACCESS_KEY" >/dev/null
+mc cp --recursive %s target/%s/
+mc cp %s.json target/%s/
+cp %s.json /dev/termination-log
+`, dir, s3Path(s3), dir, s3Path(s3), dir)
+	return corev1.Container{
+		Name:    "upload",
+		Image:   s3.Image,
+		Command: []string{"sh", "-c", script},
+		Env:     s3Env(s3),
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "backup",
+				MountPath: "/backup",
+			},
+		},
+	}
+}
+
+// s3Env returns the endpoint and the credentials of the bucket for the minio client.
+func s3Env(s3 *databasev1.S3Target) []corev1.EnvVar {
+	optional := false
+	secretKey := func(name, key string) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: s3.CredentialsSecret,
+					Key:                  key,
+					Optional:             &optional,
+				},
+			},
+		}
+	}
+	return []corev1.EnvVar{
+		{
+			Name:  "S3_ENDPOINT",
+			Value: s3.Endpoint,
+		},
+		{
+			// mc writes its config to the home directory
+			Name:  "HOME",
+			Value: "/tmp",
+		},
+		secretKey("AWS_ACCESS_KEY_ID", S3AccessKeyIDKey),
+		secretKey("AWS_SECRET_ACCESS_KEY", S3SecretAccessKeyKey),
+	}
+}
+
+// BackupCleanupJobName returns the name of the job deleting the data of a backup.
+func BackupCleanupJobName(backup *databasev1.MysqlBackup) string {
+	return backup.Name + "-cleanup"
+}
+
+// BackupCleanupJob builds the job deleting the data of the backup from its target. The
+// cluster may be gone, a volume claim is cleaned up with image.
+func BackupCleanupJob(backup *databasev1.MysqlBackup, image string) *batchv1.Job {
+	backoffLimit := int32(3)
+	labels := map[string]string{
+		"clustername": backup.Spec.ClusterName,
+		BackupLabel:   backup.Name,
+	}
+	job := &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      BackupCleanupJobName(backup),
+			Namespace: backup.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+				},
+			},
+		},
+	}
+
+	spec := &job.Spec.Template.Spec
+	target := backup.Spec.Target
+	if target.S3 != nil {
+		path := s3Path(target.S3) + "/" + backupDir(backup)
+		spec.Containers = []corev1.Container{
+			{
+				Name:  "cleanup",
+				Image: target.S3.Image,
+				Command: []string{"sh", "-c", fmt.Sprintf(`set -e
+mc alias set target "$S3_ENDPOINT" "$AWS_ACCESS_KEY_ID" "$AWS_SECRET_ACCESS_KEY" >/dev/null
+mc rm --recursive --force target/%s/
+mc rm --force target/%s.json
+`, path, path)},
+				Env: s3Env(target.S3),
+			},
+		}
+		return job
+	}
+
+	pvc := *target.PersistentVolumeClaim
+	pvc.ReadOnly = false
+	dir := "/backup/" + backupDir(backup)
+	spec.Containers = []corev1.Container{
+		{
+			Name:    "cleanup",
+			Image:   image,
+			Command: []string{"sh", "-c", "rm -rf " + dir + " " + dir + ".json"},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      "backup",
+					MountPath: "/backup",
+				},
+			},
+		},
+	}
+	spec.Volumes = []corev1.Volume{
+		{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &pvc,
+			},
+		},
+	}
+	return job
+}
+
+// ScheduledBackupName returns the name of the backup of schedule due at t, the minutes since
+// the epoch make it unique per schedule.
+func ScheduledBackupName(schedule *databasev1.MysqlBackupSchedule, t time.Time) string {
+	return fmt.Sprintf("%s-%d", schedule.Name, t.Unix()/60)
+}
+
+// ScheduledBackup builds the backup of schedule due at t. Its data is deleted along with it
+// when the retention of the schedule expires it.
+func ScheduledBackup(schedule *databasev1.MysqlBackupSchedule, t time.Time) *databasev1.MysqlBackup {
+	return &databasev1.MysqlBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ScheduledBackupName(schedule, t),
+			Namespace: schedule.Namespace,
+			Labels: map[string]string{
+				"clustername":                  schedule.Spec.BackupTemplate.ClusterName,
+				databasev1.BackupScheduleLabel: schedule.Name,
+			},
+			Annotations: map[string]string{
+				databasev1.BackupScheduledTimeAnnotation: t.UTC().Format(time.RFC3339),
+			},
+			Finalizers: []string{databasev1.BackupArtifactsFinalizer},
+		},
+		Spec: *schedule.Spec.BackupTemplate.DeepCopy(),
+	}
+}
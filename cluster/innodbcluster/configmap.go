@@ -2,12 +2,267 @@ package innodbcluster
 
 import (
 	databasev1 "axe/api/v1"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func MysqlConfigmap(ins *databasev1.Mysql) *corev1.ConfigMap {
+const (
+	// MysqlCnfKey is the configmap key of the mysqld options.
+	MysqlCnfKey = "mysql.cnf"
+	// PluginCnfKey is the configmap key of the plugin options.
+	PluginCnfKey = "plugin.cnf"
+	// InitSQLKey is the configmap key of the sql run once when a member is initialized.
+	InitSQLKey = "init.sql"
+	// RouterConfKey is the configmap key of the router options.
+	RouterConfKey = "mysqlrouter.conf"
+
+	// ConfigHashAnnotation is the pod template annotation holding the hash of the rendered
+	// config, a config change rolls the members one by one.
+	ConfigHashAnnotation = "database.wufan/config-hash"
+)
+
+// MysqlConfigName returns the name of the configmap generated for the mysql config.
+func MysqlConfigName(ins *databasev1.Mysql) string {
+	return ins.Name + "-mysql"
+}
+
+// MysqlConfigData renders the mysql configmap data. template holds the content of the
+// template configmaps, keys missing there fall back to the built-in defaults. The
+// spec.mysql.mysqlConf and pluginConf options are merged into the [mysqld] section, the
+// group replication settings that are not cluster options and the certificates of spec.tls
+// go to plugin.cnf and mysql.cnf.
+func MysqlConfigData(ins *databasev1.Mysql, template map[string]string) map[string]string {
+	mysqlCnf, ok := template[MysqlCnfKey]
+	if !ok {
+		mysqlCnf = mysqlcnf(ins)
+	}
+	pluginCnf, ok := template[PluginCnfKey]
+	if !ok {
+		pluginCnf = PluginConfdata
+	}
+
+	// the options managed by the operator are merged last, they win over the spec
+	data := map[string]string{
+		MysqlCnfKey: mergeCnf(mergeCnf(mysqlCnf, "mysqld", ins.Spec.Mysql.MysqlConf), "mysqld", tlsMysqlConf(ins)),
+		PluginCnfKey: mergeCnf(mergeCnf(mergeCnf(pluginCnf, "mysqld", ins.Spec.Mysql.PluginConf), "mysqld", groupReplicationConf(ins)),
+			"mysqld", tlsPluginConf(ins)),
+	}
+	if sql, ok := template[InitSQLKey]; ok {
+		data[InitSQLKey] = sql
+	}
+	return data
+}
+
+// groupReplicationConf returns the options of spec.mysql.groupReplication that are set in
+// the option files.
+func groupReplicationConf(ins *databasev1.Mysql) databasev1.MysqlConf {
+	gr := ins.Spec.Mysql.GroupReplication
+	conf := databasev1.MysqlConf{}
+	if gr.FlowControlMode != "" {
+		conf["loose-group_replication_flow_control_mode"] = gr.FlowControlMode
+	}
+	if size, err := resource.ParseQuantity(gr.MessageCacheSize); err == nil {
+		conf["loose-group_replication_message_cache_size"] = strconv.FormatInt(size.Value(), 10)
+	}
+	return conf
+}
+
+// ConfigHash returns a stable hash of the configmap data.
+func ConfigHash(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(data[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// mergeCnf sets the options of conf in section of the ini text cnf. An option already in
+// the section is replaced in place, the others are appended in key order, so the result
+// only depends on its inputs.
+func mergeCnf(cnf string, section string, conf databasev1.MysqlConf) string {
+	keys := make([]string, 0, len(conf))
+	for k := range conf {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := strings.Split(strings.TrimRight(cnf, " \t\n"), "\n")
+	done := map[string]bool{}
+	current, end := "", -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			current = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			continue
+		}
+		if current != section || trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';' {
+			continue
+		}
+		end = i
+		name, _, _ := strings.Cut(trimmed, "=")
+		for _, k := range keys {
+			if !done[k] && databasev1.NormalizeMysqlOption(name) == databasev1.NormalizeMysqlOption(k) {
+				// keep the spelling of the template, e.g. a loose- prefix
+				lines[i] = cnfOption(strings.TrimSpace(name), conf[k])
+				done[k] = true
+				break
+			}
+		}
+	}
+
+	var added []string
+	for _, k := range keys {
+		if !done[k] {
+			added = append(added, cnfOption(k, conf[k]))
+		}
+	}
+	if len(added) > 0 {
+		if end < 0 {
+			lines = append(lines, "", "["+section+"]")
+			end = len(lines) - 1
+		}
+		lines = append(lines[:end+1], append(added, lines[end+1:]...)...)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// RouterConfigName returns the name of the configmap generated for the router config.
+func RouterConfigName(ins *databasev1.Mysql) string {
+	return ins.Name + "-router"
+}
+
+// RouterConfigData renders the router configmap data from the template, or the built-in
+// default, and spec.router.routerConf. A routerConf key is `section.option`, options
+// without a section belong to [DEFAULT]. With spec.tls the router verifies the members.
+func RouterConfigData(ins *databasev1.Mysql, template map[string]string) map[string]string {
+	cnf, ok := template[RouterConfKey]
+	if !ok {
+		cnf = RouterConfdata
+	}
+
+	sections := routerTopologyConf(ins)
+	for section, conf := range routerTLSConf(ins) {
+		sections[section] = conf
+	}
+	for k, v := range ins.Spec.Router.RouterConf {
+		section, option, ok := strings.Cut(k, ".")
+		if !ok {
+			section, option = "DEFAULT", k
+		}
+		if sections[section] == nil {
+			sections[section] = databasev1.MysqlConf{}
+		}
+		sections[section][option] = v
+	}
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cnf = mergeCnf(cnf, name, sections[name])
+	}
+	return map[string]string{RouterConfKey: cnf}
+}
+
+// routerTopologyConf returns the routes of the topology mode. The routes generated by the
+// bootstrap send writes to the primary and reads to the secondaries, in multi-primary mode
+// both are spread over all members.
+func routerTopologyConf(ins *databasev1.Mysql) map[string]databasev1.MysqlConf {
+	sections := map[string]databasev1.MysqlConf{}
+	if ins.Spec.Mysql.TopologyMode != databasev1.TopologyMultiPrimary {
+		return sections
+	}
+	for _, section := range []string{"routing:bootstrap_rw", "routing:bootstrap_x_rw"} {
+		sections[section] = databasev1.MysqlConf{
+			"destinations":     "metadata-cache://" + ClusterName + "/?role=PRIMARY",
+			"routing_strategy": "round-robin",
+		}
+	}
+	for _, section := range []string{"routing:bootstrap_ro", "routing:bootstrap_x_ro"} {
+		sections[section] = databasev1.MysqlConf{
+			"destinations":     "metadata-cache://" + ClusterName + "/?role=PRIMARY_AND_SECONDARY",
+			"routing_strategy": "round-robin",
+		}
+	}
+	return sections
+}
+
+// iniOption is an option of an ini file.
+type iniOption struct {
+	Section string
+	Name    string
+	Value   string
+}
+
+// iniOptions returns the options of an ini file in file order, quotes are removed from values.
+func iniOptions(cnf string) []iniOption {
+	var options []iniOption
+	section := ""
+	for _, line := range strings.Split(cnf, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			continue
+		}
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';' {
+			continue
+		}
+		name, value, _ := strings.Cut(trimmed, "=")
+		options = append(options, iniOption{
+			Section: section,
+			Name:    strings.TrimSpace(name),
+			Value:   strings.Trim(strings.TrimSpace(value), `"'`),
+		})
+	}
+	return options
+}
+
+// RouterBootstrapOptions returns the rendered router config as bootstrap options.
+func RouterBootstrapOptions(data map[string]string) string {
+	var args []string
+	for _, o := range iniOptions(data[RouterConfKey]) {
+		args = append(args, "--conf-set-option="+o.Section+"."+o.Name+"="+o.Value)
+	}
+	return strings.Join(args, " ")
+}
+
+// RouterPort returns the bind_port of a routing section of the rendered router config.
+func RouterPort(data map[string]string, section string, port int32) int32 {
+	for _, o := range iniOptions(data[RouterConfKey]) {
+		if o.Section == section && o.Name == "bind_port" {
+			if p, err := strconv.ParseInt(o.Value, 10, 32); err == nil {
+				port = int32(p)
+			}
+		}
+	}
+	return port
+}
+
+func cnfOption(key, value string) string {
+	if value == "" {
+		return key
+	}
+	return key + " = " + value
+}
+
+func MysqlConfigmap(ins *databasev1.Mysql, data map[string]string) *corev1.ConfigMap {
 
 	conf := &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
@@ -15,30 +270,25 @@ func MysqlConfigmap(ins *databasev1.Mysql) *corev1.ConfigMap {
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      ins.Name + "-mysql",
+			Name:      MysqlConfigName(ins),
 			Namespace: ins.Namespace,
 		},
-		Data: map[string]string{
-			"mysql.cnf":  mysqlcnf(ins),
-			"plugin.cnf": PluginConfdata,
-		},
+		Data: data,
 	}
 	return conf
 }
 
-func RouterConfigmap(ins *databasev1.Mysql) *corev1.ConfigMap {
+func RouterConfigmap(ins *databasev1.Mysql, data map[string]string) *corev1.ConfigMap {
 	conf := &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ConfigMap",
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      ins.Name + "-router",
+			Name:      RouterConfigName(ins),
 			Namespace: ins.Namespace,
 		},
-		Data: map[string]string{
-			"mysqlrouter.conf": RouterConf,
-		},
+		Data: data,
 	}
 	return conf
 }
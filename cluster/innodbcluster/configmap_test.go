@@ -0,0 +1,123 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+	"testing"
+)
+
+func TestMergeCnf(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cnf  string
+		conf databasev1.MysqlConf
+		want string
+	}{
+		{
+			name: "nothing to merge",
+			cnf:  "[mysqld]\nport=3306",
+			want: "[mysqld]\nport=3306\n",
+		},
+		{
+			name: "replaced in place",
+			cnf:  "[mysqld]\nmax_connections=100\nport=3306\n",
+			conf: databasev1.MysqlConf{"max_connections": "500"},
+			want: "[mysqld]\nmax_connections = 500\nport=3306\n",
+		},
+		{
+			name: "spelling of the template is kept",
+			cnf:  "[mysqld]\nloose-group_replication_flow_control_mode = QUOTA\n",
+			conf: databasev1.MysqlConf{"group-replication-flow-control-mode": "DISABLED"},
+			want: "[mysqld]\nloose-group_replication_flow_control_mode = DISABLED\n",
+		},
+		{
+			name: "added in key order after the section",
+			cnf:  "[mysqld]\nport=3306\n\n[client]\nuser=root\n",
+			conf: databasev1.MysqlConf{"sort_buffer_size": "1M", "max_connections": "500"},
+			want: "[mysqld]\nport=3306\nmax_connections = 500\nsort_buffer_size = 1M\n\n[client]\nuser=root\n",
+		},
+		{
+			name: "other sections are left alone",
+			cnf:  "[client]\nport=3306\n",
+			conf: databasev1.MysqlConf{"port": "3307"},
+			want: "[client]\nport=3306\n\n[mysqld]\nport = 3307\n",
+		},
+	} {
+		if got := mergeCnf(tc.cnf, "mysqld", tc.conf); got != tc.want {
+			t.Errorf("%s: mergeCnf = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMysqlConfigData(t *testing.T) {
+	template := map[string]string{
+		MysqlCnfKey:  "[mysqld]\nmax_connections=100\nssl_ca=/template/ca.pem\n",
+		PluginCnfKey: "[mysqld]\nloose-group_replication_flow_control_mode=QUOTA\nloose-group_replication_ssl_mode=REQUIRED\n",
+		InitSQLKey:   "SELECT 1;",
+	}
+	tlsDir := TLSMountPath + "/"
+	for _, tc := range []struct {
+		name string
+		edit func(ins *databasev1.Mysql)
+		want map[string]string
+	}{
+		{
+			name: "template",
+			want: template,
+		},
+		{
+			name: "spec over template",
+			edit: func(ins *databasev1.Mysql) {
+				ins.Spec.Mysql.MysqlConf = databasev1.MysqlConf{"max_connections": "500"}
+				ins.Spec.Mysql.PluginConf = databasev1.MysqlConf{"group_replication_flow_control_mode": "DISABLED"}
+			},
+			want: map[string]string{
+				MysqlCnfKey:  "[mysqld]\nmax_connections = 500\nssl_ca=/template/ca.pem\n",
+				PluginCnfKey: "[mysqld]\nloose-group_replication_flow_control_mode = DISABLED\nloose-group_replication_ssl_mode=REQUIRED\n",
+			},
+		},
+		{
+			name: "managed options over spec",
+			edit: func(ins *databasev1.Mysql) {
+				ins.Spec.TLS = &databasev1.TLS{}
+				ins.Spec.Mysql.GroupReplication.FlowControlMode = "QUOTA"
+				ins.Spec.Mysql.MysqlConf = databasev1.MysqlConf{"ssl_ca": "/spec/ca.pem"}
+				ins.Spec.Mysql.PluginConf = databasev1.MysqlConf{
+					"group_replication_flow_control_mode": "DISABLED",
+					"group_replication_ssl_mode":          "DISABLED",
+				}
+			},
+			want: map[string]string{
+				MysqlCnfKey: "[mysqld]\nmax_connections=100\nssl_ca = " + tlsDir + CACertKey + "\n" +
+					"ssl_cert = " + tlsDir + "tls.crt\nssl_key = " + tlsDir + "tls.key\n",
+				PluginCnfKey: "[mysqld]\nloose-group_replication_flow_control_mode = QUOTA\n" +
+					"loose-group_replication_ssl_mode = VERIFY_IDENTITY\n" +
+					"loose-group_replication_recovery_ssl_ca = " + tlsDir + CACertKey + "\n" +
+					"loose-group_replication_recovery_ssl_verify_server_cert = ON\n" +
+					"loose-group_replication_recovery_use_ssl = ON\n",
+			},
+		},
+	} {
+		ins := testMysql()
+		if tc.edit != nil {
+			tc.edit(ins)
+		}
+		got := MysqlConfigData(ins, template)
+		for _, key := range []string{MysqlCnfKey, PluginCnfKey} {
+			if got[key] != tc.want[key] {
+				t.Errorf("%s: %s = %q, want %q", tc.name, key, got[key], tc.want[key])
+			}
+		}
+		if got[InitSQLKey] != template[InitSQLKey] {
+			t.Errorf("%s: %s = %q, want the one of the template", tc.name, InitSQLKey, got[InitSQLKey])
+		}
+
+		// the options are maps, the rendered config and its hash must not depend on their order
+		for i := 0; i < 10; i++ {
+			again := MysqlConfigData(ins, template)
+			if ConfigHash(again) != ConfigHash(got) {
+				t.Errorf("%s: config is not deterministic: %q, %q", tc.name, again, got)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Client runs SQL on instances with the mysql command line client through an executor, in
+// the container of a member or in a job, so that the operator never connects to the
+// instances itself. Without an executor it connects to them directly.
+type Client struct {
+	// Path is the mysql binary.
+	Path     string
+	User     string
+	Password string
+	// Executor runs the mysql client, the instances are connected to directly if nil.
+	Executor Executor
+}
+
+// NewClient returns a client logging in as user.
+func NewClient(user, password string, executor Executor) *Client {
+	return &Client{Path: "mysql", User: user, Password: password, Executor: executor}
+}
+
+// clientError matches the error of the mysql client, e.g.
+// ERROR 1146 (42S02) at line 1: Table 'performance_schema.clone_status' doesn't exist
+var clientError = regexp.MustCompile(`ERROR ([0-9]+) \(([0-9A-Z]{5})\)(?: at line [0-9]+)?: (.*)`)
+
+// batchValue unescapes a value of the batch output of the mysql client.
+var batchValue = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\t`, "\t", `\0`, "\x00")
+
+// Query runs query on the instance at addr and returns the rows of its result, the values
+// as text and NULL as "NULL". The client runs where the executor runs the commands of via,
+// an instance that reaches addr, mostly addr itself.
+func (c *Client) Query(ctx context.Context, via, addr, query string) ([][]string, error) {
+	const op = "Query"
+	if c.Executor == nil {
+		rows, err := c.query(ctx, addr, query)
+		return rows, sqlError(op, addr, err)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, &Error{Op: op, Instance: addr, Reason: ReasonUnknown, Err: err}
+	}
+	// the password is passed on stdin so that it never shows up in the process list
+	command := []string{"sh", "-c", `IFS= read -r MYSQL_PWD && export MYSQL_PWD && exec "$@"`, "mysql",
+		c.Path, "--host=" + host, "--port=" + port, "--user=" + c.User, "--connect-timeout=5",
+		"--batch", "--skip-column-names", "--execute=" + query}
+	out, err := c.Executor.Exec(ctx, via, c.Password+"\n", command)
+	if err != nil {
+		var e *Error
+		if errors.As(err, &e) {
+			e.Op = op
+			return nil, e
+		}
+		code := 0
+		if m := clientError.FindStringSubmatch(err.Error()); m != nil {
+			code, _ = strconv.Atoi(m[1])
+			me := &mysql.MySQLError{Number: uint16(code), Message: m[3]}
+			copy(me.SQLState[:], m[2])
+			err = me
+		}
+		return nil, &Error{Op: op, Instance: addr, Reason: classify(code, err.Error()), Err: err}
+	}
+	return parseBatch(out), nil
+}
+
+// Exec runs stmts on the instance at addr, it stops at the first failing statement.
+func (c *Client) Exec(ctx context.Context, via, addr string, stmts ...string) error {
+	if c.Executor != nil {
+		_, err := c.Query(ctx, via, addr, strings.Join(stmts, ";\n"))
+		return err
+	}
+	db, err := openDB(c.User, c.Password, addr, 10*time.Second)
+	if err != nil {
+		return sqlError("Exec", addr, err)
+	}
+	defer db.Close()
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return sqlError("Exec", addr, err)
+		}
+	}
+	return nil
+}
+
+// query runs query over a connection of the operator.
+func (c *Client) query(ctx context.Context, addr, query string) ([][]string, error) {
+	db, err := openDB(c.User, c.Password, addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var result [][]string
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = v.String
+			if !v.Valid {
+				row[i] = "NULL"
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// parseBatch splits the batch output of the mysql client into rows of tab separated values.
+func parseBatch(out string) [][]string {
+	if out == "" {
+		return nil
+	}
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		row := strings.Split(line, "\t")
+		for i := range row {
+			row[i] = batchValue.Replace(row[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
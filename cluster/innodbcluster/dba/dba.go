@@ -0,0 +1,193 @@
+// Package dba manages innodb clusters. The operations are the ones of the mysqlsh
+// AdminAPI, they are implemented by running mysqlsh or directly over SQL.
+package dba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Manager manages an innodb cluster. Instances are addressed as host:port, an operation
+// on the cluster may be given any member, it finds the primary itself.
+type Manager interface {
+	// CreateCluster creates the cluster name with seed as its only member.
+	CreateCluster(ctx context.Context, seed string, name string, options Options) error
+	// AddInstance adds instance to the cluster of member, its data is cloned from a donor.
+	// It returns once the clone started, the instance restarts with the cloned data and
+	// recovers the missing transactions afterwards.
+	AddInstance(ctx context.Context, member string, instance string, options Options) error
+	// RemoveInstance removes instance from the cluster of member. force removes an
+	// instance that can not be reached.
+	RemoveInstance(ctx context.Context, member string, instance string, force bool) error
+	// RejoinInstance makes an instance that left the group join it again.
+	RejoinInstance(ctx context.Context, member string, instance string) error
+	// RebuildInstance replaces the data of instance with a clone of a member of the
+	// cluster, it is used when instance has transactions the group does not have.
+	RebuildInstance(ctx context.Context, member string, instance string) error
+	// SetPrimary makes instance the primary of the cluster of member.
+	SetPrimary(ctx context.Context, member string, instance string) error
+	// SetTopologyMode switches the cluster of member to multi-primary or single-primary mode.
+	SetTopologyMode(ctx context.Context, member string, multiPrimary bool) error
+	// SetOption changes an option of the cluster of member on all its members.
+	SetOption(ctx context.Context, member string, option string, value interface{}) error
+	// SetInstanceOption changes an option of instance in the cluster of member.
+	SetInstanceOption(ctx context.Context, member string, instance string, option string, value interface{}) error
+	// Status returns the cluster as seen by member.
+	Status(ctx context.Context, member string) (*ClusterStatus, error)
+	// RebootCluster restarts the group on seed after all members went offline. seed must
+	// hold the most advanced transaction set, the other members rejoin it afterwards.
+	RebootCluster(ctx context.Context, seed string) error
+	// Rescan registers the group members missing in the metadata and removes the instances
+	// of remove that are not in the group anymore. The other registered instances are left
+	// alone, an offline or restarting member keeps its registration.
+	Rescan(ctx context.Context, member string, remove []string) error
+}
+
+// Options are AdminAPI options, e.g. {"consistency": "BEFORE", "expelTimeout": 5}. Values
+// are strings, integers or booleans.
+type Options map[string]interface{}
+
+// AdminAPI options and the group replication variables they set.
+const (
+	OptionMultiPrimary       = "multiPrimary"
+	OptionAdoptFromGR        = "adoptFromGR"
+	OptionConsistency        = "consistency"
+	OptionExpelTimeout       = "expelTimeout"
+	OptionAutoRejoinTries    = "autoRejoinTries"
+	OptionExitStateAction    = "exitStateAction"
+	OptionMemberWeight       = "memberWeight"
+	OptionCommunicationStack = "communicationStack"
+	OptionIPAllowlist        = "ipAllowlist"
+	OptionMemberSSLMode      = "memberSslMode"
+)
+
+var optionVariables = map[string]string{
+	OptionConsistency:        "group_replication_consistency",
+	OptionExpelTimeout:       "group_replication_member_expel_timeout",
+	OptionAutoRejoinTries:    "group_replication_autorejoin_tries",
+	OptionExitStateAction:    "group_replication_exit_state_action",
+	OptionMemberWeight:       "group_replication_member_weight",
+	OptionCommunicationStack: "group_replication_communication_stack",
+	OptionIPAllowlist:        "group_replication_ip_allowlist",
+	OptionMemberSSLMode:      "group_replication_ssl_mode",
+}
+
+// ClusterStatus is the state of an innodb cluster.
+type ClusterStatus struct {
+	Name string
+	// Primary is the address of the primary, empty without one.
+	Primary string
+	Members []MemberStatus
+}
+
+// Member returns the status of the member at address.
+func (s *ClusterStatus) Member(address string) *MemberStatus {
+	for i := range s.Members {
+		if s.Members[i].Address == address {
+			return &s.Members[i]
+		}
+	}
+	return nil
+}
+
+// MemberStatus is the state of a cluster member.
+type MemberStatus struct {
+	Address string
+	// State is the group replication member state, MISSING if the instance is registered
+	// but not in the group.
+	State string
+	// Role is PRIMARY or SECONDARY.
+	Role string
+	// Registered reports whether the instance is in the cluster metadata.
+	Registered bool
+}
+
+const (
+	StateOnline     = "ONLINE"
+	StateRecovering = "RECOVERING"
+	StateOffline    = "OFFLINE"
+	StateError      = "ERROR"
+	StateMissing    = "MISSING"
+
+	RolePrimary   = "PRIMARY"
+	RoleSecondary = "SECONDARY"
+)
+
+// Reason classifies why an operation failed.
+type Reason string
+
+const (
+	// ReasonUnreachable means an instance could not be connected to.
+	ReasonUnreachable Reason = "Unreachable"
+	// ReasonNotInCluster means the instance is not a member of the cluster, or there is no cluster.
+	ReasonNotInCluster Reason = "NotInCluster"
+	// ReasonAlreadyInCluster means the instance is already a member of a cluster.
+	ReasonAlreadyInCluster Reason = "AlreadyInCluster"
+	// ReasonNoQuorum means the group lost its majority and blocks writes.
+	ReasonNoQuorum Reason = "NoQuorum"
+	// ReasonNoMetadata means the innodb cluster metadata schema is missing.
+	ReasonNoMetadata Reason = "NoMetadata"
+	// ReasonUnsupported means the backend does not implement the operation.
+	ReasonUnsupported Reason = "Unsupported"
+	// ReasonUnknown is any other failure.
+	ReasonUnknown Reason = "Unknown"
+)
+
+// Error is the error of a failed operation.
+type Error struct {
+	// Op is the operation, e.g. AddInstance.
+	Op string
+	// Instance is the address the operation was run on.
+	Instance string
+	Reason   Reason
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s failed (%s): %v", e.Op, e.Instance, e.Reason, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ReasonOf returns the reason of err, ReasonUnknown if it is not an *Error.
+func ReasonOf(err error) Reason {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Reason
+	}
+	return ReasonUnknown
+}
+
+// IsReason reports whether err failed for reason.
+func IsReason(err error, reason Reason) bool {
+	return err != nil && ReasonOf(err) == reason
+}
+
+// unreachableCodes are the client errors of a server that can not be connected to.
+var unreachableCodes = map[int]bool{2002: true, 2003: true, 2005: true, 2006: true, 2013: true}
+
+// classify derives the reason from a mysql error number, 0 if unknown, and the message.
+func classify(code int, message string) Reason {
+	msg := strings.ToLower(message)
+	switch {
+	case unreachableCodes[code] || strings.Contains(msg, "can't connect") ||
+		strings.Contains(msg, "unknown mysql server host") || strings.Contains(msg, "connection refused"):
+		return ReasonUnreachable
+	case code == 3093 || strings.Contains(msg, "quorum"):
+		return ReasonNoQuorum
+	case code == 1049 || code == 1146 || strings.Contains(msg, "metadata") &&
+		(strings.Contains(msg, "not found") || strings.Contains(msg, "doesn't exist") || strings.Contains(msg, "does not exist")):
+		return ReasonNoMetadata
+	case strings.Contains(msg, "already part of") || strings.Contains(msg, "already a member") ||
+		strings.Contains(msg, "already belongs") || strings.Contains(msg, "already in an innodb cluster"):
+		return ReasonAlreadyInCluster
+	case strings.Contains(msg, "does not belong to") || strings.Contains(msg, "not a member") ||
+		strings.Contains(msg, "not part of") || strings.Contains(msg, "standalone instance"):
+		return ReasonNotInCluster
+	}
+	return ReasonUnknown
+}
@@ -0,0 +1,180 @@
+package dba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		code    int
+		message string
+		want    Reason
+	}{
+		{2003, "Can't connect to MySQL server on 'mysql-0:3306' (111)", ReasonUnreachable},
+		{0, "Dba.getCluster: MySQL Error 2005: Unknown MySQL server host 'mysql-3'", ReasonUnreachable},
+		{0, "Cluster.addInstance: The instance 'mysql-1:3306' is already part of this InnoDB cluster", ReasonAlreadyInCluster},
+		{0, "Cluster.removeInstance: The instance 'mysql-2:3306' does not belong to the cluster", ReasonNotInCluster},
+		{0, "Dba.getCluster: This function is not available through a session to a standalone instance", ReasonNotInCluster},
+		{0, "Cluster.status: There is no quorum to perform the operation", ReasonNoQuorum},
+		{1049, "Unknown database 'mysql_innodb_cluster_metadata'", ReasonNoMetadata},
+		{1045, "Access denied for user 'root'", ReasonUnknown},
+	} {
+		if got := classify(tc.code, tc.message); got != tc.want {
+			t.Errorf("classify(%d, %q) = %s, want %s", tc.code, tc.message, got, tc.want)
+		}
+	}
+}
+
+func TestReasonOf(t *testing.T) {
+	err := fmt.Errorf("failed to add instance: %w", &Error{Op: "AddInstance", Reason: ReasonAlreadyInCluster, Err: errors.New("x")})
+	if !IsReason(err, ReasonAlreadyInCluster) {
+		t.Errorf("wrapped reason is %s", ReasonOf(err))
+	}
+	if IsReason(nil, ReasonUnknown) || ReasonOf(errors.New("x")) != ReasonUnknown {
+		t.Errorf("plain errors must be unknown")
+	}
+}
+
+func TestLastJSONLine(t *testing.T) {
+	out := "WARNING: Using a password on the command line interface can be insecure.\n{\"clusterName\":\"mgr\"}\n"
+	if got := lastJSONLine(out); got != `{"clusterName":"mgr"}` {
+		t.Errorf("lastJSONLine = %q", got)
+	}
+}
+
+func TestClusterStatus(t *testing.T) {
+	members := []groupMember{
+		{uuid: "b", address: "mysql-1:3306", state: StateOnline, role: RoleSecondary},
+		{uuid: "a", address: "mysql-0:3306", state: StateOnline, role: RolePrimary},
+		{uuid: "d", address: "mysql-3:3306", state: StateRecovering, role: RoleSecondary},
+	}
+	registered := []registeredInstance{
+		{address: "mysql-0:3306", uuid: "a"},
+		{address: "mysql-1:3306", uuid: "b"},
+		{address: "mysql-2:3306", uuid: "c"},
+	}
+	want := &ClusterStatus{
+		Name:    "mgr",
+		Primary: "mysql-0:3306",
+		Members: []MemberStatus{
+			{Address: "mysql-0:3306", State: StateOnline, Role: RolePrimary, Registered: true},
+			{Address: "mysql-1:3306", State: StateOnline, Role: RoleSecondary, Registered: true},
+			{Address: "mysql-2:3306", State: StateMissing, Registered: true},
+			{Address: "mysql-3:3306", State: StateRecovering, Role: RoleSecondary},
+		},
+	}
+	if got := clusterStatus("mgr", members, registered); !reflect.DeepEqual(got, want) {
+		t.Errorf("clusterStatus = %+v, want %+v", got, want)
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	classic, x, gr, err := endpoints("mysql-0.mysql.default.svc.cluster.local:3306")
+	if err != nil || classic != "mysql-0.mysql.default.svc.cluster.local:3306" ||
+		x != "mysql-0.mysql.default.svc.cluster.local:33060" || gr != "mysql-0.mysql.default.svc.cluster.local:33061" {
+		t.Errorf("endpoints = %s %s %s %v", classic, x, gr, err)
+	}
+	if got := Quote(`it's \ here`); got != `'it\'s \\ here'` {
+		t.Errorf("Quote = %s", got)
+	}
+}
+
+type recordingExecutor struct {
+	command []string
+	out     string
+	err     error
+}
+
+func (e *recordingExecutor) Exec(_ context.Context, _ string, _ string, command []string) (string, error) {
+	e.command = command
+	return e.out, e.err
+}
+
+func TestShellAddInstance(t *testing.T) {
+	executor := &recordingExecutor{}
+	shell := NewShell("root", "secret", executor)
+	if err := shell.AddInstance(context.Background(), "mysql-0:3306", "mysql-3:3306", Options{OptionMemberWeight: 50}); err != nil {
+		t.Fatal(err)
+	}
+	want := `dba.getCluster().addInstance("mysql-3:3306", {"memberWeight":50,"recoveryMethod":"clone","recoveryProgress":0})`
+	if got := executor.command[len(executor.command)-1]; got != want {
+		t.Errorf("script = %s, want %s", got, want)
+	}
+}
+
+func TestClientQuery(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		out    string
+		err    error
+		want   [][]string
+		reason Reason
+		number uint16
+	}{
+		{name: "no rows"},
+		{
+			name: "rows",
+			out:  "ONLINE\tPRIMARY\t0\nOFFLINE\t\tNULL\n",
+			want: [][]string{{"ONLINE", "PRIMARY", "0"}, {"OFFLINE", "", "NULL"}},
+		},
+		{
+			name: "escaped values",
+			out:  "a\\tb\\nc\\\\\n",
+			want: [][]string{{"a\tb\nc\\"}},
+		},
+		{
+			name:   "server error",
+			err:    fmt.Errorf("command terminated: ERROR 1146 (42S02) at line 1: Table 'x' doesn't exist"),
+			reason: ReasonNoMetadata,
+			number: 1146,
+		},
+		{
+			name:   "unreachable",
+			err:    fmt.Errorf("command terminated: ERROR 2003 (HY000): Can't connect to MySQL server on 'mysql-1:3306' (111)"),
+			reason: ReasonUnreachable,
+		},
+	} {
+		executor := &recordingExecutor{out: tc.out, err: tc.err}
+		rows, err := NewClient("root", "secret", executor).Query(context.Background(), "mysql-0", "mysql-1:3306", "SELECT 1")
+		if tc.err == nil {
+			if err != nil || !reflect.DeepEqual(rows, tc.want) {
+				t.Errorf("%s: Query = %q, %v, want %q", tc.name, rows, err, tc.want)
+			}
+			continue
+		}
+		if got := ReasonOf(err); got != tc.reason {
+			t.Errorf("%s: reason = %s, want %s: %v", tc.name, got, tc.reason, err)
+		}
+		var me *mysql.MySQLError
+		if tc.number != 0 && (!errors.As(err, &me) || me.Number != tc.number) {
+			t.Errorf("%s: error %v is not mysql error %d", tc.name, err, tc.number)
+		}
+	}
+}
+
+func TestShellRescan(t *testing.T) {
+	for _, tc := range []struct {
+		remove []string
+		want   string
+	}{
+		{want: `dba.getCluster().rescan({"addInstances":"auto","removeInstances":[]})`},
+		{
+			remove: []string{"mysql-3:3306"},
+			want:   `dba.getCluster().rescan({"addInstances":"auto","removeInstances":["mysql-3:3306"]})`,
+		},
+	} {
+		executor := &recordingExecutor{}
+		if err := NewShell("root", "secret", executor).Rescan(context.Background(), "mysql-0:3306", tc.remove); err != nil {
+			t.Fatal(err)
+		}
+		if got := executor.command[len(executor.command)-1]; got != tc.want {
+			t.Errorf("script = %s, want %s", got, tc.want)
+		}
+	}
+}
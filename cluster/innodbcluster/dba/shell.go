@@ -0,0 +1,240 @@
+package dba
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// shellTimeout bounds a single mysqlsh call, so that a reconcile never blocks for long.
+const shellTimeout = 2 * time.Minute
+
+// Executor runs a command for an instance and returns its stdout. The error of a failed
+// command carries its stderr. host is the address the command connects to, an executor
+// may use it to decide where the command runs.
+type Executor interface {
+	Exec(ctx context.Context, host string, stdin string, command []string) (string, error)
+}
+
+// LocalExecutor runs commands as processes of the operator.
+type LocalExecutor struct{}
+
+func (LocalExecutor) Exec(ctx context.Context, host string, stdin string, command []string) (string, error) {
+	c := exec.CommandContext(ctx, command[0], command[1:]...)
+	var stdout, stderr bytes.Buffer
+	c.Stdin = strings.NewReader(stdin)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return stdout.String(), fmt.Errorf("%s", message)
+		}
+		return stdout.String(), err
+	}
+	return stdout.String(), nil
+}
+
+// Shell runs the AdminAPI of mysqlsh. Results are printed as JSON, the password is
+// passed on stdin so that it never shows up in the process list.
+type Shell struct {
+	// Path is the mysqlsh binary.
+	Path     string
+	User     string
+	Password string
+	// Executor runs mysqlsh, locally if nil.
+	Executor Executor
+}
+
+var _ Manager = &Shell{}
+
+// NewShell returns a mysqlsh backend logging in as user.
+func NewShell(user, password string, executor Executor) *Shell {
+	return &Shell{Path: "/usr/bin/mysqlsh", User: user, Password: password, Executor: executor}
+}
+
+var shellErrorCode = regexp.MustCompile(`MySQL Error ([0-9]+)`)
+
+// run executes a javascript snippet connected to host and returns its stdout.
+func (s *Shell) run(ctx context.Context, op, host, script string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, shellTimeout)
+	defer cancel()
+
+	executor := s.Executor
+	if executor == nil {
+		executor = LocalExecutor{}
+	}
+	command := []string{s.Path, "--passwords-from-stdin", "--no-wizard", "--js", "--result-format=json",
+		"--uri", s.User + "@" + host, "-e", script}
+	log.Log.Info("exec mysqlsh", "host", host, "script", script)
+	out, err := executor.Exec(ctx, host, s.Password+"\n", command)
+	if err != nil {
+		var e *Error
+		if errors.As(err, &e) {
+			e.Op = op
+			return "", e
+		}
+		code := 0
+		if m := shellErrorCode.FindStringSubmatch(err.Error()); m != nil {
+			code, _ = strconv.Atoi(m[1])
+		}
+		return "", &Error{Op: op, Instance: host, Reason: classify(code, err.Error()), Err: err}
+	}
+	return out, nil
+}
+
+// jsString quotes s as a javascript string literal.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// jsOptions renders options as a javascript object, merged with extra.
+func jsOptions(options Options, extra Options) string {
+	merged := Options{}
+	for k, v := range options {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	b, _ := json.Marshal(merged)
+	return string(b)
+}
+
+func (s *Shell) CreateCluster(ctx context.Context, seed string, name string, options Options) error {
+	var extra Options
+	if options[OptionMultiPrimary] == true {
+		// force confirms the multi-primary warning, there is no prompt with --no-wizard
+		extra = Options{"force": true}
+	}
+	_, err := s.run(ctx, "CreateCluster", seed, "dba.createCluster("+jsString(name)+", "+jsOptions(options, extra)+")")
+	return err
+}
+
+func (s *Shell) AddInstance(ctx context.Context, member string, instance string, options Options) error {
+	// recoveryProgress 0 returns once the clone started, a clone outlasts shellTimeout
+	_, err := s.run(ctx, "AddInstance", member,
+		"dba.getCluster().addInstance("+jsString(instance)+", "+jsOptions(options, Options{"recoveryMethod": "clone", "recoveryProgress": 0})+")")
+	return err
+}
+
+func (s *Shell) RemoveInstance(ctx context.Context, member string, instance string, force bool) error {
+	_, err := s.run(ctx, "RemoveInstance", member,
+		"dba.getCluster().removeInstance("+jsString(instance)+", {force: "+strconv.FormatBool(force)+"})")
+	return err
+}
+
+func (s *Shell) RejoinInstance(ctx context.Context, member string, instance string) error {
+	_, err := s.run(ctx, "RejoinInstance", member, "dba.getCluster().rejoinInstance("+jsString(instance)+")")
+	return err
+}
+
+func (s *Shell) RebuildInstance(ctx context.Context, member string, instance string) error {
+	if err := s.RemoveInstance(ctx, member, instance, true); err != nil && !IsReason(err, ReasonNotInCluster) {
+		return err
+	}
+	return s.AddInstance(ctx, member, instance, nil)
+}
+
+func (s *Shell) SetPrimary(ctx context.Context, member string, instance string) error {
+	_, err := s.run(ctx, "SetPrimary", member, "dba.getCluster().setPrimaryInstance("+jsString(instance)+")")
+	return err
+}
+
+func (s *Shell) SetOption(ctx context.Context, member string, option string, value interface{}) error {
+	v, _ := json.Marshal(value)
+	_, err := s.run(ctx, "SetOption", member, "dba.getCluster().setOption("+jsString(option)+", "+string(v)+")")
+	return err
+}
+
+func (s *Shell) SetInstanceOption(ctx context.Context, member string, instance string, option string, value interface{}) error {
+	v, _ := json.Marshal(value)
+	_, err := s.run(ctx, "SetInstanceOption", member,
+		"dba.getCluster().setInstanceOption("+jsString(instance)+", "+jsString(option)+", "+string(v)+")")
+	return err
+}
+
+func (s *Shell) SetTopologyMode(ctx context.Context, member string, multiPrimary bool) error {
+	script := "dba.getCluster().switchToSinglePrimaryMode()"
+	if multiPrimary {
+		script = "dba.getCluster().switchToMultiPrimaryMode()"
+	}
+	_, err := s.run(ctx, "SetTopologyMode", member, script)
+	return err
+}
+
+func (s *Shell) RebootCluster(ctx context.Context, seed string) error {
+	_, err := s.run(ctx, "RebootCluster", seed, "dba.rebootClusterFromCompleteOutage()")
+	return err
+}
+
+func (s *Shell) Rescan(ctx context.Context, member string, remove []string) error {
+	if remove == nil {
+		remove = []string{}
+	}
+	_, err := s.run(ctx, "Rescan", member,
+		"dba.getCluster().rescan("+jsOptions(Options{"addInstances": "auto", "removeInstances": remove}, nil)+")")
+	return err
+}
+
+// shellStatus is the part of cluster.status() that is used.
+type shellStatus struct {
+	ClusterName       string `json:"clusterName"`
+	DefaultReplicaSet struct {
+		Primary  string `json:"primary"`
+		Topology map[string]struct {
+			Address    string `json:"address"`
+			MemberRole string `json:"memberRole"`
+			Status     string `json:"status"`
+		} `json:"topology"`
+	} `json:"defaultReplicaSet"`
+}
+
+func (s *Shell) Status(ctx context.Context, member string) (*ClusterStatus, error) {
+	out, err := s.run(ctx, "Status", member, "print(JSON.stringify(dba.getCluster().status()))")
+	if err != nil {
+		return nil, err
+	}
+	raw := lastJSONLine(out)
+	var st shellStatus
+	if err := json.Unmarshal([]byte(raw), &st); err != nil {
+		return nil, &Error{Op: "Status", Instance: member, Reason: ReasonUnknown, Err: fmt.Errorf("failed to parse status %q: %w", raw, err)}
+	}
+
+	status := &ClusterStatus{Name: st.ClusterName, Primary: st.DefaultReplicaSet.Primary}
+	for address, m := range st.DefaultReplicaSet.Topology {
+		if m.Address != "" {
+			address = m.Address
+		}
+		status.Members = append(status.Members, MemberStatus{
+			Address:    address,
+			State:      strings.Trim(m.Status, "()"),
+			Role:       m.MemberRole,
+			Registered: true,
+		})
+	}
+	sortMembers(status.Members)
+	return status, nil
+}
+
+// lastJSONLine returns the last line of out that is a JSON object, mysqlsh may print
+// warnings before it.
+func lastJSONLine(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "{") && json.Valid([]byte(line)) {
+			return line
+		}
+	}
+	return out
+}
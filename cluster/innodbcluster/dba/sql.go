@@ -0,0 +1,753 @@
+package dba
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// SQL manages the cluster with group replication statements and functions over plain
+// connections from the operator, and keeps the mysql_innodb_cluster_metadata schema in
+// sync with the group.
+// The metadata schema can only be deployed by mysqlsh, so CreateCluster is delegated to
+// Bootstrap.
+type SQL struct {
+	User     string
+	Password string
+	// Bootstrap creates the cluster, CreateCluster is unsupported without it.
+	Bootstrap Manager
+}
+
+var _ Manager = &SQL{}
+
+// NewSQL returns a SQL backend logging in as user, user is also the recovery account
+// of the members.
+func NewSQL(user, password string, bootstrap Manager) *SQL {
+	return &SQL{User: user, Password: password, Bootstrap: bootstrap}
+}
+
+func (s *SQL) open(host string) (*sql.DB, error) {
+	// START GROUP_REPLICATION waits for the member to join
+	return openDB(s.User, s.Password, host, time.Minute)
+}
+
+// openDB opens a connection pool to the instance at addr.
+func openDB(user, password, addr string, readTimeout time.Duration) (*sql.DB, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = user
+	cfg.Passwd = password
+	cfg.Net = "tcp"
+	cfg.Addr = addr
+	cfg.Timeout = 5 * time.Second
+	cfg.ReadTimeout = readTimeout
+	return sql.Open("mysql", cfg.FormatDSN())
+}
+
+// sqlError wraps the error of op on host in an *Error.
+func sqlError(op, host string, err error) error {
+	var e *Error
+	if err == nil || errors.As(err, &e) {
+		return err
+	}
+	code := 0
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		code = int(me.Number)
+	}
+	reason := classify(code, err.Error())
+	var ne net.Error
+	if reason == ReasonUnknown && code == 0 &&
+		(errors.As(err, &ne) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn)) {
+		reason = ReasonUnreachable
+	}
+	return &Error{Op: op, Instance: host, Reason: reason, Err: err}
+}
+
+// Quote quotes v as a string literal, for the statements that can not be prepared.
+func Quote(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return "'" + strings.ReplaceAll(v, "'", `\'`) + "'"
+}
+
+// endpoints returns the classic, X protocol and group replication addresses of an
+// instance, with the default ports of mysqlsh.
+func endpoints(address string) (classic, x, gr string, err error) {
+	host, p, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", "", "", err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return "", "", "", err
+	}
+	return address, net.JoinHostPort(host, strconv.Itoa(port*10)), net.JoinHostPort(host, strconv.Itoa(port*10+1)), nil
+}
+
+type groupMember struct {
+	uuid    string
+	address string
+	state   string
+	role    string
+}
+
+// groupMembers returns the members of the group as seen by db. A member that is not in a
+// group only sees itself.
+func groupMembers(ctx context.Context, db *sql.DB) ([]groupMember, error) {
+	rows, err := db.QueryContext(ctx, `SELECT MEMBER_ID, MEMBER_HOST, MEMBER_PORT, MEMBER_STATE, MEMBER_ROLE
+FROM performance_schema.replication_group_members WHERE MEMBER_ID <> ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []groupMember
+	for rows.Next() {
+		var m groupMember
+		var host string
+		var port sql.NullInt64
+		if err := rows.Scan(&m.uuid, &host, &port, &m.state, &m.role); err != nil {
+			return nil, err
+		}
+		if !port.Valid {
+			port.Int64 = 3306
+		}
+		m.address = net.JoinHostPort(host, strconv.FormatInt(port.Int64, 10))
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// localState returns the server uuid and the group replication state of db.
+func localState(ctx context.Context, db *sql.DB) (string, string, error) {
+	var uuid string
+	var state sql.NullString
+	err := db.QueryRowContext(ctx, `SELECT @@server_uuid, (SELECT MEMBER_STATE
+FROM performance_schema.replication_group_members WHERE MEMBER_ID = @@server_uuid)`).Scan(&uuid, &state)
+	if !state.Valid {
+		state.String = StateOffline
+	}
+	return uuid, state.String, err
+}
+
+// primary returns the address of an online primary of the group of member, other than
+// except if the group is in multi-primary mode.
+func (s *SQL) primary(ctx context.Context, op, member, except string) (string, error) {
+	db, err := s.open(member)
+	if err != nil {
+		return "", sqlError(op, member, err)
+	}
+	defer db.Close()
+
+	members, err := groupMembers(ctx, db)
+	if err != nil {
+		return "", sqlError(op, member, err)
+	}
+	online := 0
+	for _, m := range members {
+		if m.state == StateOnline {
+			online++
+		}
+	}
+	found := ""
+	for _, m := range members {
+		if m.role == RolePrimary && m.state == StateOnline && (found == "" || found == except) {
+			found = m.address
+		}
+	}
+	if found != "" {
+		return found, nil
+	}
+	if online == 0 {
+		return "", &Error{Op: op, Instance: member, Reason: ReasonNotInCluster, Err: fmt.Errorf("member is not online in a group")}
+	}
+	return "", &Error{Op: op, Instance: member, Reason: ReasonNoQuorum, Err: fmt.Errorf("group has no online primary")}
+}
+
+type registeredInstance struct {
+	address string
+	uuid    string
+}
+
+// metadata returns the cluster id, name and instances from the metadata schema.
+func metadata(ctx context.Context, db *sql.DB) (string, string, []registeredInstance, error) {
+	var id, name string
+	if err := db.QueryRowContext(ctx, "SELECT cluster_id, cluster_name FROM mysql_innodb_cluster_metadata.clusters LIMIT 1").Scan(&id, &name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", nil, fmt.Errorf("no cluster in the metadata")
+		}
+		return "", "", nil, err
+	}
+	rows, err := db.QueryContext(ctx, "SELECT address, mysql_server_uuid FROM mysql_innodb_cluster_metadata.instances WHERE cluster_id = ?", id)
+	if err != nil {
+		return "", "", nil, err
+	}
+	defer rows.Close()
+
+	var instances []registeredInstance
+	for rows.Next() {
+		var i registeredInstance
+		if err := rows.Scan(&i.address, &i.uuid); err != nil {
+			return "", "", nil, err
+		}
+		instances = append(instances, i)
+	}
+	return id, name, instances, rows.Err()
+}
+
+// register adds an instance to the metadata the way mysqlsh does, if it is missing.
+func register(ctx context.Context, db *sql.DB, clusterID, address, uuid string) error {
+	classic, x, gr, err := endpoints(address)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO mysql_innodb_cluster_metadata.instances
+(cluster_id, address, mysql_server_uuid, instance_name, addresses, attributes)
+SELECT ?, ?, ?, ?, JSON_OBJECT('mysqlClassic', ?, 'mysqlX', ?, 'grLocal', ?), JSON_OBJECT() FROM DUAL
+WHERE NOT EXISTS (SELECT 1 FROM mysql_innodb_cluster_metadata.instances WHERE address = ?)`,
+		clusterID, address, uuid, address, classic, x, gr, address)
+	return err
+}
+
+func (s *SQL) CreateCluster(ctx context.Context, seed string, name string, options Options) error {
+	if s.Bootstrap == nil {
+		return &Error{Op: "CreateCluster", Instance: seed, Reason: ReasonUnsupported,
+			Err: fmt.Errorf("the metadata schema can only be created by mysqlsh")}
+	}
+	return s.Bootstrap.CreateCluster(ctx, seed, name, options)
+}
+
+// sqlValue renders an option value as the value of a SET statement.
+func sqlValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return Quote(v)
+	case bool:
+		if v {
+			return "ON"
+		}
+		return "OFF"
+	}
+	return fmt.Sprint(v)
+}
+
+// optionStatements returns the statements persisting options on an instance.
+func optionStatements(op, instance string, options Options) ([]string, error) {
+	var names []string
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var stmts []string
+	for _, name := range names {
+		variable, ok := optionVariables[name]
+		if !ok {
+			return nil, &Error{Op: op, Instance: instance, Reason: ReasonUnsupported, Err: fmt.Errorf("unknown option %s", name)}
+		}
+		stmts = append(stmts, "SET PERSIST "+variable+" = "+sqlValue(options[name]))
+	}
+	return stmts, nil
+}
+
+// AddInstance adds instance with the group wide settings of the primary, the communication
+// stack, consistency and expel timeout, and options on top of them.
+func (s *SQL) AddInstance(ctx context.Context, member string, instance string, options Options) error {
+	const op = "AddInstance"
+	primary, err := s.primary(ctx, op, member, instance)
+	if err != nil {
+		return err
+	}
+	pdb, err := s.open(primary)
+	if err != nil {
+		return sqlError(op, primary, err)
+	}
+	defer pdb.Close()
+
+	var groupName, stack, consistency string
+	var expelTimeout int
+	if err := pdb.QueryRowContext(ctx, `SELECT @@GLOBAL.group_replication_group_name,
+@@GLOBAL.group_replication_communication_stack, @@GLOBAL.group_replication_consistency,
+@@GLOBAL.group_replication_member_expel_timeout`).Scan(&groupName, &stack, &consistency, &expelTimeout); err != nil {
+		return sqlError(op, primary, err)
+	}
+	clusterID, _, registered, err := metadata(ctx, pdb)
+	if err != nil {
+		return sqlError(op, primary, err)
+	}
+	// the MYSQL communication stack runs over the classic port
+	var seeds []string
+	for _, i := range registered {
+		if classic, _, gr, err := endpoints(i.address); err == nil && i.address != instance {
+			if stack == "MYSQL" {
+				gr = classic
+			}
+			seeds = append(seeds, gr)
+		}
+	}
+	classic, _, local, err := endpoints(instance)
+	if err != nil {
+		return &Error{Op: op, Instance: instance, Reason: ReasonUnknown, Err: err}
+	}
+	if stack == "MYSQL" {
+		local = classic
+	}
+	settings := Options{OptionCommunicationStack: stack, OptionConsistency: consistency, OptionExpelTimeout: expelTimeout}
+	for k, v := range options {
+		settings[k] = v
+	}
+	optionStmts, err := optionStatements(op, instance, settings)
+	if err != nil {
+		return err
+	}
+
+	idb, err := s.open(instance)
+	if err != nil {
+		return sqlError(op, instance, err)
+	}
+	defer idb.Close()
+	uuid, state, err := localState(ctx, idb)
+	if err != nil {
+		return sqlError(op, instance, err)
+	}
+	if state == StateOnline || state == StateRecovering {
+		return &Error{Op: op, Instance: instance, Reason: ReasonAlreadyInCluster, Err: fmt.Errorf("member state is %s", state)}
+	}
+
+	// the data is always cloned from a donor, the joiner restarts after the clone and
+	// joins on boot with the persisted settings
+	log.Log.Info("add instance to group", "primary", primary, "instance", instance)
+	for _, stmt := range append(optionStmts,
+		"SET PERSIST group_replication_group_name = "+Quote(groupName),
+		"SET PERSIST group_replication_local_address = "+Quote(local),
+		"SET PERSIST group_replication_group_seeds = "+Quote(strings.Join(seeds, ",")),
+		"SET PERSIST group_replication_start_on_boot = ON",
+		"SET GLOBAL group_replication_clone_threshold = 1",
+		"CHANGE MASTER TO MASTER_USER = "+Quote(s.User)+", MASTER_PASSWORD = "+Quote(s.Password)+
+			" FOR CHANNEL 'group_replication_recovery'",
+		"START GROUP_REPLICATION",
+	) {
+		if _, err := idb.ExecContext(ctx, stmt); err != nil {
+			return sqlError(op, instance, err)
+		}
+	}
+
+	if err := register(ctx, pdb, clusterID, instance, uuid); err != nil {
+		return sqlError(op, primary, err)
+	}
+	return nil
+}
+
+func (s *SQL) RemoveInstance(ctx context.Context, member string, instance string, force bool) error {
+	const op = "RemoveInstance"
+	primary, err := s.primary(ctx, op, member, instance)
+	if err != nil {
+		return err
+	}
+	if primary == instance {
+		return &Error{Op: op, Instance: instance, Reason: ReasonUnknown, Err: fmt.Errorf("the primary can not be removed, set another primary first")}
+	}
+
+	idb, err := s.open(instance)
+	if err == nil {
+		defer idb.Close()
+		for _, stmt := range []string{
+			"STOP GROUP_REPLICATION",
+			"SET PERSIST group_replication_start_on_boot = OFF",
+		} {
+			if _, err = idb.ExecContext(ctx, stmt); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		if err := sqlError(op, instance, err); !force || !IsReason(err, ReasonUnreachable) {
+			return err
+		}
+		log.Log.Info("remove unreachable instance", "instance", instance)
+	}
+
+	pdb, err := s.open(primary)
+	if err != nil {
+		return sqlError(op, primary, err)
+	}
+	defer pdb.Close()
+	if _, err := pdb.ExecContext(ctx, "DELETE FROM mysql_innodb_cluster_metadata.instances WHERE address = ?", instance); err != nil {
+		return sqlError(op, primary, err)
+	}
+	return nil
+}
+
+func (s *SQL) RejoinInstance(ctx context.Context, member string, instance string) error {
+	const op = "RejoinInstance"
+	if _, err := s.primary(ctx, op, member, instance); err != nil {
+		return err
+	}
+
+	idb, err := s.open(instance)
+	if err != nil {
+		return sqlError(op, instance, err)
+	}
+	defer idb.Close()
+	_, state, err := localState(ctx, idb)
+	if err != nil {
+		return sqlError(op, instance, err)
+	}
+	if state == StateOnline || state == StateRecovering {
+		return nil
+	}
+	var groupName string
+	if err := idb.QueryRowContext(ctx, "SELECT @@GLOBAL.group_replication_group_name").Scan(&groupName); err != nil {
+		return sqlError(op, instance, err)
+	}
+	if groupName == "" {
+		return &Error{Op: op, Instance: instance, Reason: ReasonNotInCluster, Err: fmt.Errorf("instance was never added to a group")}
+	}
+	if state == StateError {
+		if _, err := idb.ExecContext(ctx, "STOP GROUP_REPLICATION"); err != nil {
+			return sqlError(op, instance, err)
+		}
+	}
+	log.Log.Info("rejoin instance to group", "instance", instance)
+	if _, err := idb.ExecContext(ctx, "START GROUP_REPLICATION"); err != nil {
+		return sqlError(op, instance, err)
+	}
+	return nil
+}
+
+// cloneRestartCodes are the errors of a clone that succeeded but could not restart the
+// server, it is restarted by kubernetes then.
+var cloneRestartCodes = map[uint16]bool{3707: true}
+
+// RebuildInstance removes instance from the cluster and clones the primary into it. The
+// instance restarts with the cloned data and is added back like a new member.
+func (s *SQL) RebuildInstance(ctx context.Context, member string, instance string) error {
+	const op = "RebuildInstance"
+	primary, err := s.primary(ctx, op, member, instance)
+	if err != nil {
+		return err
+	}
+	if primary == instance {
+		return &Error{Op: op, Instance: instance, Reason: ReasonUnknown, Err: fmt.Errorf("the primary can not be rebuilt")}
+	}
+	if err := s.RemoveInstance(ctx, primary, instance, false); err != nil && !IsReason(err, ReasonNotInCluster) {
+		return err
+	}
+	host, port, err := net.SplitHostPort(primary)
+	if err != nil {
+		return &Error{Op: op, Instance: primary, Reason: ReasonUnknown, Err: err}
+	}
+
+	idb, err := s.open(instance)
+	if err != nil {
+		return sqlError(op, instance, err)
+	}
+	defer idb.Close()
+
+	log.Log.Info("clone instance", "donor", primary, "instance", instance)
+	if _, err := idb.ExecContext(ctx, "SET GLOBAL clone_valid_donor_list = "+Quote(primary)); err != nil {
+		return sqlError(op, instance, err)
+	}
+	_, err = idb.ExecContext(ctx, "CLONE INSTANCE FROM "+Quote(s.User)+"@"+Quote(host)+":"+port+
+		" IDENTIFIED BY "+Quote(s.Password))
+	var me *mysql.MySQLError
+	switch {
+	case err == nil:
+	case errors.As(err, &me) && cloneRestartCodes[me.Number]:
+	case errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn):
+		// the server restarted after the clone
+	default:
+		return sqlError(op, instance, err)
+	}
+	return nil
+}
+
+func (s *SQL) SetPrimary(ctx context.Context, member string, instance string) error {
+	const op = "SetPrimary"
+	db, err := s.open(member)
+	if err != nil {
+		return sqlError(op, member, err)
+	}
+	defer db.Close()
+
+	members, err := groupMembers(ctx, db)
+	if err != nil {
+		return sqlError(op, member, err)
+	}
+	for _, m := range members {
+		if m.address != instance {
+			continue
+		}
+		if m.state != StateOnline {
+			return &Error{Op: op, Instance: instance, Reason: ReasonNotInCluster, Err: fmt.Errorf("member state is %s", m.state)}
+		}
+		if m.role == RolePrimary {
+			return nil
+		}
+		log.Log.Info("set primary", "instance", instance)
+		if _, err := db.ExecContext(ctx, "SELECT group_replication_set_as_primary(?)", m.uuid); err != nil {
+			return sqlError(op, member, err)
+		}
+		return nil
+	}
+	return &Error{Op: op, Instance: instance, Reason: ReasonNotInCluster, Err: fmt.Errorf("instance is not in the group")}
+}
+
+// SetOption persists the variable of option on every online member.
+func (s *SQL) SetOption(ctx context.Context, member string, option string, value interface{}) error {
+	const op = "SetOption"
+	if option == OptionCommunicationStack {
+		return &Error{Op: op, Instance: member, Reason: ReasonUnsupported, Err: fmt.Errorf("the communication stack is set when the cluster is created")}
+	}
+	stmts, err := optionStatements(op, member, Options{option: value})
+	if err != nil {
+		return err
+	}
+	primary, err := s.primary(ctx, op, member, "")
+	if err != nil {
+		return err
+	}
+	pdb, err := s.open(primary)
+	if err != nil {
+		return sqlError(op, primary, err)
+	}
+	defer pdb.Close()
+	members, err := groupMembers(ctx, pdb)
+	if err != nil {
+		return sqlError(op, primary, err)
+	}
+
+	log.Log.Info("set cluster option", "primary", primary, "option", option, "value", value)
+	for _, m := range members {
+		if m.state != StateOnline {
+			continue
+		}
+		if err := s.exec(ctx, op, m.address, stmts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQL) SetInstanceOption(ctx context.Context, member string, instance string, option string, value interface{}) error {
+	const op = "SetInstanceOption"
+	stmts, err := optionStatements(op, instance, Options{option: value})
+	if err != nil {
+		return err
+	}
+	log.Log.Info("set instance option", "instance", instance, "option", option, "value", value)
+	return s.exec(ctx, op, instance, stmts...)
+}
+
+// exec runs stmts on host.
+func (s *SQL) exec(ctx context.Context, op, host string, stmts ...string) error {
+	db, err := s.open(host)
+	if err != nil {
+		return sqlError(op, host, err)
+	}
+	defer db.Close()
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return sqlError(op, host, err)
+		}
+	}
+	return nil
+}
+
+// SetTopologyMode switches the mode with the group replication functions, which also
+// change group_replication_enforce_update_everywhere_checks. The settings are persisted on
+// every member and the mode is recorded in the metadata like mysqlsh does.
+func (s *SQL) SetTopologyMode(ctx context.Context, member string, multiPrimary bool) error {
+	const op = "SetTopologyMode"
+	primary, err := s.primary(ctx, op, member, "")
+	if err != nil {
+		return err
+	}
+	pdb, err := s.open(primary)
+	if err != nil {
+		return sqlError(op, primary, err)
+	}
+	defer pdb.Close()
+
+	stmt, mode, single, checks := "SELECT group_replication_switch_to_single_primary_mode()", "pm", "ON", "OFF"
+	if multiPrimary {
+		stmt, mode, single, checks = "SELECT group_replication_switch_to_multi_primary_mode()", "mm", "OFF", "ON"
+	}
+	log.Log.Info("switch topology mode", "primary", primary, "multiPrimary", multiPrimary)
+	if _, err := pdb.ExecContext(ctx, stmt); err != nil {
+		return sqlError(op, primary, err)
+	}
+
+	members, err := groupMembers(ctx, pdb)
+	if err != nil {
+		return sqlError(op, primary, err)
+	}
+	for _, m := range members {
+		db, err := s.open(m.address)
+		if err != nil {
+			return sqlError(op, m.address, err)
+		}
+		for _, stmt := range []string{
+			"SET PERSIST_ONLY group_replication_single_primary_mode = " + single,
+			"SET PERSIST_ONLY group_replication_enforce_update_everywhere_checks = " + checks,
+		} {
+			if _, err = db.ExecContext(ctx, stmt); err != nil {
+				break
+			}
+		}
+		db.Close()
+		if err != nil {
+			return sqlError(op, m.address, err)
+		}
+	}
+
+	if _, err := pdb.ExecContext(ctx, "UPDATE mysql_innodb_cluster_metadata.clusters SET primary_mode = ?", mode); err != nil {
+		return sqlError(op, primary, err)
+	}
+	return nil
+}
+
+func (s *SQL) Status(ctx context.Context, member string) (*ClusterStatus, error) {
+	const op = "Status"
+	db, err := s.open(member)
+	if err != nil {
+		return nil, sqlError(op, member, err)
+	}
+	defer db.Close()
+
+	members, err := groupMembers(ctx, db)
+	if err != nil {
+		return nil, sqlError(op, member, err)
+	}
+	_, name, registered, err := metadata(ctx, db)
+	if err != nil {
+		return nil, sqlError(op, member, err)
+	}
+	return clusterStatus(name, members, registered), nil
+}
+
+// clusterStatus merges the group members with the registered instances.
+func clusterStatus(name string, members []groupMember, registered []registeredInstance) *ClusterStatus {
+	status := &ClusterStatus{Name: name}
+	inGroup := map[string]groupMember{}
+	for _, m := range members {
+		if m.state != StateOffline {
+			inGroup[m.uuid] = m
+		}
+		if m.role == RolePrimary && m.state == StateOnline && status.Primary == "" {
+			status.Primary = m.address
+		}
+	}
+	for _, i := range registered {
+		member := MemberStatus{Address: i.address, State: StateMissing, Registered: true}
+		if m, ok := inGroup[i.uuid]; ok {
+			member.State, member.Role = m.state, m.role
+			delete(inGroup, i.uuid)
+		}
+		status.Members = append(status.Members, member)
+	}
+	for _, m := range inGroup {
+		status.Members = append(status.Members, MemberStatus{Address: m.address, State: m.state, Role: m.role})
+	}
+	sortMembers(status.Members)
+	return status
+}
+
+func (s *SQL) RebootCluster(ctx context.Context, seed string) error {
+	const op = "RebootCluster"
+	db, err := s.open(seed)
+	if err != nil {
+		return sqlError(op, seed, err)
+	}
+	defer db.Close()
+
+	members, err := groupMembers(ctx, db)
+	if err != nil {
+		return sqlError(op, seed, err)
+	}
+	for _, m := range members {
+		if m.state == StateOnline {
+			return &Error{Op: op, Instance: seed, Reason: ReasonAlreadyInCluster, Err: fmt.Errorf("member %s is online", m.address)}
+		}
+	}
+
+	log.Log.Info("reboot group", "seed", seed)
+	for _, stmt := range []string{
+		"STOP GROUP_REPLICATION",
+		"SET GLOBAL group_replication_bootstrap_group = ON",
+		"START GROUP_REPLICATION",
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.ExecContext(ctx, "SET GLOBAL group_replication_bootstrap_group = OFF")
+			return sqlError(op, seed, err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, "SET GLOBAL group_replication_bootstrap_group = OFF"); err != nil {
+		return sqlError(op, seed, err)
+	}
+	return nil
+}
+
+func (s *SQL) Rescan(ctx context.Context, member string, remove []string) error {
+	const op = "Rescan"
+	primary, err := s.primary(ctx, op, member, "")
+	if err != nil {
+		return err
+	}
+	db, err := s.open(primary)
+	if err != nil {
+		return sqlError(op, primary, err)
+	}
+	defer db.Close()
+
+	members, err := groupMembers(ctx, db)
+	if err != nil {
+		return sqlError(op, primary, err)
+	}
+	clusterID, _, registered, err := metadata(ctx, db)
+	if err != nil {
+		return sqlError(op, primary, err)
+	}
+
+	inGroup := map[string]bool{}
+	for _, m := range members {
+		inGroup[m.uuid] = true
+	}
+	removed := map[string]bool{}
+	for _, address := range remove {
+		removed[address] = true
+	}
+	known := map[string]bool{}
+	for _, i := range registered {
+		known[i.uuid] = true
+		if inGroup[i.uuid] || !removed[i.address] {
+			continue
+		}
+		log.Log.Info("rescan removes instance", "instance", i.address)
+		if _, err := db.ExecContext(ctx, "DELETE FROM mysql_innodb_cluster_metadata.instances WHERE mysql_server_uuid = ?", i.uuid); err != nil {
+			return sqlError(op, primary, err)
+		}
+	}
+	for _, m := range members {
+		if known[m.uuid] {
+			continue
+		}
+		log.Log.Info("rescan adds instance", "instance", m.address)
+		if err := register(ctx, db, clusterID, m.address, m.uuid); err != nil {
+			return sqlError(op, primary, err)
+		}
+	}
+	return nil
+}
+
+func sortMembers(members []MemberStatus) {
+	sort.Slice(members, func(i, j int) bool { return members[i].Address < members[j].Address })
+}
@@ -0,0 +1,105 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"axe/cluster/innodbcluster/dba"
+)
+
+// jobPollInterval is how often a running job is checked.
+const jobPollInterval = 2 * time.Second
+
+// JobExecutor runs every command in a job of its own and returns the job log. Jobs have
+// no stdin, the job built by Job has to provide it, e.g. from a secret.
+type JobExecutor struct {
+	Client    kubernetes.Interface
+	Namespace string
+	// Job builds the job running command, its first container runs the command.
+	Job func(command []string) *batchv1.Job
+}
+
+var _ dba.Executor = &JobExecutor{}
+
+// NewJobExecutor returns an executor running commands in the jobs built by job.
+func NewJobExecutor(client kubernetes.Interface, namespace string, job func(command []string) *batchv1.Job) *JobExecutor {
+	return &JobExecutor{Client: client, Namespace: namespace, Job: job}
+}
+
+func (e *JobExecutor) Exec(ctx context.Context, host string, stdin string, command []string) (string, error) {
+	jobs := e.Client.BatchV1().Jobs(e.Namespace)
+	job, err := jobs.Create(ctx, e.Job(command), metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create job: %w", err)
+	}
+	defer func() {
+		// the job is not needed once its log is read, ctx may be done already
+		propagation := metav1.DeletePropagationBackground
+		_ = jobs.Delete(context.Background(), job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	}()
+
+	failed := false
+	err = wait.PollUntilContextCancel(ctx, jobPollInterval, false, func(ctx context.Context) (bool, error) {
+		current, err := jobs.Get(ctx, job.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, cond := range current.Status.Conditions {
+			if cond.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch cond.Type {
+			case batchv1.JobComplete:
+				return true, nil
+			case batchv1.JobFailed:
+				failed = true
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to wait for job %s: %w", job.Name, err)
+	}
+
+	out, err := e.log(ctx, job)
+	if err != nil {
+		return "", err
+	}
+	if failed {
+		return "", fmt.Errorf("%s", strings.TrimSpace(out))
+	}
+	return out, nil
+}
+
+// log returns the log of the last pod of job.
+func (e *JobExecutor) log(ctx context.Context, job *batchv1.Job) (string, error) {
+	pods, err := e.Client.CoreV1().Pods(e.Namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + job.Name})
+	if err != nil {
+		return "", fmt.Errorf("failed to list pods of job %s: %w", job.Name, err)
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("job %s has no pods", job.Name)
+	}
+	pod := pods.Items[0]
+	for _, p := range pods.Items[1:] {
+		if p.CreationTimestamp.After(pod.CreationTimestamp.Time) {
+			pod = p
+		}
+	}
+	raw, err := e.Client.CoreV1().Pods(e.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: job.Spec.Template.Spec.Containers[0].Name,
+	}).DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read log of pod %s: %w", pod.Name, err)
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,85 @@
+// Package executor runs the mysqlsh commands of the operator inside the kubernetes cluster,
+// in the container of a member or in a short lived job, so that the shell version always
+// matches the server and the operator image does not need one.
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+
+	"axe/cluster/innodbcluster/dba"
+)
+
+// PodExecutor runs commands with the exec API in the container of the member they
+// connect to.
+type PodExecutor struct {
+	Config    *rest.Config
+	Client    kubernetes.Interface
+	Namespace string
+	Container string
+}
+
+var _ dba.Executor = &PodExecutor{}
+
+// NewPodExecutor returns an executor running commands in container of the member pods of namespace.
+func NewPodExecutor(config *rest.Config, client kubernetes.Interface, namespace, container string) *PodExecutor {
+	return &PodExecutor{Config: config, Client: client, Namespace: namespace, Container: container}
+}
+
+// PodName returns the pod of a member address, the first label of its host name.
+func PodName(host string) string {
+	name, _, _ := strings.Cut(host, ":")
+	name, _, _ = strings.Cut(name, ".")
+	return name
+}
+
+func (e *PodExecutor) Exec(ctx context.Context, host string, stdin string, command []string) (string, error) {
+	pod := PodName(host)
+	req := e.Client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(e.Namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: e.Container,
+			Command:   command,
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(e.Config, "POST", req.URL())
+	if err != nil {
+		return "", fmt.Errorf("failed to exec in pod %s: %w", pod, err)
+	}
+	var stdout, stderr bytes.Buffer
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  strings.NewReader(stdin),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err == nil {
+		return stdout.String(), nil
+	}
+
+	var exitErr utilexec.ExitError
+	if !errors.As(err, &exitErr) {
+		// the command did not run, the pod is gone or not running
+		return "", &dba.Error{Op: "Exec", Instance: host, Reason: dba.ReasonUnreachable,
+			Err: fmt.Errorf("failed to exec in pod %s: %w", pod, err)}
+	}
+	if message := strings.TrimSpace(stderr.String()); message != "" {
+		return stdout.String(), fmt.Errorf("%s", message)
+	}
+	return stdout.String(), err
+}
@@ -0,0 +1,147 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+	"fmt"
+	"path"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RetainedLabel marks the volumes kept by the Retain deletion policy, a new cluster of the
+// same name and namespace adopts them.
+const RetainedLabel = "database.wufan/retained"
+
+// FinalBackupJobName returns the name of the job dumping the databases before deletion.
+func FinalBackupJobName(ins *databasev1.Mysql) string {
+	return ins.Name + "-final-backup"
+}
+
+// HostPathCleanupJobName returns the name of the job removing the data of a host path volume.
+// The volume name ends with the ordinal of its member.
+func HostPathCleanupJobName(ins *databasev1.Mysql, pv *corev1.PersistentVolume) string {
+	return ins.Name + "-cleanup-" + pv.Name[strings.LastIndex(pv.Name, "-")+1:]
+}
+
+// FinalBackupJob builds the job writing a logical dump of all databases of host to the
+// final backup target. The file name is fixed by the deletion time, so a retried job
+// overwrites the same file.
+func FinalBackupJob(ins *databasev1.Mysql, host string) *batchv1.Job {
+	file := fmt.Sprintf("/backup/%s-%s-%s.sql", ins.Namespace, ins.Name, ins.DeletionTimestamp.UTC().Format("20060102150405"))
+	script := fmt.Sprintf(`set -e
+mysqldump -h%s -uroot --all-databases --single-transaction --triggers --routines --events --set-gtid-purged=OFF > %s.tmp
+mv %s.tmp %s
+`, host, file, file, file)
+
+	pvc := *ins.Spec.FinalBackup.PersistentVolumeClaim
+	pvc.ReadOnly = false
+	job := cleanupJob(ins, FinalBackupJobName(ins), script)
+	job.Spec.Template.Spec.Containers[0].Env = []corev1.EnvVar{
+		secretEnv(ins, "MYSQL_PWD", RootPasswordKey, false),
+	}
+	job.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+		{
+			Name:      "backup",
+			MountPath: "/backup",
+		},
+	}
+	job.Spec.Template.Spec.Volumes = []corev1.Volume{
+		{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &pvc,
+			},
+		},
+	}
+	return job
+}
+
+// HostPathCleanupJob builds the job removing the data of a host path volume on node.
+// The parent directory is mounted, a mount point itself can not be removed.
+func HostPathCleanupJob(ins *databasev1.Mysql, pv *corev1.PersistentVolume, node string) *batchv1.Job {
+	dir, base := path.Split(pv.Spec.HostPath.Path)
+	job := cleanupJob(ins, HostPathCleanupJobName(ins, pv), "rm -rf /data/"+base)
+	job.Spec.Template.Spec.NodeName = node
+	job.Spec.Template.Spec.Tolerations = MysqlPodPolicy(ins).Tolerations
+	job.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+		{
+			Name:      "data",
+			MountPath: "/data",
+		},
+	}
+	job.Spec.Template.Spec.Volumes = []corev1.Volume{
+		{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: dir,
+				},
+			},
+		},
+	}
+	return job
+}
+
+// ShellJob builds a job running a mysqlsh or mysql command of the operator with the mysql
+// image of the cluster. The command reads the root password on stdin, it is taken from the
+// secret.
+func ShellJob(ins *databasev1.Mysql, command []string) *batchv1.Job {
+	job := cleanupJob(ins, "", `printf '%s\n' "$MYSQL_PWD" | exec "$@"`)
+	job.GenerateName = ins.Name + "-shell-"
+	job.OwnerReferences = []metav1.OwnerReference{
+		*metav1.NewControllerRef(ins, databasev1.GroupVersion.WithKind("Mysql")),
+	}
+	backoffLimit, ttl := int32(0), int32(300)
+	job.Spec.BackoffLimit = &backoffLimit
+	job.Spec.TTLSecondsAfterFinished = &ttl
+
+	container := &job.Spec.Template.Spec.Containers[0]
+	container.Name = "mysqlsh"
+	container.Command = append(append(container.Command, "sh"), command...)
+	container.Env = []corev1.EnvVar{
+		secretEnv(ins, "MYSQL_PWD", RootPasswordKey, false),
+	}
+	return job
+}
+
+func cleanupJob(ins *databasev1.Mysql, name string, script string) *batchv1.Job {
+	backoffLimit := int32(3)
+	return &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Job",
+			APIVersion: "batch/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ins.Namespace,
+			Labels: map[string]string{
+				"clustername": ins.Name,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"clustername": ins.Name,
+					},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:            "cleanup",
+							Image:           ins.Spec.Mysql.MysqlImage,
+							ImagePullPolicy: MysqlPodPolicy(ins).ImagePullPolicy,
+							Command:         []string{"sh", "-c", script},
+							Resources:       MysqlPodPolicy(ins).ExtraResources,
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -2,103 +2,281 @@ package innodbcluster
 
 import (
 	databasev1 "axe/api/v1"
-	"bytes"
+	"axe/cluster/innodbcluster/dba"
+	"axe/cluster/innodbcluster/executor"
 	"context"
-	"database/sql"
 	"fmt"
-	"os/exec"
+	"hash/fnv"
 	"strconv"
-	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-func ExeCmd(cmd string) (string, error) {
-	//TODO CHECK ERROR RESULT
-	c := exec.Command("sh", "-c", cmd)
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	c.Stdout = &out
-	c.Stderr = &stderr
-	err := c.Run()
-	log.Log.Info("exec", " cmd :", cmd)
-	if err != nil {
-		log.Log.Info(fmt.Sprint(err) + ": " + stderr.String())
-		return stderr.String(), err
-	}
-	log.Log.Info("Result: " + out.String())
-	return out.String(), nil
-}
-
-func pingMySQ(host string, passwd string) bool {
-	db, err := sql.Open("mysql", `root:`+passwd+`@tcp(`+host+`:3306)/mysql?charset=utf8mb4`)
-	if err != nil {
-		panic(err)
-	}
-	defer db.Close()
-
-	attempt := 0
-	for attempt < 50 {
-		err := db.PingContext(context.Background())
-		if err == nil {
-			log.Log.Info("Ping attempt success ", "host:", host)
-			return true
-		}
-		// 如果发生错误，打印错误信息并等待一段时间重试
-		log.Log.Info("Ping attempt failed try latter ", "host:", host)
-		time.Sleep(time.Second * 2)
-		attempt++
+const (
+	// BackendShell runs the cluster operations with mysqlsh.
+	BackendShell = "mysqlsh"
+	// BackendSQL runs the cluster operations over SQL connections from the operator, the
+	// cluster is still created by mysqlsh.
+	BackendSQL = "sql"
+)
+
+const (
+	// ExecutorLocal runs mysqlsh in the operator, which connects to the members itself.
+	ExecutorLocal = "local"
+	// ExecutorPod runs mysqlsh and the mysql client with the exec API in the mysql container
+	// of the member.
+	ExecutorPod = "exec"
+	// ExecutorJob runs mysqlsh and the mysql client in a job with the mysql image of the cluster.
+	ExecutorJob = "job"
+)
+
+var (
+	// Backend selects how the cluster operations are run, it is set from the operator flags.
+	Backend = BackendShell
+	// Executor selects where mysqlsh and the queries of the operator run, it is set from the
+	// operator flags.
+	Executor = ExecutorPod
+	// ClusterDomain is the dns domain of the kubernetes cluster, it is set from the operator flags.
+	ClusterDomain = "cluster.local"
+	// KubeConfig and KubeClient are used by the exec and job executors.
+	KubeConfig *rest.Config
+	KubeClient kubernetes.Interface
+)
+
+// ClusterName is the name of the innodb cluster created on the members.
+const ClusterName = "mgr"
+
+// ClusterManager returns the cluster manager of the backend, logged in as root.
+func ClusterManager(ins *databasev1.Mysql, passwd string) dba.Manager {
+	shell := dba.NewShell("root", passwd, shellExecutor(ins))
+	if Backend == BackendSQL {
+		return dba.NewSQL("root", passwd, shell)
 	}
-	// 达到最大尝试次数，返回 false
-	log.Log.Info("Ping attempt failed ")
+	return shell
+}
 
-	return false
+func shellExecutor(ins *databasev1.Mysql) dba.Executor {
+	switch Executor {
+	case ExecutorPod:
+		return executor.NewPodExecutor(KubeConfig, KubeClient, ins.Namespace, "mysql")
+	case ExecutorJob:
+		return executor.NewJobExecutor(KubeClient, ins.Namespace, func(command []string) *batchv1.Job {
+			return ShellJob(ins, command)
+		})
+	default:
+		return dba.LocalExecutor{}
+	}
 }
-func CreateMGR(ctx context.Context, ins *databasev1.Mysql) error {
 
-	//mysql-axe-2.mysql-axe.default.svc.cluster.local
-	host0 := ins.Name + "-" + strconv.Itoa(0) + "." + ins.Name + "." + ins.Namespace + ".svc.cluster.local"
-	passwd := ins.Spec.Mysql.RootPassword
+// ServiceHost returns the fqdn of the headless service of the members, e.g.
+// mysql-axe.default.svc.cluster.local
+func ServiceHost(ins *databasev1.Mysql) string {
+	return ins.Name + "." + ins.Namespace + ".svc." + ClusterDomain
+}
 
-	for i := 0; i < int(ins.Spec.Replica); i++ {
-		time.Sleep(time.Second * 3)
-		host := ins.Name + "-" + strconv.Itoa(i) + "." + ins.Name + "." + ins.Namespace + ".svc.cluster.local"
+// MemberHost returns the fqdn of a member, e.g. mysql-axe-2.mysql-axe.default.svc.cluster.local
+func MemberHost(ins *databasev1.Mysql, ordinal int) string {
+	return MemberName(ins, ordinal) + "." + ServiceHost(ins)
+}
 
-		if !pingMySQ(host, passwd) {
-			// TODO
-			log.Log.Info("mysql is not ready", "host", host)
-			return fmt.Errorf("mysql is not ready")
-		}
+// ServerIDBase returns the server_id of the first member, from the server id annotation or
+// else derived from the uid of the cluster. Derived bases are multiples of 1000, so the
+// ids of two clusters only overlap if their bases collide.
+func ServerIDBase(ins *databasev1.Mysql) int64 {
+	if base, err := ins.ServerIDBase(); err == nil && base > 0 {
+		return base
+	}
+	h := fnv.New32a()
+	h.Write([]byte(ins.UID))
+	return int64(h.Sum32()%4000000+1) * 1000
+}
+
+// MemberAddress returns the address of a member as it is registered in the cluster.
+func MemberAddress(ins *databasev1.Mysql, ordinal int) string {
+	return MemberHost(ins, ordinal) + ":3306"
+}
+
+// MemberName returns the pod name of a member.
+func MemberName(ins *databasev1.Mysql, ordinal int) string {
+	return ins.Name + "-" + strconv.Itoa(ordinal)
+}
 
-		if i == 0 {
-			// if cluster status is ok return nil
-			cmd := `/usr/bin/mysqlsh -uroot -p` + passwd + ` -h` + host + ` --cluster  -e "print(cluster.status())"`
-			if _, err := ExeCmd(cmd); err == nil {
-				log.Log.Info("cluster is ready")
-				return nil
-			}
-			// else create cluster
-			log.Log.Info("create innodb cluster", "host", host)
-
-			cmd = `echo Y |/usr/bin/mysqlsh -uroot -p` + passwd + ` -h` + host + ` -e "dba.createCluster('mgr')"`
-			ExeCmd(cmd)
-		} else {
-			// 添加节点
-
-			log.Log.Info("add instance to cluster", "host", host)
-			cmd := `echo C |/usr/bin/mysqlsh -uroot -p` + passwd + ` -h` + host0 + ` --cluster -e "cluster.addInstance('root@` + host + `:3306')"`
-			ExeCmd(cmd)
+// CreateCluster creates the innodb cluster on the member of seed. adopt creates it from
+// the group replication group already running on seed.
+func CreateCluster(ctx context.Context, ins *databasev1.Mysql, passwd string, seed int, adopt bool) error {
+	log.Log.Info("create innodb cluster", "host", MemberHost(ins, seed), "adopt", adopt)
+	options := clusterOptions(ins, seed)
+	if adopt {
+		options = dba.Options{dba.OptionAdoptFromGR: true}
+	}
+	if err := ClusterManager(ins, passwd).CreateCluster(ctx, MemberAddress(ins, seed), ClusterName, options); err != nil {
+		return fmt.Errorf("failed to create innodb cluster: %w", err)
+	}
+	return nil
+}
+
+// AddInstance adds the member of ordinal to the cluster of the member of via, its data is
+// cloned from a donor.
+func AddInstance(ctx context.Context, ins *databasev1.Mysql, passwd string, via, ordinal int) error {
+	host := MemberHost(ins, ordinal)
+	if err := Ping(ctx, ins, host, passwd); err != nil {
+		return fmt.Errorf("mysql %s is not ready: %w", host, err)
+	}
+	log.Log.Info("add instance to cluster", "host", host)
+	if err := ClusterManager(ins, passwd).AddInstance(ctx, MemberAddress(ins, via), MemberAddress(ins, ordinal), instanceOptions(ins, ordinal)); err != nil {
+		return fmt.Errorf("failed to add instance %s: %w", host, err)
+	}
+	return nil
+}
+
+// DefaultMemberWeight is the default of group_replication_member_weight.
+const DefaultMemberWeight = 50
 
+// DesiredMemberWeight returns the election weight of the member of ordinal, from
+// spec.mysql.memberWeights or else spec.mysql.groupReplication.memberWeight.
+func DesiredMemberWeight(ins *databasev1.Mysql, ordinal int) int32 {
+	for _, w := range ins.Spec.Mysql.MemberWeights {
+		if int(w.Ordinal) == ordinal {
+			return w.Weight
 		}
 	}
+	if w := ins.Spec.Mysql.GroupReplication.MemberWeight; w != nil {
+		return *w
+	}
+	return DefaultMemberWeight
+}
 
-	// cluster.rescan()
-	cmd := `echo y |/usr/bin/mysqlsh -uroot -p` + ins.Spec.Mysql.RootPassword + ` -h` + host0 + ` --cluster  -e "cluster.rescan()"`
-	ExeCmd(cmd)
+// instanceOptions returns the options of the member of ordinal for addInstance.
+func instanceOptions(ins *databasev1.Mysql, ordinal int) dba.Options {
+	gr := ins.Spec.Mysql.GroupReplication
+	options := dba.Options{dba.OptionMemberWeight: int(DesiredMemberWeight(ins, ordinal))}
+	if gr.AutoRejoinTries != nil {
+		options[dba.OptionAutoRejoinTries] = int(*gr.AutoRejoinTries)
+	}
+	if gr.ExitStateAction != "" {
+		options[dba.OptionExitStateAction] = gr.ExitStateAction
+	}
+	if gr.IPAllowlist != "" {
+		options[dba.OptionIPAllowlist] = gr.IPAllowlist
+	}
+	return options
+}
 
-	// print cluster.status()
-	cmds := `/usr/bin/mysqlsh  -uroot -p` + ins.Spec.Mysql.RootPassword + ` -h` + host0 + `  --cluster  -e "print(cluster.status())"`
-	ExeCmd(cmds)
+// clusterOptions returns the options of the seed member for createCluster, the group wide
+// settings are only accepted there.
+func clusterOptions(ins *databasev1.Mysql, seed int) dba.Options {
+	gr := ins.Spec.Mysql.GroupReplication
+	options := instanceOptions(ins, seed)
+	options[dba.OptionMultiPrimary] = ins.Spec.Mysql.TopologyMode == databasev1.TopologyMultiPrimary
+	if gr.Consistency != "" {
+		options[dba.OptionConsistency] = gr.Consistency
+	}
+	if gr.ExpelTimeout != nil {
+		options[dba.OptionExpelTimeout] = int(*gr.ExpelTimeout)
+	}
+	if gr.CommunicationStack != "" {
+		options[dba.OptionCommunicationStack] = gr.CommunicationStack
+	}
+	if ins.Spec.TLS != nil {
+		options[dba.OptionMemberSSLMode] = "VERIFY_IDENTITY"
+	}
+	return options
+}
+
+// SetClusterOption changes a cluster option on all members.
+func SetClusterOption(ctx context.Context, ins *databasev1.Mysql, passwd string, via int, option string, value interface{}) error {
+	log.Log.Info("set cluster option", "clustername", ins.Name, "option", option, "value", value)
+	if err := ClusterManager(ins, passwd).SetOption(ctx, MemberAddress(ins, via), option, value); err != nil {
+		return fmt.Errorf("failed to set cluster option %s: %w", option, err)
+	}
+	return nil
+}
+
+// SetInstanceOption changes an option of the member of ordinal.
+func SetInstanceOption(ctx context.Context, ins *databasev1.Mysql, passwd string, via, ordinal int, option string, value interface{}) error {
+	host := MemberHost(ins, ordinal)
+	log.Log.Info("set instance option", "host", host, "option", option, "value", value)
+	if err := ClusterManager(ins, passwd).SetInstanceOption(ctx, MemberAddress(ins, via), MemberAddress(ins, ordinal), option, value); err != nil {
+		return fmt.Errorf("failed to set option %s of instance %s: %w", option, host, err)
+	}
+	return nil
+}
+
+// RemoveInstance removes the member of ordinal from the cluster of the member of via. force
+// is needed when the member is not reachable anymore.
+func RemoveInstance(ctx context.Context, ins *databasev1.Mysql, passwd string, via, ordinal int, force bool) error {
+	host := MemberHost(ins, ordinal)
+	log.Log.Info("remove instance from cluster", "host", host, "force", force)
+	if err := ClusterManager(ins, passwd).RemoveInstance(ctx, MemberAddress(ins, via), MemberAddress(ins, ordinal), force); err != nil {
+		return fmt.Errorf("failed to remove instance %s: %w", host, err)
+	}
+	return nil
+}
+
+// RescanCluster registers the group members missing in the metadata of the cluster of the
+// member of via, and removes the members of ordinals that are not in the group anymore.
+func RescanCluster(ctx context.Context, ins *databasev1.Mysql, passwd string, via int, ordinals []int) error {
+	var remove []string
+	for _, ordinal := range ordinals {
+		remove = append(remove, MemberAddress(ins, ordinal))
+	}
+	log.Log.Info("rescan cluster", "clustername", ins.Name, "remove", remove)
+	if err := ClusterManager(ins, passwd).Rescan(ctx, MemberAddress(ins, via), remove); err != nil {
+		return fmt.Errorf("failed to rescan cluster: %w", err)
+	}
+	return nil
+}
+
+// SetPrimaryInstance makes the member of ordinal the primary.
+func SetPrimaryInstance(ctx context.Context, ins *databasev1.Mysql, passwd string, ordinal int) error {
+	host := MemberHost(ins, ordinal)
+	log.Log.Info("set primary instance", "host", host)
+	if err := ClusterManager(ins, passwd).SetPrimary(ctx, MemberAddress(ins, ordinal), MemberAddress(ins, ordinal)); err != nil {
+		return fmt.Errorf("failed to set primary instance %s: %w", host, err)
+	}
+	return nil
+}
+
+// RejoinInstance makes the member of ordinal join the group of the member of via again.
+func RejoinInstance(ctx context.Context, ins *databasev1.Mysql, passwd string, via, ordinal int) error {
+	host := MemberHost(ins, ordinal)
+	log.Log.Info("rejoin instance to cluster", "host", host)
+	if err := ClusterManager(ins, passwd).RejoinInstance(ctx, MemberAddress(ins, via), MemberAddress(ins, ordinal)); err != nil {
+		return fmt.Errorf("failed to rejoin instance %s: %w", host, err)
+	}
+	return nil
+}
+
+// RebuildInstance replaces the data of the member of ordinal with a clone from the group
+// of the member of via.
+func RebuildInstance(ctx context.Context, ins *databasev1.Mysql, passwd string, via, ordinal int) error {
+	host := MemberHost(ins, ordinal)
+	log.Log.Info("rebuild instance", "host", host)
+	if err := ClusterManager(ins, passwd).RebuildInstance(ctx, MemberAddress(ins, via), MemberAddress(ins, ordinal)); err != nil {
+		return fmt.Errorf("failed to rebuild instance %s: %w", host, err)
+	}
+	return nil
+}
+
+// RebootCluster restarts the group on the member of ordinal after a complete outage.
+func RebootCluster(ctx context.Context, ins *databasev1.Mysql, passwd string, ordinal int) error {
+	host := MemberHost(ins, ordinal)
+	log.Log.Info("reboot cluster from complete outage", "host", host)
+	if err := ClusterManager(ins, passwd).RebootCluster(ctx, MemberAddress(ins, ordinal)); err != nil {
+		return fmt.Errorf("failed to reboot cluster on %s: %w", host, err)
+	}
+	return nil
+}
+
+// SetTopologyMode switches the group of the member of via to the topology mode of the spec.
+func SetTopologyMode(ctx context.Context, ins *databasev1.Mysql, passwd string, via int) error {
+	multiPrimary := ins.Spec.Mysql.TopologyMode == databasev1.TopologyMultiPrimary
+	log.Log.Info("switch topology mode", "clustername", ins.Name, "mode", ins.Spec.Mysql.TopologyMode)
+	if err := ClusterManager(ins, passwd).SetTopologyMode(ctx, MemberAddress(ins, via), multiPrimary); err != nil {
+		return fmt.Errorf("failed to switch to %s mode: %w", ins.Spec.Mysql.TopologyMode, err)
+	}
 	return nil
 }
@@ -6,62 +6,55 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func env(ins *databasev1.Mysql) []corev1.EnvVar {
 	return []corev1.EnvVar{
-		// {
-		// 	Name:  "MYSQL_USER",
-		// 	Value: ins.Spec.Mysql.MysqlUser,
-		// },
-		// {
-		// 	Name:  "MYSQL_PASSWORD",
-		// 	Value: ins.Spec.Mysql.MysqlPassword,
-		// },
-		// {
-		// 	Name:  "MYSQL_DATABASE",
-		// 	Value: ins.Spec.Mysql.MysqlUser,
-		// },
-		{
-			Name:  "MYSQL_ROOT_PASSWORD",
-			Value: ins.Spec.Mysql.RootPassword,
-		},
+		secretEnv(ins, "MYSQL_ROOT_PASSWORD", RootPasswordKey, false),
+		secretEnv(ins, "MYSQL_USER", UserKey, true),
+		secretEnv(ins, "MYSQL_PASSWORD", PasswordKey, true),
 		{
 			Name:  "NAMESPACE",
 			Value: ins.Namespace,
 		},
-		{
-			Name:  "REPLICA",
-			Value: strconv.Itoa(int(ins.Spec.Replica)),
-		},
 		{
 			Name:  "SERVICE_NAME",
 			Value: ins.Name,
 		},
+		{
+			Name:  "SERVICE_HOST",
+			Value: ServiceHost(ins),
+		},
+		{
+			Name:  "SERVER_ID_BASE",
+			Value: strconv.FormatInt(ServerIDBase(ins), 10),
+		},
 	}
 }
 
 func InitContainers(ins *databasev1.Mysql) []corev1.Container {
 	return []corev1.Container{
 		{
-			Name:  "init-mysql",
-			Image: ins.Spec.Mysql.MysqlImage,
+			Name:            "init-mysql",
+			Image:           ins.Spec.Mysql.MysqlImage,
+			ImagePullPolicy: MysqlPodPolicy(ins).ImagePullPolicy,
+			Resources:       MysqlPodPolicy(ins).ExtraResources,
 			Command: []string{
 				"sh",
 				"-c",
 				`
 				# 解析 HOSTNAME 获取 Pod 索引
 				POD_INDEX=$(echo $HOSTNAME | awk -F'-' '{print $NF}')
-				TIMEUNIX=$(date +%s | awk '{print substr($0,length()-4)}')
-				# 将索引写入到 MySQL 配置文件（假设为 /etc/mysql/conf.d/server-id.cnf）
+				# server-id 由集群固定的 SERVER_ID_BASE 加上索引得到，重启后不变
 				echo "[mysqld]" > /etc/mysql/conf.d/server-id.cnf
-				echo "server-id=$TIMEUNIX$POD_INDEX" >> /etc/mysql/conf.d/server-id.cnf
+				echo "server-id=$((SERVER_ID_BASE + POD_INDEX))" >> /etc/mysql/conf.d/server-id.cnf
 				#mysql-axe-2.mysql-axe.default.svc.cluster.local mysql-axe-2
-				echo "report_host=$HOSTNAME.$SERVICE_NAME.$NAMESPACE.svc.cluster.local" >> /etc/mysql/conf.d/server-id.cnf
+				echo "report_host=$HOSTNAME.$SERVICE_HOST" >> /etc/mysql/conf.d/server-id.cnf
 
-				ln -sf /mnt/config/* /etc/mysql/conf.d/
+				ln -sf /mnt/config/*.cnf /etc/mysql/conf.d/
 				`,
 			},
 			Env: env(ins),
@@ -80,6 +73,19 @@ func InitContainers(ins *databasev1.Mysql) []corev1.Container {
 }
 
 func VolumeTmp(ins *databasev1.Mysql) []corev1.PersistentVolumeClaim {
+	mode := PersistenceMode(ins)
+	if mode == databasev1.PersistenceModeEmptyDir {
+		return nil
+	}
+
+	var storageClass *string
+	if mode == databasev1.PersistenceModeHostPath {
+		// bind only to the volumes created by the operator
+		storageClass = new(string)
+	} else if ins.Spec.Persistence.StorageClass != "" {
+		storageClass = &ins.Spec.Persistence.StorageClass
+	}
+
 	return []corev1.PersistentVolumeClaim{
 		{
 			ObjectMeta: metav1.ObjectMeta{
@@ -97,18 +103,71 @@ func VolumeTmp(ins *databasev1.Mysql) []corev1.PersistentVolumeClaim {
 						corev1.ResourceStorage: resource.MustParse(ins.Spec.Persistence.Size),
 					},
 				},
-				StorageClassName: &ins.Spec.Persistence.StorageClass,
+				StorageClassName: storageClass,
 			},
 		},
 	}
 }
 
+func volumes(ins *databasev1.Mysql) []corev1.Volume {
+	optional := true
+	volumes := []corev1.Volume{
+		{
+			Name: ins.Name + "-mysql",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: MysqlConfigName(ins),
+					},
+				},
+			},
+		},
+		{
+			// init.sql is run by the image entrypoint when the data directory is initialized
+			Name: "init-sql",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: MysqlConfigName(ins),
+					},
+					Items: []corev1.KeyToPath{
+						{
+							Key:  InitSQLKey,
+							Path: InitSQLKey,
+						},
+					},
+					Optional: &optional,
+				},
+			},
+		},
+		{
+			Name: "server-id",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+	}
+
+	volumes = append(volumes, tlsVolumes(ins)...)
+
+	// the data volume comes from the claim templates otherwise
+	if PersistenceMode(ins) == databasev1.PersistenceModeEmptyDir {
+		volumes = append(volumes, corev1.Volume{
+			Name: "mysql-data",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+	return volumes
+}
+
 func mysqlContainers(ins *databasev1.Mysql) []corev1.Container {
 	return []corev1.Container{
 		{
 			Name:            "mysql",
 			Image:           ins.Spec.Mysql.MysqlImage,
-			ImagePullPolicy: ins.Spec.PodPolicy.ImagePullPolicy,
+			ImagePullPolicy: MysqlPodPolicy(ins).ImagePullPolicy,
 
 			Ports: []corev1.ContainerPort{
 				{
@@ -125,7 +184,7 @@ func mysqlContainers(ins *databasev1.Mysql) []corev1.Container {
 				},
 			},
 			Env: env(ins),
-			VolumeMounts: []corev1.VolumeMount{
+			VolumeMounts: append([]corev1.VolumeMount{
 				{
 					Name:      "server-id",
 					MountPath: "/etc/mysql/conf.d/",
@@ -134,24 +193,29 @@ func mysqlContainers(ins *databasev1.Mysql) []corev1.Container {
 					Name:      ins.Name + "-mysql",
 					MountPath: "/mnt/config/",
 				},
+				{
+					Name:      "init-sql",
+					MountPath: "/docker-entrypoint-initdb.d/",
+				},
 				{
 					Name:      "mysql-data",
 					MountPath: "/var/lib/mysql",
 				},
-			},
+			}, tlsVolumeMounts(ins)...),
 			Resources: ins.Spec.Mysql.Resources,
 		},
 	}
 }
 
-func MysqlStatefulset(ins *databasev1.Mysql) *appsv1.StatefulSet {
+// MysqlStatefulset builds the mysql statefulset, configHash is the hash of the rendered
+// mysql configmap so that a config change restarts the members, tlsHash the one of the
+// certificates, empty without spec.tls.
+func MysqlStatefulset(ins *databasev1.Mysql, configHash, tlsHash string) *appsv1.StatefulSet {
 	if ins == nil || ins.Spec.Replica < 0 {
 		// 在实际场景中，应该处理这个错误，比如返回一个错误或记录日志
 		return nil
 	}
 
-	var DirectoryOrCreate corev1.HostPathType = corev1.HostPathDirectoryOrCreate
-
 	lables := map[string]string{
 		"clustername": ins.Name,
 		"app":         databasev1.MYSQLAPP,
@@ -166,9 +230,8 @@ func MysqlStatefulset(ins *databasev1.Mysql) *appsv1.StatefulSet {
 			Name:      ins.Name,
 			Namespace: ins.Namespace,
 			Labels: map[string]string{
-				"clustername":   ins.Name,
-				"app":           databasev1.MYSQLAPP,
-				"clusterstatus": databasev1.MgrNOTinstalled,
+				"clustername": ins.Name,
+				"app":         databasev1.MYSQLAPP,
 			},
 		},
 		Spec: appsv1.StatefulSetSpec{
@@ -179,48 +242,82 @@ func MysqlStatefulset(ins *databasev1.Mysql) *appsv1.StatefulSet {
 			ServiceName: ins.Name,
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: lables,
+					Labels:      lables,
+					Annotations: podAnnotations(configHash, tlsHash),
 				},
 
 				Spec: corev1.PodSpec{
 					InitContainers: InitContainers(ins),
 					Containers:     mysqlContainers(ins),
-					// 添加其他Pod配置，如NodeSelector、Affinity、Tolerations等
-					Volumes: []corev1.Volume{
-
-						{
-							Name: ins.Name + "-mysql",
-							VolumeSource: corev1.VolumeSource{
-								ConfigMap: &corev1.ConfigMapVolumeSource{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: ins.Name + "-mysql",
-									},
-								},
-							},
-						},
-						{
-							Name: "server-id",
-							VolumeSource: corev1.VolumeSource{
-								EmptyDir: &corev1.EmptyDirVolumeSource{},
-							},
-						},
-						{
-
-							Name: "mysql-data",
-							VolumeSource: corev1.VolumeSource{
-								HostPath: &corev1.HostPathVolumeSource{
-									Path: "/data/mysql/" + ins.Namespace + "/" + ins.Name,
-									Type: &DirectoryOrCreate,
-								},
-							},
-						},
-					},
+					Volumes:        volumes(ins),
 				},
 			},
-			// 添加 VolumeClaimTemplates 如果需要
-			// VolumeClaimTemplates: VolumeTmp(),
+			VolumeClaimTemplates: VolumeTmp(ins),
 		},
 	}
 
+	applyPodPolicy(&statefulSet.Spec.Template, MysqlPodPolicy(ins), lables)
 	return statefulSet
 }
+
+// VolumeClaimTemplatesEqual reports whether the claim templates request the same volumes. The
+// fields defaulted by the server are not compared.
+func VolumeClaimTemplatesEqual(a, b []corev1.PersistentVolumeClaim) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := a[i].Spec, b[i].Spec
+		if a[i].Name != b[i].Name || !equality.Semantic.DeepEqual(x.AccessModes, y.AccessModes) ||
+			x.Resources.Requests.Storage().Cmp(*y.Resources.Requests.Storage()) != 0 ||
+			!equality.Semantic.DeepEqual(x.StorageClassName, y.StorageClassName) {
+			return false
+		}
+	}
+	return true
+}
+
+// KeepVolumeClaimTemplates keeps the claim templates of the existing statefulset in desired
+// when they differ, volumeClaimTemplates can not be updated. The volumes no longer claimed,
+// e.g. the host path data volume of a cluster created before the claim templates, are taken
+// over from the existing pod template. It reports whether the templates were kept.
+func KeepVolumeClaimTemplates(desired, existing *appsv1.StatefulSet) bool {
+	if VolumeClaimTemplatesEqual(desired.Spec.VolumeClaimTemplates, existing.Spec.VolumeClaimTemplates) {
+		return false
+	}
+	desired.Spec.VolumeClaimTemplates = existing.Spec.VolumeClaimTemplates
+
+	claimed := map[string]bool{}
+	for _, claim := range existing.Spec.VolumeClaimTemplates {
+		claimed[claim.Name] = true
+	}
+	defined := map[string]bool{}
+	var volumes []corev1.Volume
+	for _, volume := range desired.Spec.Template.Spec.Volumes {
+		if !claimed[volume.Name] {
+			volumes = append(volumes, volume)
+			defined[volume.Name] = true
+		}
+	}
+	for _, volume := range existing.Spec.Template.Spec.Volumes {
+		if !claimed[volume.Name] && !defined[volume.Name] && mounted(&desired.Spec.Template.Spec, volume.Name) {
+			volumes = append(volumes, volume)
+		}
+	}
+	desired.Spec.Template.Spec.Volumes = volumes
+	return true
+}
+
+// mounted reports whether a container of the pod mounts the volume.
+func mounted(spec *corev1.PodSpec, volume string) bool {
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for _, container := range containers {
+			for _, mount := range container.VolumeMounts {
+				if mount.Name == volume {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testMysql() *databasev1.Mysql {
+	return &databasev1.Mysql{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql", Namespace: "default"},
+		Spec: databasev1.MysqlSpec{
+			Replica: 3,
+			Persistence: databasev1.Persistence{
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Size:        "10Gi",
+			},
+		},
+	}
+}
+
+func volumeNamed(volumes []corev1.Volume, name string) *corev1.Volume {
+	for i := range volumes {
+		if volumes[i].Name == name {
+			return &volumes[i]
+		}
+	}
+	return nil
+}
+
+func TestKeepVolumeClaimTemplates(t *testing.T) {
+	ins := testMysql()
+
+	// a statefulset created before the claim templates mounts the data from the host
+	legacy := MysqlStatefulset(ins, "", "")
+	legacy.Spec.VolumeClaimTemplates = nil
+	legacy.Spec.Template.Spec.Volumes = append(legacy.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name: "mysql-data",
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: "/data/mysql/default/mysql"},
+		},
+	})
+	desired := MysqlStatefulset(ins, "", "")
+	if !KeepVolumeClaimTemplates(desired, legacy) {
+		t.Fatal("claim templates of the legacy statefulset are not kept")
+	}
+	if len(desired.Spec.VolumeClaimTemplates) != 0 {
+		t.Errorf("desired claim templates = %v, want none", desired.Spec.VolumeClaimTemplates)
+	}
+	data := volumeNamed(desired.Spec.Template.Spec.Volumes, "mysql-data")
+	if data == nil || data.HostPath == nil || data.HostPath.Path != "/data/mysql/default/mysql" {
+		t.Errorf("data volume = %+v, want the host path of the legacy statefulset", data)
+	}
+
+	// the server defaults the volume mode, a matching statefulset is applied as is
+	existing := MysqlStatefulset(ins, "", "")
+	filesystem := corev1.PersistentVolumeFilesystem
+	existing.Spec.VolumeClaimTemplates[0].Spec.VolumeMode = &filesystem
+	desired = MysqlStatefulset(ins, "", "")
+	if KeepVolumeClaimTemplates(desired, existing) {
+		t.Error("matching claim templates are kept")
+	}
+	if desired.Spec.VolumeClaimTemplates[0].Spec.VolumeMode != nil {
+		t.Error("desired claim templates are changed")
+	}
+
+	// a resized claim can not be applied either
+	ins.Spec.Persistence.Size = "20Gi"
+	desired = MysqlStatefulset(ins, "", "")
+	if !KeepVolumeClaimTemplates(desired, existing) {
+		t.Fatal("claim templates of a resized statefulset are not kept")
+	}
+	if got := desired.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests[corev1.ResourceStorage]; got.Cmp(resource.MustParse("10Gi")) != 0 {
+		t.Errorf("storage request = %s, want 10Gi", got.String())
+	}
+	if volumeNamed(desired.Spec.Template.Spec.Volumes, "mysql-data") != nil {
+		t.Error("claimed data volume is defined in the pod template")
+	}
+}
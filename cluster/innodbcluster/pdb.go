@@ -0,0 +1,59 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// PodDisruptionBudgetEnabled reports whether the pod disruption budgets are managed.
+func PodDisruptionBudgetEnabled(ins *databasev1.Mysql) bool {
+	return ins.Spec.PodDisruptionBudget == nil || *ins.Spec.PodDisruptionBudget
+}
+
+// MysqlPDB builds the pod disruption budget of the mysql members. The group keeps its
+// quorum as long as a majority is online, e.g. one of three or two of five members may
+// be evicted. A single member can always be evicted, it has no quorum to keep.
+func MysqlPDB(ins *databasev1.Mysql) *policyv1.PodDisruptionBudget {
+	maxUnavailable := (int(ins.Spec.Replica) - 1) / 2
+	if maxUnavailable < 1 {
+		maxUnavailable = 1
+	}
+	return podDisruptionBudget(ins, ins.Name+"-mysql", maxUnavailable, map[string]string{
+		"clustername": ins.Name,
+		"app":         databasev1.MYSQLAPP,
+	})
+}
+
+// RouterPDB builds the pod disruption budget of the routers, one router at a time may be evicted.
+func RouterPDB(ins *databasev1.Mysql) *policyv1.PodDisruptionBudget {
+	return podDisruptionBudget(ins, ins.Name+"-router", 1, map[string]string{
+		"clustername": ins.Name,
+		"app":         "mysql-router",
+	})
+}
+
+func podDisruptionBudget(ins *databasev1.Mysql, name string, maxUnavailable int, selector map[string]string) *policyv1.PodDisruptionBudget {
+	unavailable := intstr.FromInt(maxUnavailable)
+	return &policyv1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodDisruptionBudget",
+			APIVersion: "policy/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ins.Namespace,
+			Labels: map[string]string{
+				"clustername": ins.Name,
+			},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &unavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: selector,
+			},
+		},
+	}
+}
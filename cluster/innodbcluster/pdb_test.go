@@ -0,0 +1,32 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+	"testing"
+)
+
+func TestMysqlPDB(t *testing.T) {
+	for _, tc := range []struct {
+		replica int32
+		want    int
+	}{
+		// a single member has no quorum to keep
+		{1, 1},
+		{3, 1},
+		{5, 2},
+		{7, 3},
+	} {
+		ins := testMysql()
+		ins.Spec.Replica = tc.replica
+		pdb := MysqlPDB(ins)
+		if got := pdb.Spec.MaxUnavailable.IntValue(); got != tc.want {
+			t.Errorf("MysqlPDB(replica %d) maxUnavailable = %d, want %d", tc.replica, got, tc.want)
+		}
+		if pdb.Spec.MinAvailable != nil {
+			t.Errorf("MysqlPDB(replica %d) minAvailable = %s, want none", tc.replica, pdb.Spec.MinAvailable)
+		}
+		if pdb.Name != "mysql-mysql" || pdb.Spec.Selector.MatchLabels["app"] != databasev1.MYSQLAPP {
+			t.Errorf("MysqlPDB(replica %d) = %s selecting %v", tc.replica, pdb.Name, pdb.Spec.Selector.MatchLabels)
+		}
+	}
+}
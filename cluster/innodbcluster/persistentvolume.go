@@ -0,0 +1,91 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+	"fmt"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PersistenceMode returns how the mysql data of the cluster is stored.
+func PersistenceMode(ins *databasev1.Mysql) string {
+	p := ins.Spec.Persistence
+	switch {
+	case p.Enabled != nil && !*p.Enabled:
+		return databasev1.PersistenceModeEmptyDir
+	case p.HostPath != "":
+		return databasev1.PersistenceModeHostPath
+	default:
+		return databasev1.PersistenceModePVC
+	}
+}
+
+// DataClaimName returns the name of the claim created by the statefulset for a member.
+func DataClaimName(ins *databasev1.Mysql, ordinal int) string {
+	return fmt.Sprintf("mysql-data-%s-%d", ins.Name, ordinal)
+}
+
+// HostPathPVName returns the name of the host path volume of a member.
+// Persistent volumes are cluster scoped, so the namespace is part of the name.
+func HostPathPVName(ins *databasev1.Mysql, ordinal int) string {
+	return fmt.Sprintf("mysql-data-%s-%s-%d", ins.Namespace, ins.Name, ordinal)
+}
+
+// HostPathPV builds the host path volume of a member. The volume is pre-bound to the
+// member's claim and only usable on node, so the member always comes back to its data.
+func HostPathPV(ins *databasev1.Mysql, ordinal int, node string) *corev1.PersistentVolume {
+	directoryOrCreate := corev1.HostPathDirectoryOrCreate
+
+	return &corev1.PersistentVolume{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PersistentVolume",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: HostPathPVName(ins, ordinal),
+			Labels: map[string]string{
+				"clustername":      ins.Name,
+				"clusternamespace": ins.Namespace,
+				"app":              databasev1.MYSQLAPP,
+			},
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse(ins.Spec.Persistence.Size),
+			},
+			AccessModes:                   ins.Spec.Persistence.AccessModes,
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			StorageClassName:              "",
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: path.Join(ins.Spec.Persistence.HostPath, ins.Namespace, fmt.Sprintf("%s-%d", ins.Name, ordinal)),
+					Type: &directoryOrCreate,
+				},
+			},
+			ClaimRef: &corev1.ObjectReference{
+				Kind:       "PersistentVolumeClaim",
+				APIVersion: "v1",
+				Namespace:  ins.Namespace,
+				Name:       DataClaimName(ins, ordinal),
+			},
+			NodeAffinity: &corev1.VolumeNodeAffinity{
+				Required: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{
+							MatchExpressions: []corev1.NodeSelectorRequirement{
+								{
+									Key:      corev1.LabelHostname,
+									Operator: corev1.NodeSelectorOpIn,
+									Values:   []string{node},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
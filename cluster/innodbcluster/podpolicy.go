@@ -0,0 +1,101 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MysqlPodPolicy returns the pod policy of the mysql pods.
+func MysqlPodPolicy(ins *databasev1.Mysql) databasev1.Policy {
+	return mergePolicy(ins.Spec.PodPolicy, ins.Spec.Mysql.PodPolicy)
+}
+
+// RouterPodPolicy returns the pod policy of the router pods.
+func RouterPodPolicy(ins *databasev1.Mysql) databasev1.Policy {
+	return mergePolicy(ins.Spec.PodPolicy, ins.Spec.Router.PodPolicy)
+}
+
+// mergePolicy overrides the shared policy with the fields set in the component policy.
+func mergePolicy(shared databasev1.Policy, component *databasev1.ComponentPolicy) databasev1.Policy {
+	policy := *shared.DeepCopy()
+	if component == nil {
+		return policy
+	}
+	c := component.DeepCopy()
+
+	if c.ImagePullPolicy != "" {
+		policy.ImagePullPolicy = c.ImagePullPolicy
+	}
+	policy.Labels = mergeMap(policy.Labels, c.Labels)
+	policy.Annotations = mergeMap(policy.Annotations, c.Annotations)
+	policy.NodeSelector = mergeMap(policy.NodeSelector, c.NodeSelector)
+	if c.Affinity != nil {
+		policy.Affinity = c.Affinity
+	}
+	if c.PriorityClassName != "" {
+		policy.PriorityClassName = c.PriorityClassName
+	}
+	if c.Tolerations != nil {
+		policy.Tolerations = c.Tolerations
+	}
+	if c.TopologySpreadConstraints != nil {
+		policy.TopologySpreadConstraints = c.TopologySpreadConstraints
+	}
+	return policy
+}
+
+// mergeMap returns the entries of a overridden by the entries of b.
+func mergeMap(a, b map[string]string) map[string]string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		m[k] = v
+	}
+	return m
+}
+
+// applyPodPolicy sets the policy on a pod template. The labels and annotations of the
+// template are kept over the ones of the policy, as the selector depends on them.
+// Without affinity and spread constraints the pods prefer distinct nodes and zones.
+func applyPodPolicy(template *corev1.PodTemplateSpec, policy databasev1.Policy, selector map[string]string) {
+	template.Labels = mergeMap(policy.Labels, template.Labels)
+	template.Annotations = mergeMap(policy.Annotations, template.Annotations)
+	template.Spec.PriorityClassName = policy.PriorityClassName
+	template.Spec.NodeSelector = policy.NodeSelector
+	template.Spec.Tolerations = policy.Tolerations
+	template.Spec.Affinity = policy.Affinity
+	template.Spec.TopologySpreadConstraints = policy.TopologySpreadConstraints
+
+	if policy.Affinity != nil || len(policy.TopologySpreadConstraints) > 0 {
+		return
+	}
+	labelSelector := &metav1.LabelSelector{MatchLabels: selector}
+	template.Spec.Affinity = &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+				{
+					Weight: 100,
+					PodAffinityTerm: corev1.PodAffinityTerm{
+						LabelSelector: labelSelector,
+						TopologyKey:   corev1.LabelHostname,
+					},
+				},
+			},
+		},
+	}
+	template.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{
+		{
+			MaxSkew:           1,
+			TopologyKey:       corev1.LabelTopologyZone,
+			WhenUnsatisfiable: corev1.ScheduleAnyway,
+			LabelSelector:     labelSelector,
+		},
+	}
+}
@@ -0,0 +1,153 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func nodeAffinity(zone string) *corev1.Affinity {
+	return &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{{
+				Key: corev1.LabelTopologyZone, Operator: corev1.NodeSelectorOpIn, Values: []string{zone},
+			}}}},
+		},
+	}}
+}
+
+func TestMergePolicy(t *testing.T) {
+	dedicated := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "mysql", Effect: corev1.TaintEffectNoSchedule}
+	spot := corev1.Toleration{Key: "spot", Operator: corev1.TolerationOpExists}
+	shared := databasev1.Policy{
+		ImagePullPolicy:   corev1.PullIfNotPresent,
+		Labels:            map[string]string{"team": "db", "tier": "data"},
+		Affinity:          nodeAffinity("zone-a"),
+		PriorityClassName: "low",
+		NodeSelector:      map[string]string{"disk": "ssd", "pool": "shared"},
+		Tolerations:       []corev1.Toleration{dedicated},
+	}
+
+	for _, tc := range []struct {
+		name      string
+		component *databasev1.ComponentPolicy
+		want      databasev1.Policy
+	}{
+		{
+			name: "no component policy",
+			want: shared,
+		},
+		{
+			name:      "empty component policy",
+			component: &databasev1.ComponentPolicy{},
+			want:      shared,
+		},
+		{
+			name: "component fields replace the shared ones",
+			component: &databasev1.ComponentPolicy{
+				ImagePullPolicy:   corev1.PullAlways,
+				Affinity:          nodeAffinity("zone-b"),
+				PriorityClassName: "high",
+				Tolerations:       []corev1.Toleration{spot},
+			},
+			want: databasev1.Policy{
+				ImagePullPolicy:   corev1.PullAlways,
+				Labels:            shared.Labels,
+				Affinity:          nodeAffinity("zone-b"),
+				PriorityClassName: "high",
+				NodeSelector:      shared.NodeSelector,
+				Tolerations:       []corev1.Toleration{spot},
+			},
+		},
+		{
+			name: "empty tolerations drop the shared ones",
+			component: &databasev1.ComponentPolicy{
+				Tolerations: []corev1.Toleration{},
+			},
+			want: databasev1.Policy{
+				ImagePullPolicy:   shared.ImagePullPolicy,
+				Labels:            shared.Labels,
+				Affinity:          shared.Affinity,
+				PriorityClassName: shared.PriorityClassName,
+				NodeSelector:      shared.NodeSelector,
+				Tolerations:       []corev1.Toleration{},
+			},
+		},
+		{
+			name: "labels and node selector are merged",
+			component: &databasev1.ComponentPolicy{
+				Labels:       map[string]string{"tier": "proxy"},
+				NodeSelector: map[string]string{"pool": "router", "arch": "arm64"},
+			},
+			want: databasev1.Policy{
+				ImagePullPolicy:   shared.ImagePullPolicy,
+				Labels:            map[string]string{"team": "db", "tier": "proxy"},
+				Affinity:          shared.Affinity,
+				PriorityClassName: shared.PriorityClassName,
+				NodeSelector:      map[string]string{"disk": "ssd", "pool": "router", "arch": "arm64"},
+				Tolerations:       shared.Tolerations,
+			},
+		},
+	} {
+		got := mergePolicy(shared, tc.component)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: mergePolicy = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+
+	// the merged policy does not share the maps of the shared policy
+	merged := mergePolicy(shared, &databasev1.ComponentPolicy{NodeSelector: map[string]string{"pool": "mysql"}})
+	merged.Labels["team"] = "other"
+	if shared.NodeSelector["pool"] != "shared" || shared.Labels["team"] != "db" {
+		t.Error("mergePolicy changed the shared policy")
+	}
+}
+
+func TestApplyPodPolicy(t *testing.T) {
+	selector := map[string]string{"app": "mysql"}
+
+	// without affinity the pods prefer distinct nodes and zones
+	template := &corev1.PodTemplateSpec{}
+	applyPodPolicy(template, databasev1.Policy{NodeSelector: map[string]string{"disk": "ssd"}}, selector)
+	anti := template.Spec.Affinity.PodAntiAffinity
+	if anti == nil || len(anti.PreferredDuringSchedulingIgnoredDuringExecution) != 1 ||
+		anti.PreferredDuringSchedulingIgnoredDuringExecution[0].PodAffinityTerm.TopologyKey != corev1.LabelHostname {
+		t.Errorf("default affinity = %+v, want anti-affinity on the host name", template.Spec.Affinity)
+	}
+	spread := template.Spec.TopologySpreadConstraints
+	if len(spread) != 1 || spread[0].TopologyKey != corev1.LabelTopologyZone || spread[0].WhenUnsatisfiable != corev1.ScheduleAnyway {
+		t.Errorf("default spread constraints = %+v, want a soft spread across zones", spread)
+	}
+	if !reflect.DeepEqual(template.Spec.NodeSelector, map[string]string{"disk": "ssd"}) {
+		t.Errorf("node selector = %v, want the one of the policy", template.Spec.NodeSelector)
+	}
+
+	// an affinity of the user replaces the default, spread constraints included
+	template = &corev1.PodTemplateSpec{}
+	applyPodPolicy(template, databasev1.Policy{Affinity: nodeAffinity("zone-a")}, selector)
+	if !reflect.DeepEqual(template.Spec.Affinity, nodeAffinity("zone-a")) {
+		t.Errorf("affinity = %+v, want the one of the policy", template.Spec.Affinity)
+	}
+	if template.Spec.TopologySpreadConstraints != nil {
+		t.Errorf("spread constraints = %+v, want none", template.Spec.TopologySpreadConstraints)
+	}
+
+	// so do spread constraints of the user
+	constraints := []corev1.TopologySpreadConstraint{{MaxSkew: 2, TopologyKey: corev1.LabelHostname, WhenUnsatisfiable: corev1.DoNotSchedule}}
+	template = &corev1.PodTemplateSpec{}
+	applyPodPolicy(template, databasev1.Policy{TopologySpreadConstraints: constraints}, selector)
+	if template.Spec.Affinity != nil || !reflect.DeepEqual(template.Spec.TopologySpreadConstraints, constraints) {
+		t.Errorf("affinity = %+v, spread constraints = %+v, want only the ones of the policy",
+			template.Spec.Affinity, template.Spec.TopologySpreadConstraints)
+	}
+
+	// the labels of the template win, the selector depends on them
+	template = &corev1.PodTemplateSpec{}
+	template.Labels = map[string]string{"app": "mysql"}
+	applyPodPolicy(template, databasev1.Policy{Labels: map[string]string{"app": "other", "team": "db"}}, selector)
+	if !reflect.DeepEqual(template.Labels, map[string]string{"app": "mysql", "team": "db"}) {
+		t.Errorf("labels = %v, want the selector labels kept", template.Labels)
+	}
+}
@@ -2,12 +2,20 @@ package innodbcluster
 
 import (
 	databasev1 "axe/api/v1"
+	"strconv"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// RouterRWPortName is the name of the read write port of the router container.
+	RouterRWPortName = "router-rw"
+	// RouterROPortName is the name of the read only port of the router container.
+	RouterROPortName = "router-ro"
+)
+
 //  docker run \
 //   -e MYSQL_HOST=localhost \
 //   -e MYSQL_PORT=3306 \
@@ -25,23 +33,36 @@ import (
 //		clusterHost = clusterHost + ins.Name + "-" + strconv.Itoa(0) + "." + ins.Name + "." + ins.Namespace + ".svc.cluster.local"
 //		return clusterHost
 //	}
-func Routercontainer(ins *databasev1.Mysql) []corev1.Container {
+func Routercontainer(ins *databasev1.Mysql, config map[string]string) []corev1.Container {
 	return []corev1.Container{
 		{
 			Name:            ins.Name + "-router",
 			Image:           ins.Spec.Router.RouterImage,
-			ImagePullPolicy: ins.Spec.PodPolicy.ImagePullPolicy,
+			ImagePullPolicy: RouterPodPolicy(ins).ImagePullPolicy,
+			// the services target the ports by name, so bind_port can be changed in routerConf
 			Ports: []corev1.ContainerPort{
 				{
-					Name:          "mysql-router",
-					ContainerPort: 6446,
+					Name:          RouterRWPortName,
+					ContainerPort: RouterPort(config, "routing:bootstrap_rw", 6446),
+				},
+				{
+					Name:          RouterROPortName,
+					ContainerPort: RouterPort(config, "routing:bootstrap_ro", 6447),
+				},
+				{
+					Name:          "router-x-rw",
+					ContainerPort: RouterPort(config, "routing:bootstrap_x_rw", 6448),
+				},
+				{
+					Name:          "router-x-ro",
+					ContainerPort: RouterPort(config, "routing:bootstrap_x_ro", 6449),
 				},
 			},
 			// 设置必要的环境变量
 			Env: []corev1.EnvVar{
 				{
 					Name:  "MYSQL_HOST",
-					Value: ins.Name + "." + ins.Namespace + ".svc.cluster.local",
+					Value: ServiceHost(ins),
 				},
 				{
 					Name:  "MYSQL_PORT",
@@ -55,29 +76,29 @@ func Routercontainer(ins *databasev1.Mysql) []corev1.Container {
 					Name:  "MYSQL_CREATE_ROUTER_USER",
 					Value: "0",
 				},
-				{
-					Name:  "MYSQL_PASSWORD",
-					Value: ins.Spec.Mysql.RootPassword,
-				},
+				secretEnv(ins, "MYSQL_PASSWORD", RootPasswordKey, false),
 				{
 					Name:  "MYSQL_INNODB_CLUSTER_MEMBERS",
-					Value: "3",
+					Value: strconv.Itoa(int(ins.Spec.Replica)),
 				},
 				{
 					//https://dev.mysql.com/doc/mysql-router/8.3/en/mysql-router-installation-docker.html
 					//https://github.com/mysql/mysql-operator/blob/trunk/mysqloperator/controller/innodbcluster/router_objects.py
 					Name:  "MYSQL_ROUTER_BOOTSTRAP_EXTRA_OPTIONS",
-					Value: "--conf-set-option=DEFAULT.unknown_config_option=warning --conf-set-option=DEFAULT.max_total_connections=10240 ",
+					Value: RouterBootstrapOptions(config),
 				},
 				// 添加其他必要的环境变量
 			},
-			Resources: ins.Spec.Router.Resources,
+			VolumeMounts: tlsVolumeMounts(ins),
+			Resources:    ins.Spec.Router.Resources,
 		},
 	}
 }
 
 // 也可以其多个服务，独立提供访问
-func RouterDeployment(ins *databasev1.Mysql) *appsv1.Deployment {
+// config is the rendered router configmap data, its hash rolls the router pods on a change,
+// as does tlsHash, the hash of the certificates.
+func RouterDeployment(ins *databasev1.Mysql, config map[string]string, tlsHash string) *appsv1.Deployment {
 	if ins == nil || ins.Spec.Replica < 0 {
 		// 在实际场景中，应该处理这个错误，比如返回一个错误或记录日志
 		return nil
@@ -107,12 +128,15 @@ func RouterDeployment(ins *databasev1.Mysql) *appsv1.Deployment {
 						"clustername": ins.Name,
 						"app":         "mysql-router",
 					},
+					Annotations: podAnnotations(ConfigHash(config), tlsHash),
 				},
 				Spec: corev1.PodSpec{
-					Containers: Routercontainer(ins),
+					Containers: Routercontainer(ins, config),
+					Volumes:    tlsVolumes(ins),
 				},
 			},
 		},
 	}
+	applyPodPolicy(&RouterDeployment.Spec.Template, RouterPodPolicy(ins), RouterDeployment.Spec.Selector.MatchLabels)
 	return RouterDeployment
 }
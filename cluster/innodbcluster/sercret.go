@@ -2,23 +2,94 @@ package innodbcluster
 
 import (
 	databasev1 "axe/api/v1"
+	"crypto/rand"
+	"math/big"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func Mysqlsecret(ins *databasev1.Mysql) []corev1.Secret {
-	return []corev1.Secret{
-		{TypeMeta: metav1.TypeMeta{
+const (
+	// RootPasswordKey is the secret key of the mysql root password.
+	RootPasswordKey = "rootPassword"
+	// UserKey is the secret key of the application user.
+	UserKey = "user"
+	// PasswordKey is the secret key of the application user password.
+	PasswordKey = "password"
+
+	defaultMysqlUser = "axe"
+	passwordLength   = 24
+	passwordChars    = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// SecretName returns the name of the secret holding the mysql credentials,
+// either the one referenced by the user or the one generated by the operator.
+func SecretName(ins *databasev1.Mysql) string {
+	if ref := ins.Spec.Mysql.CredentialsSecretRef; ref != nil && ref.Name != "" {
+		return ref.Name
+	}
+	return ins.Name + "-secret"
+}
+
+// GeneratePassword returns a random alphanumeric password.
+func GeneratePassword() (string, error) {
+	max := big.NewInt(int64(len(passwordChars)))
+	b := make([]byte, passwordLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = passwordChars[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// Mysqlsecret builds the operator managed credentials secret with random passwords.
+// It must only be created once, the passwords are never rotated by the operator.
+func Mysqlsecret(ins *databasev1.Mysql) (*corev1.Secret, error) {
+	rootPassword, err := GeneratePassword()
+	if err != nil {
+		return nil, err
+	}
+	password, err := GeneratePassword()
+	if err != nil {
+		return nil, err
+	}
+
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
 			Kind:       "Secret",
 			APIVersion: "v1",
 		},
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      ins.Name,
-				Namespace: ins.Namespace,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SecretName(ins),
+			Namespace: ins.Namespace,
+			Labels: map[string]string{
+				"clustername": ins.Name,
+				"app":         databasev1.MYSQLAPP,
 			},
-			Data: map[string][]byte{
-				"rootpasswd": []byte(ins.Spec.Mysql.RootPassword),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			RootPasswordKey: []byte(rootPassword),
+			UserKey:         []byte(defaultMysqlUser),
+			PasswordKey:     []byte(password),
+		},
+	}, nil
+}
+
+// secretEnv returns an env var read from the credentials secret.
+func secretEnv(ins *databasev1.Mysql, name, key string, optional bool) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: SecretName(ins),
+				},
+				Key:      key,
+				Optional: &optional,
 			},
 		},
 	}
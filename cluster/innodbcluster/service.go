@@ -72,13 +72,13 @@ func RouterClusterSVC(ins *databasev1.Mysql) *corev1.Service {
 				{
 					Name:       "mysql-router-rw",
 					Port:       6446,
-					TargetPort: intstr.FromInt(6446),
+					TargetPort: intstr.FromString(RouterRWPortName),
 					Protocol:   corev1.ProtocolTCP,
 				},
 				{
 					Name:       "mysql-router-ro",
 					Port:       6447,
-					TargetPort: intstr.FromInt(6447),
+					TargetPort: intstr.FromString(RouterROPortName),
 					Protocol:   corev1.ProtocolTCP,
 				},
 			},
@@ -110,13 +110,13 @@ func RouterNodeSVC(ins *databasev1.Mysql) *corev1.Service {
 				{
 					Name:       "mysql-router-rw",
 					Port:       31001,
-					TargetPort: intstr.FromInt(6446),
+					TargetPort: intstr.FromString(RouterRWPortName),
 					Protocol:   corev1.ProtocolTCP,
 				},
 				{
 					Name:       "mysql-router-ro",
 					Port:       31002,
-					TargetPort: intstr.FromInt(6447),
+					TargetPort: intstr.FromString(RouterROPortName),
 					Protocol:   corev1.ProtocolTCP,
 				},
 			},
@@ -0,0 +1,262 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+	"axe/cluster/innodbcluster/dba"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// MemberInfo is the state of a member as seen by the member itself.
+type MemberInfo struct {
+	State        string
+	Role         string
+	GtidExecuted string
+	ReadOnly     bool
+	Lag          int64
+	// SinglePrimary is group_replication_single_primary_mode of the member.
+	SinglePrimary bool
+	// Weight is group_replication_member_weight of the member.
+	Weight int32
+}
+
+// memberQuery reads the local row of replication_group_members, there is none if
+// group replication never started on the member.
+const memberQuery = `
+SELECT IFNULL(m.MEMBER_STATE, 'OFFLINE'), IFNULL(m.MEMBER_ROLE, ''),
+       IFNULL(s.COUNT_TRANSACTIONS_REMOTE_IN_APPLIER_QUEUE, 0),
+       @@GLOBAL.gtid_executed, @@GLOBAL.super_read_only, @@GLOBAL.group_replication_single_primary_mode,
+       @@GLOBAL.group_replication_member_weight
+FROM (SELECT @@server_uuid AS id) u
+LEFT JOIN performance_schema.replication_group_members m ON m.MEMBER_ID = u.id
+LEFT JOIN performance_schema.replication_group_member_stats s ON s.MEMBER_ID = u.id`
+
+// sqlClient returns the client running the queries of the operator on the members, logged
+// in as root. The queries run where mysqlsh runs, with the local executor the operator
+// connects to the members itself.
+func sqlClient(ins *databasev1.Mysql, passwd string) *dba.Client {
+	if Executor == ExecutorLocal {
+		return dba.NewClient("root", passwd, nil)
+	}
+	return dba.NewClient("root", passwd, shellExecutor(ins))
+}
+
+// query runs q on the member on host and returns the rows of its result.
+func query(ctx context.Context, ins *databasev1.Mysql, host string, passwd string, q string) ([][]string, error) {
+	return sqlClient(ins, passwd).Query(ctx, host, net.JoinHostPort(host, "3306"), q)
+}
+
+// queryRow runs q on the member on host and returns the values of its only row.
+func queryRow(ctx context.Context, ins *databasev1.Mysql, host string, passwd string, q string, columns int) ([]string, error) {
+	rows, err := query(ctx, ins, host, passwd, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != 1 || len(rows[0]) != columns {
+		return nil, fmt.Errorf("unexpected result from %s: %q", host, rows)
+	}
+	return rows[0], nil
+}
+
+// boolValue parses a boolean variable.
+func boolValue(v string) bool {
+	return v == "1" || strings.EqualFold(v, "ON")
+}
+
+// intValues parses the integers of values into dest.
+func intValues(values []string, dest ...*int64) error {
+	for i, d := range dest {
+		n, err := strconv.ParseInt(values[i], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q: %w", values[i], err)
+		}
+		*d = n
+	}
+	return nil
+}
+
+// Ping reports whether mysql on host accepts connections.
+func Ping(ctx context.Context, ins *databasev1.Mysql, host string, passwd string) error {
+	_, err := queryRow(ctx, ins, host, passwd, "SELECT 1", 1)
+	return err
+}
+
+// QueryMember reads the group replication state of the member on host.
+// A member that can not be reached is reported as MISSING along with the error.
+func QueryMember(ctx context.Context, ins *databasev1.Mysql, host string, passwd string) (*MemberInfo, error) {
+	info := &MemberInfo{State: databasev1.MemberStateMissing}
+	row, err := queryRow(ctx, ins, host, passwd, memberQuery, 7)
+	if err != nil {
+		return info, err
+	}
+	var lag, weight int64
+	if err := intValues([]string{row[2], row[6]}, &lag, &weight); err != nil {
+		return info, err
+	}
+	return &MemberInfo{
+		State:         row[0],
+		Role:          row[1],
+		GtidExecuted:  row[3],
+		ReadOnly:      boolValue(row[4]),
+		Lag:           lag,
+		SinglePrimary: boolValue(row[5]),
+		Weight:        int32(weight),
+	}, nil
+}
+
+// ClusterInstances returns the addresses of the members registered in the cluster metadata.
+func ClusterInstances(ctx context.Context, ins *databasev1.Mysql, host string, passwd string) (map[string]bool, error) {
+	rows, err := query(ctx, ins, host, passwd, "SELECT address FROM mysql_innodb_cluster_metadata.instances")
+	if err != nil {
+		return nil, err
+	}
+	instances := map[string]bool{}
+	for _, row := range rows {
+		instances[row[0]] = true
+	}
+	return instances, nil
+}
+
+// ClusterMetadata returns the instances registered in the cluster metadata of host, nil if
+// there is no metadata schema on host.
+func ClusterMetadata(ctx context.Context, ins *databasev1.Mysql, host string, passwd string) (map[string]bool, error) {
+	instances, err := ClusterInstances(ctx, ins, host, passwd)
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && (me.Number == 1049 || me.Number == 1146) {
+		return nil, nil
+	}
+	return instances, err
+}
+
+// GtidSubset reports whether the gtid set sub is contained in set, it is evaluated on host.
+func GtidSubset(ctx context.Context, ins *databasev1.Mysql, host string, passwd string, sub, set string) (bool, error) {
+	row, err := queryRow(ctx, ins, host, passwd, "SELECT GTID_SUBSET("+dba.Quote(sub)+", "+dba.Quote(set)+")", 1)
+	if err != nil {
+		return false, err
+	}
+	return boolValue(row[0]), nil
+}
+
+const (
+	// CloneStateInProgress is the state of a clone that still copies the data or restarts
+	// the recipient.
+	CloneStateInProgress = "In Progress"
+	// CloneStateFailed is the state of a clone that failed, the recipient keeps its data.
+	CloneStateFailed = "Failed"
+)
+
+// CloneInfo is the last clone into the data directory of a member.
+type CloneInfo struct {
+	// State is Not Started, In Progress, Completed or Failed.
+	State string
+	// Source is the donor of the clone.
+	Source string
+	// Error is the message of a failed clone.
+	Error string
+}
+
+// CloneStatus reads performance_schema.clone_status of the member on host, nil if no data
+// was ever cloned into it.
+func CloneStatus(ctx context.Context, ins *databasev1.Mysql, host string, passwd string) (*CloneInfo, error) {
+	rows, err := query(ctx, ins, host, passwd,
+		"SELECT STATE, IFNULL(SOURCE, ''), IFNULL(ERROR_MESSAGE, '') FROM performance_schema.clone_status")
+	var me *mysql.MySQLError
+	switch {
+	case errors.As(err, &me) && me.Number == 1146:
+		// the table exists once the clone plugin is installed
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case len(rows) == 0:
+		return nil, nil
+	case len(rows[0]) != 3:
+		return nil, fmt.Errorf("unexpected result from %s: %q", host, rows)
+	}
+	return &CloneInfo{State: rows[0][0], Source: rows[0][1], Error: rows[0][2]}, nil
+}
+
+// groupReplicationQuery reads the effective group replication settings of a member.
+const groupReplicationQuery = `
+SELECT @@GLOBAL.group_replication_consistency, @@GLOBAL.group_replication_member_expel_timeout,
+       @@GLOBAL.group_replication_autorejoin_tries, @@GLOBAL.group_replication_exit_state_action,
+       @@GLOBAL.group_replication_member_weight, @@GLOBAL.group_replication_message_cache_size,
+       @@GLOBAL.group_replication_flow_control_mode, @@GLOBAL.group_replication_communication_stack,
+       @@GLOBAL.group_replication_ip_allowlist`
+
+// GroupReplicationSettings reads the group replication settings in effect on host.
+func GroupReplicationSettings(ctx context.Context, ins *databasev1.Mysql, host string, passwd string) (*databasev1.GroupReplication, error) {
+	row, err := queryRow(ctx, ins, host, passwd, groupReplicationQuery, 9)
+	if err != nil {
+		return nil, err
+	}
+	var expelTimeout, autoRejoinTries, memberWeight, messageCacheSize int64
+	if err := intValues([]string{row[1], row[2], row[4], row[5]}, &expelTimeout, &autoRejoinTries, &memberWeight,
+		&messageCacheSize); err != nil {
+		return nil, err
+	}
+	gr := &databasev1.GroupReplication{
+		Consistency:        row[0],
+		ExitStateAction:    row[3],
+		FlowControlMode:    row[6],
+		CommunicationStack: row[7],
+		IPAllowlist:        row[8],
+		MessageCacheSize:   resource.NewQuantity(messageCacheSize, resource.BinarySI).String(),
+	}
+	et, art, mw := int32(expelTimeout), int32(autoRejoinTries), int32(memberWeight)
+	gr.ExpelTimeout, gr.AutoRejoinTries, gr.MemberWeight = &et, &art, &mw
+	return gr, nil
+}
+
+// PersistedVariables returns the variables persisted on host whose name matches the LIKE
+// pattern, by name.
+func PersistedVariables(ctx context.Context, ins *databasev1.Mysql, host string, passwd string, like string) (map[string]string, error) {
+	rows, err := query(ctx, ins, host, passwd,
+		"SELECT VARIABLE_NAME, VARIABLE_VALUE FROM performance_schema.persisted_variables WHERE VARIABLE_NAME LIKE "+dba.Quote(like))
+	if err != nil {
+		return nil, err
+	}
+	variables := map[string]string{}
+	for _, row := range rows {
+		if len(row) != 2 {
+			return nil, fmt.Errorf("unexpected result from %s: %q", host, rows)
+		}
+		variables[row[0]] = row[1]
+	}
+	return variables, nil
+}
+
+// RoutedHost returns the hostname of the server a connection to addr ends up on, addr
+// being the read write port of a router. The query runs from the member on via.
+func RoutedHost(ctx context.Context, ins *databasev1.Mysql, via string, addr string, passwd string) (string, error) {
+	rows, err := sqlClient(ins, passwd).Query(ctx, via, addr, "SELECT @@hostname")
+	if err != nil {
+		return "", err
+	}
+	if len(rows) != 1 || len(rows[0]) != 1 {
+		return "", fmt.Errorf("unexpected result from %s: %q", addr, rows)
+	}
+	return rows[0][0], nil
+}
+
+// CascadingForeignKeys returns the foreign keys with cascading actions, they are not
+// supported in multi-primary mode.
+func CascadingForeignKeys(ctx context.Context, ins *databasev1.Mysql, host string, passwd string) ([]string, error) {
+	rows, err := query(ctx, ins, host, passwd, `SELECT CONCAT(CONSTRAINT_SCHEMA, '.', TABLE_NAME, '.', CONSTRAINT_NAME)
+FROM information_schema.REFERENTIAL_CONSTRAINTS
+WHERE UPDATE_RULE IN ('CASCADE', 'SET NULL') OR DELETE_RULE IN ('CASCADE', 'SET NULL')`)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, row := range rows {
+		keys = append(keys, row[0])
+	}
+	return keys, nil
+}
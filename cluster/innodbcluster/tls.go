@@ -0,0 +1,365 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// CACertKey is the secret key of the CA certificates the members verify each other with.
+	CACertKey = "ca.crt"
+	// TLSMountPath is where the certificate secret is mounted in the mysql and router containers.
+	TLSMountPath = "/etc/mysql/tls"
+
+	// TLSHashAnnotation is the pod template annotation holding the hash of the certificates,
+	// a renewed certificate rolls the pods one by one.
+	TLSHashAnnotation = "database.wufan/tls-hash"
+
+	// caDuration is the validity of the CA generated by the operator.
+	caDuration = 10 * 365 * 24 * time.Hour
+	tlsKeyBits = 2048
+	tlsVolume  = "tls"
+)
+
+// TLSSecretName returns the name of the secret holding the server certificate, either the
+// one referenced by the user or the one issued by cert-manager or the operator.
+func TLSSecretName(ins *databasev1.Mysql) string {
+	if ins.Spec.TLS != nil && ins.Spec.TLS.SecretName != "" {
+		return ins.Spec.TLS.SecretName
+	}
+	return ins.Name + "-tls"
+}
+
+// CASecretName returns the name of the secret holding the CA generated by the operator.
+func CASecretName(ins *databasev1.Mysql) string {
+	return ins.Name + "-ca"
+}
+
+// TLSDNSNames returns the host names the server certificate is valid for: every member the
+// cluster can scale to, so that scaling does not need a new certificate, the headless
+// service and the router services.
+func TLSDNSNames(ins *databasev1.Mysql) []string {
+	names := []string{ServiceHost(ins)}
+	for i := 0; i < databasev1.MaxReplica; i++ {
+		names = append(names, MemberHost(ins, i))
+	}
+	for _, svc := range []string{ins.Name + "-router", ins.Name + "-router-node"} {
+		names = append(names, svc, svc+"."+ins.Namespace, svc+"."+ins.Namespace+".svc",
+			svc+"."+ins.Namespace+".svc."+ClusterDomain)
+	}
+	return names
+}
+
+// tlsMysqlConf returns the mysqld options of the certificates.
+func tlsMysqlConf(ins *databasev1.Mysql) databasev1.MysqlConf {
+	if ins.Spec.TLS == nil {
+		return nil
+	}
+	return databasev1.MysqlConf{
+		"ssl_ca":   TLSMountPath + "/" + CACertKey,
+		"ssl_cert": TLSMountPath + "/" + corev1.TLSCertKey,
+		"ssl_key":  TLSMountPath + "/" + corev1.TLSPrivateKeyKey,
+	}
+}
+
+// tlsGroupReplicationVariables returns the group replication variables that make the
+// members verify the host name of each other, for the group and the recovery connections.
+func tlsGroupReplicationVariables(ins *databasev1.Mysql) map[string]string {
+	if ins.Spec.TLS == nil {
+		return nil
+	}
+	return map[string]string{
+		"group_replication_ssl_mode":                        "VERIFY_IDENTITY",
+		"group_replication_recovery_use_ssl":                "ON",
+		"group_replication_recovery_ssl_verify_server_cert": "ON",
+		"group_replication_recovery_ssl_ca":                 TLSMountPath + "/" + CACertKey,
+	}
+}
+
+// tlsPluginConf returns the group replication variables of the certificates for plugin.cnf.
+func tlsPluginConf(ins *databasev1.Mysql) databasev1.MysqlConf {
+	conf := databasev1.MysqlConf{}
+	for name, value := range tlsGroupReplicationVariables(ins) {
+		conf["loose-"+name] = value
+	}
+	return conf
+}
+
+// TLSVariableChanges returns the group replication TLS variables to persist on a member,
+// given the ones persisted there. The AdminAPI persists the ssl mode of the cluster, which
+// takes precedence over plugin.cnf, so it is changed when spec.tls is added or removed.
+func TLSVariableChanges(ins *databasev1.Mysql, persisted map[string]string) []VariableChange {
+	var changes []VariableChange
+	if ins.Spec.TLS == nil {
+		// without the certificates the members can not verify each other
+		if strings.HasPrefix(strings.ToUpper(persisted["group_replication_ssl_mode"]), "VERIFY_") {
+			changes = append(changes, VariableChange{Name: "group_replication_ssl_mode", Value: "REQUIRED"})
+		}
+		if strings.EqualFold(persisted["group_replication_recovery_ssl_verify_server_cert"], "ON") {
+			changes = append(changes, VariableChange{Name: "group_replication_recovery_ssl_verify_server_cert", Value: "OFF"})
+		}
+		return changes
+	}
+	for name, value := range tlsGroupReplicationVariables(ins) {
+		if v, ok := persisted[name]; ok && !strings.EqualFold(v, value) {
+			changes = append(changes, VariableChange{Name: name, Value: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// routerTLSConf returns the router options of the certificates: clients are offered TLS
+// and the router always connects to the members with TLS, verifying their host name.
+func routerTLSConf(ins *databasev1.Mysql) map[string]databasev1.MysqlConf {
+	if ins.Spec.TLS == nil {
+		return nil
+	}
+	ca := TLSMountPath + "/" + CACertKey
+	return map[string]databasev1.MysqlConf{
+		"DEFAULT": {
+			"client_ssl_mode":   "PREFERRED",
+			"client_ssl_cert":   TLSMountPath + "/" + corev1.TLSCertKey,
+			"client_ssl_key":    TLSMountPath + "/" + corev1.TLSPrivateKeyKey,
+			"server_ssl_mode":   "REQUIRED",
+			"server_ssl_verify": "VERIFY_IDENTITY",
+			"server_ssl_ca":     ca,
+		},
+		"metadata_cache:bootstrap": {
+			"ssl_mode": "VERIFY_IDENTITY",
+			"ssl_ca":   ca,
+		},
+	}
+}
+
+// tlsVolumes returns the volume of the certificate secret, none without spec.tls.
+func tlsVolumes(ins *databasev1.Mysql) []corev1.Volume {
+	if ins.Spec.TLS == nil {
+		return nil
+	}
+	return []corev1.Volume{
+		{
+			Name: tlsVolume,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: TLSSecretName(ins),
+					Items: []corev1.KeyToPath{
+						{Key: CACertKey, Path: CACertKey},
+						{Key: corev1.TLSCertKey, Path: corev1.TLSCertKey},
+						{Key: corev1.TLSPrivateKeyKey, Path: corev1.TLSPrivateKeyKey},
+					},
+				},
+			},
+		},
+	}
+}
+
+// tlsVolumeMounts returns the mount of the certificate secret, none without spec.tls.
+func tlsVolumeMounts(ins *databasev1.Mysql) []corev1.VolumeMount {
+	if ins.Spec.TLS == nil {
+		return nil
+	}
+	return []corev1.VolumeMount{
+		{
+			Name:      tlsVolume,
+			MountPath: TLSMountPath,
+			ReadOnly:  true,
+		},
+	}
+}
+
+// podAnnotations returns the pod template annotations of the config and certificate hashes.
+func podAnnotations(configHash, tlsHash string) map[string]string {
+	annotations := map[string]string{
+		ConfigHashAnnotation: configHash,
+	}
+	if tlsHash != "" {
+		annotations[TLSHashAnnotation] = tlsHash
+	}
+	return annotations
+}
+
+// TLSHash returns a stable hash of the certificates of a secret.
+func TLSHash(data map[string][]byte) string {
+	return ConfigHash(map[string]string{
+		CACertKey:         string(data[CACertKey]),
+		corev1.TLSCertKey: string(data[corev1.TLSCertKey]),
+	})
+}
+
+// GenerateCA returns a self-signed CA certificate and its key, PEM encoded.
+func GenerateCA(ins *databasev1.Mysql, now time.Time) ([]byte, []byte, error) {
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: ins.Name + "-ca", Organization: []string{ins.Namespace}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caDuration),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	return createCertificate(template, nil, nil)
+}
+
+// IssueCertificate returns a server certificate for TLSDNSNames signed by the CA, and its
+// key, PEM encoded. The certificate is also a client certificate, the members connect to
+// each other with it. It never outlives the CA.
+func IssueCertificate(ins *databasev1.Mysql, caCert, caKey []byte, now time.Time) ([]byte, []byte, error) {
+	ca, err := ParseCertificate(caCert)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(caKey)
+	if block == nil {
+		return nil, nil, fmt.Errorf("failed to decode CA key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA key: %w", err)
+	}
+
+	notAfter := now.Add(ins.Spec.TLS.Duration.Duration)
+	if notAfter.After(ca.NotAfter) {
+		notAfter = ca.NotAfter
+	}
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: ServiceHost(ins), Organization: []string{ins.Namespace}},
+		DNSNames:    TLSDNSNames(ins),
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	return createCertificate(template, ca, key)
+}
+
+// createCertificate signs template with parent and its key, it is self-signed if parent is nil.
+func createCertificate(template, parent *x509.Certificate, parentKey *rsa.PrivateKey) ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, tlsKeyBits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	template.SerialNumber = serial
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate %s: %w", template.Subject.CommonName, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+}
+
+// ParseCertificate returns the first certificate of a PEM bundle.
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// ParseCertificates returns the certificates of a PEM bundle, the blocks that are no
+// certificate are skipped.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// TLSSecret builds a secret of certificates generated by the operator.
+func TLSSecret(ins *databasev1.Mysql, name string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ins.Namespace,
+			Labels: map[string]string{
+				"clustername": ins.Name,
+				"app":         databasev1.MYSQLAPP,
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: data,
+	}
+}
+
+// Certificate builds the cert-manager Certificate of spec.tls.issuerRef. cert-manager
+// renews it renewBefore its expiry into the secret TLSSecretName.
+func Certificate(ins *databasev1.Mysql) *unstructured.Unstructured {
+	tls := ins.Spec.TLS
+	var dnsNames []interface{}
+	for _, name := range TLSDNSNames(ins) {
+		dnsNames = append(dnsNames, name)
+	}
+	cert := &unstructured.Unstructured{}
+	cert.SetAPIVersion("cert-manager.io/v1")
+	cert.SetKind("Certificate")
+	cert.SetName(TLSSecretName(ins))
+	cert.SetNamespace(ins.Namespace)
+	cert.SetLabels(map[string]string{
+		"clustername": ins.Name,
+		"app":         databasev1.MYSQLAPP,
+	})
+	cert.Object["spec"] = map[string]interface{}{
+		"secretName":  TLSSecretName(ins),
+		"commonName":  ServiceHost(ins),
+		"dnsNames":    dnsNames,
+		"duration":    tls.Duration.Duration.String(),
+		"renewBefore": tls.RenewBefore.Duration.String(),
+		"usages":      []interface{}{"server auth", "client auth"},
+		"privateKey": map[string]interface{}{
+			"algorithm":      "RSA",
+			"size":           int64(tlsKeyBits),
+			"rotationPolicy": "Always",
+		},
+		"issuerRef": map[string]interface{}{
+			"name":  tls.IssuerRef.Name,
+			"kind":  tls.IssuerRef.Kind,
+			"group": tls.IssuerRef.Group,
+		},
+	}
+	return cert
+}
+
+// VerifyCertificate checks that cert is valid now and for the host names of the members.
+func VerifyCertificate(ins *databasev1.Mysql, cert *x509.Certificate, now time.Time) error {
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate %s expired at %s", cert.Subject.CommonName, cert.NotAfter)
+	}
+	for i := 0; i < int(ins.Spec.Replica); i++ {
+		if err := cert.VerifyHostname(MemberHost(ins, i)); err != nil {
+			return fmt.Errorf("certificate %s: %w", cert.Subject.CommonName, err)
+		}
+	}
+	return nil
+}
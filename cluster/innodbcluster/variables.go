@@ -0,0 +1,334 @@
+package innodbcluster
+
+import (
+	databasev1 "axe/api/v1"
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dynamicVariables are the mysql 8.0 system variables that can be changed at runtime
+// with SET PERSIST. Variables missing here are static, changing them restarts the members.
+// Dynamic variables that need replication or group replication to be stopped are
+// left out on purpose.
+var dynamicVariables = map[string]bool{
+	// connections
+	"max_connections":      true,
+	"max_connect_errors":   true,
+	"max_user_connections": true,
+	"connect_timeout":      true,
+	"interactive_timeout":  true,
+	"wait_timeout":         true,
+	"net_read_timeout":     true,
+	"net_write_timeout":    true,
+	"net_retry_count":      true,
+	"net_buffer_length":    true,
+	"max_allowed_packet":   true,
+	"thread_cache_size":    true,
+	"host_cache_size":      true,
+	"lock_wait_timeout":    true,
+	"max_execution_time":   true,
+	"max_error_count":      true,
+	"local_infile":         true,
+
+	// caches and buffers
+	"table_open_cache":             true,
+	"table_definition_cache":       true,
+	"schema_definition_cache":      true,
+	"stored_program_cache":         true,
+	"sort_buffer_size":             true,
+	"join_buffer_size":             true,
+	"read_buffer_size":             true,
+	"read_rnd_buffer_size":         true,
+	"bulk_insert_buffer_size":      true,
+	"key_buffer_size":              true,
+	"preload_buffer_size":          true,
+	"tmp_table_size":               true,
+	"max_heap_table_size":          true,
+	"temptable_max_ram":            true,
+	"temptable_use_mmap":           true,
+	"select_into_buffer_size":      true,
+	"transaction_prealloc_size":    true,
+	"transaction_alloc_block_size": true,
+	"query_alloc_block_size":       true,
+	"query_prealloc_size":          true,
+	"max_prepared_stmt_count":      true,
+	"max_sort_length":              true,
+	"max_length_for_sort_data":     true,
+	"max_seeks_for_key":            true,
+	"max_write_lock_count":         true,
+	"max_sp_recursion_depth":       true,
+	"group_concat_max_len":         true,
+	"cte_max_recursion_depth":      true,
+
+	// sql behaviour
+	"sql_mode":                        true,
+	"transaction_isolation":           true,
+	"autocommit":                      true,
+	"character_set_server":            true,
+	"collation_server":                true,
+	"default_storage_engine":          true,
+	"default_tmp_storage_engine":      true,
+	"internal_tmp_mem_storage_engine": true,
+	"explicit_defaults_for_timestamp": true,
+	"sql_require_primary_key":         true,
+	"div_precision_increment":         true,
+	"event_scheduler":                 true,
+	"log_bin_trust_function_creators": true,
+	"information_schema_stats_expiry": true,
+	"optimizer_switch":                true,
+	"optimizer_search_depth":          true,
+	"optimizer_prune_level":           true,
+	"range_optimizer_max_mem_size":    true,
+	"eq_range_index_dive_limit":       true,
+	"regexp_time_limit":               true,
+	"regexp_stack_limit":              true,
+	"activate_all_roles_on_login":     true,
+	"mandatory_roles":                 true,
+	"automatic_sp_privileges":         true,
+	"default_password_lifetime":       true,
+	"password_history":                true,
+	"password_reuse_interval":         true,
+
+	// logs
+	"log_timestamps":                         true,
+	"log_error_verbosity":                    true,
+	"log_error_suppression_list":             true,
+	"log_output":                             true,
+	"general_log":                            true,
+	"general_log_file":                       true,
+	"slow_query_log":                         true,
+	"slow_query_log_file":                    true,
+	"log_slow_extra":                         true,
+	"long_query_time":                        true,
+	"log_queries_not_using_indexes":          true,
+	"log_throttle_queries_not_using_indexes": true,
+	"min_examined_row_limit":                 true,
+	"log_slow_admin_statements":              true,
+	"log_slow_slave_statements":              true,
+	"log_slow_replica_statements":            true,
+
+	// binary log
+	"binlog_format":                           true,
+	"binlog_row_image":                        true,
+	"binlog_cache_size":                       true,
+	"binlog_stmt_cache_size":                  true,
+	"max_binlog_cache_size":                   true,
+	"max_binlog_stmt_cache_size":              true,
+	"max_binlog_size":                         true,
+	"binlog_rows_query_log_events":            true,
+	"binlog_expire_logs_seconds":              true,
+	"binlog_checksum":                         true,
+	"binlog_order_commits":                    true,
+	"binlog_group_commit_sync_delay":          true,
+	"binlog_group_commit_sync_no_delay_count": true,
+	"binlog_transaction_compression":          true,
+	"binlog_transaction_dependency_tracking":  true,
+	"binlog_error_action":                     true,
+	"sync_binlog":                             true,
+	"slave_checkpoint_period":                 true,
+	"replica_checkpoint_period":               true,
+	"slave_net_timeout":                       true,
+	"replica_net_timeout":                     true,
+	"rpl_read_size":                           true,
+
+	// innodb
+	"innodb_buffer_pool_size":              true,
+	"innodb_buffer_pool_dump_pct":          true,
+	"innodb_buffer_pool_dump_at_shutdown":  true,
+	"innodb_flush_log_at_trx_commit":       true,
+	"innodb_log_buffer_size":               true,
+	"innodb_max_undo_log_size":             true,
+	"innodb_undo_log_truncate":             true,
+	"innodb_purge_rseg_truncate_frequency": true,
+	"innodb_max_purge_lag":                 true,
+	"innodb_max_purge_lag_delay":           true,
+	"innodb_io_capacity":                   true,
+	"innodb_io_capacity_max":               true,
+	"innodb_lru_scan_depth":                true,
+	"innodb_flush_neighbors":               true,
+	"innodb_max_dirty_pages_pct":           true,
+	"innodb_max_dirty_pages_pct_lwm":       true,
+	"innodb_adaptive_flushing":             true,
+	"innodb_adaptive_flushing_lwm":         true,
+	"innodb_flushing_avg_loops":            true,
+	"innodb_adaptive_hash_index":           true,
+	"innodb_change_buffering":              true,
+	"innodb_change_buffer_max_size":        true,
+	"innodb_old_blocks_pct":                true,
+	"innodb_old_blocks_time":               true,
+	"innodb_read_ahead_threshold":          true,
+	"innodb_random_read_ahead":             true,
+	"innodb_thread_concurrency":            true,
+	"innodb_concurrency_tickets":           true,
+	"innodb_spin_wait_delay":               true,
+	"innodb_sync_spin_loops":               true,
+	"innodb_lock_wait_timeout":             true,
+	"innodb_deadlock_detect":               true,
+	"innodb_print_all_deadlocks":           true,
+	"innodb_online_alter_log_max_size":     true,
+	"innodb_print_ddl_logs":                true,
+	"innodb_status_output":                 true,
+	"innodb_status_output_locks":           true,
+	"innodb_stats_persistent":              true,
+	"innodb_stats_on_metadata":             true,
+	"innodb_stats_auto_recalc":             true,
+	"innodb_strict_mode":                   true,
+	"innodb_table_locks":                   true,
+	"innodb_file_per_table":                true,
+	"innodb_default_row_format":            true,
+	"innodb_fast_shutdown":                 true,
+	"innodb_disable_sort_file_cache":       true,
+	"innodb_fill_factor":                   true,
+
+	// group replication, the other settings are applied as cluster options
+	"group_replication_flow_control_mode":  true,
+	"group_replication_message_cache_size": true,
+}
+
+// IsDynamicVariable reports whether the mysqld option can be changed without a restart.
+func IsDynamicVariable(option string) bool {
+	return dynamicVariables[databasev1.NormalizeMysqlOption(option)]
+}
+
+// VariableChange is a mysqld option whose value differs between two rendered configs.
+type VariableChange struct {
+	// Name is the normalized option name.
+	Name string
+	// Value is the new value, empty for a bare flag or if Removed.
+	Value   string
+	Removed bool
+	Dynamic bool
+}
+
+// mysqldOptions returns the [mysqld] options of the rendered config by normalized name.
+// conf.d is read in file name order, so plugin.cnf overrides mysql.cnf.
+func mysqldOptions(data map[string]string) map[string]string {
+	options := map[string]string{}
+	for _, key := range []string{MysqlCnfKey, PluginCnfKey} {
+		for _, o := range iniOptions(data[key]) {
+			if o.Section == "mysqld" {
+				options[databasev1.NormalizeMysqlOption(o.Name)] = o.Value
+			}
+		}
+	}
+	return options
+}
+
+// DiffMysqlConfig returns the mysqld options changed from the old to the new rendered
+// config, sorted by name.
+func DiffMysqlConfig(old, new map[string]string) []VariableChange {
+	before, after := mysqldOptions(old), mysqldOptions(new)
+
+	var changes []VariableChange
+	for name, value := range after {
+		if v, ok := before[name]; !ok || v != value {
+			changes = append(changes, VariableChange{Name: name, Value: value, Dynamic: dynamicVariables[name]})
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, VariableChange{Name: name, Removed: true, Dynamic: dynamicVariables[name]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// StaticConfigData returns the rendered config without the dynamic [mysqld] options.
+// Its hash only changes when the members have to be restarted.
+func StaticConfigData(data map[string]string) map[string]string {
+	static := make(map[string]string, len(data))
+	for k, v := range data {
+		static[k] = v
+	}
+	for _, key := range []string{MysqlCnfKey, PluginCnfKey} {
+		var lines []string
+		section := ""
+		for _, line := range strings.Split(data[key], "\n") {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+				section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			} else if section == "mysqld" && trimmed != "" && trimmed[0] != '#' && trimmed[0] != ';' {
+				name, _, _ := strings.Cut(trimmed, "=")
+				if IsDynamicVariable(name) {
+					continue
+				}
+			}
+			lines = append(lines, line)
+		}
+		static[key] = strings.Join(lines, "\n")
+	}
+	return static
+}
+
+var (
+	numberValue = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+	sizeValue   = regexp.MustCompile(`^([0-9]+)([KkMmGg])$`)
+	nameValue   = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+)
+
+// sqlValue converts an option file value to a SET statement value. Size suffixes are
+// only understood in option files, strings are quoted. A bare flag enables the option.
+func sqlValue(value string) string {
+	if value == "" {
+		return "ON"
+	}
+	if numberValue.MatchString(value) {
+		return value
+	}
+	if m := sizeValue.FindStringSubmatch(value); m != nil {
+		n, _ := strconv.ParseInt(m[1], 10, 64)
+		switch strings.ToUpper(m[2]) {
+		case "K":
+			n <<= 10
+		case "M":
+			n <<= 20
+		case "G":
+			n <<= 30
+		}
+		return strconv.FormatInt(n, 10)
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// SetPersistVariable applies a dynamic variable on host and persists it across restarts.
+// A removed variable is no longer persisted and set to its compiled-in default, the value
+// a restart gives now that the option files do not set it.
+func SetPersistVariable(ctx context.Context, ins *databasev1.Mysql, host string, passwd string, change VariableChange) error {
+	if !nameValue.MatchString(change.Name) {
+		return fmt.Errorf("invalid variable name %q", change.Name)
+	}
+	client := sqlClient(ins, passwd)
+	addr := net.JoinHostPort(host, "3306")
+	if change.Removed {
+		if err := client.Exec(ctx, host, addr, "RESET PERSIST IF EXISTS "+change.Name,
+			"SET GLOBAL "+change.Name+" = DEFAULT"); err != nil {
+			return fmt.Errorf("failed to reset %s on %s: %w", change.Name, host, err)
+		}
+		return nil
+	}
+	if err := client.Exec(ctx, host, addr, "SET PERSIST "+change.Name+" = "+sqlValue(change.Value)); err != nil {
+		return fmt.Errorf("failed to set %s on %s: %w", change.Name, host, err)
+	}
+	return nil
+}
+
+// PersistOnlyVariable persists a variable on host without changing its runtime value, it
+// takes effect when the member restarts.
+func PersistOnlyVariable(ctx context.Context, ins *databasev1.Mysql, host string, passwd string, change VariableChange) error {
+	if !nameValue.MatchString(change.Name) {
+		return fmt.Errorf("invalid variable name %q", change.Name)
+	}
+	err := sqlClient(ins, passwd).Exec(ctx, host, net.JoinHostPort(host, "3306"),
+		"SET PERSIST_ONLY "+change.Name+" = "+sqlValue(change.Value))
+	if err != nil {
+		return fmt.Errorf("failed to persist %s on %s: %w", change.Name, host, err)
+	}
+	return nil
+}
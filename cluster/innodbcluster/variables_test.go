@@ -0,0 +1,131 @@
+package innodbcluster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffMysqlConfig(t *testing.T) {
+	old := map[string]string{
+		MysqlCnfKey: `
+[mysqld]
+max_connections = 1000
+innodb-log-file-size = 1G
+slow_query_log = ON
+long_query_time = 2
+
+[client]
+default-character-set = utf8mb4
+`,
+		PluginCnfKey: `
+[mysqld]
+loose-group_replication_message_cache_size = 1073741824
+`,
+	}
+	new := map[string]string{
+		MysqlCnfKey: `
+[mysqld]
+max_connections = 2000
+innodb_log_file_size = 2G
+long_query_time = 2
+innodb_flush_method = O_DIRECT
+log_slow_extra
+# slow_query_log = ON
+
+[client]
+default-character-set = latin1
+`,
+		PluginCnfKey: `
+[mysqld]
+loose-group_replication_message_cache_size = 1073741824
+max_connections = 3000
+`,
+	}
+	want := []VariableChange{
+		{Name: "innodb_flush_method", Value: "O_DIRECT"},
+		{Name: "innodb_log_file_size", Value: "2G"},
+		// a bare flag is set, not removed
+		{Name: "log_slow_extra", Dynamic: true},
+		// plugin.cnf is read after mysql.cnf
+		{Name: "max_connections", Value: "3000", Dynamic: true},
+		{Name: "slow_query_log", Removed: true, Dynamic: true},
+	}
+	if got := DiffMysqlConfig(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffMysqlConfig =\n%+v\nwant\n%+v", got, want)
+	}
+	if got := DiffMysqlConfig(new, new); len(got) != 0 {
+		t.Errorf("DiffMysqlConfig of the same config = %+v", got)
+	}
+}
+
+func TestStaticConfigData(t *testing.T) {
+	data := map[string]string{
+		MysqlCnfKey: `[mysqld]
+max_connections = 1000
+innodb_log_file_size = 1G
+# max_connections = 10
+slow-query-log = ON
+
+[client]
+max_connections = 5
+`,
+		PluginCnfKey: `[mysqld]
+loose-group_replication_flow_control_mode = QUOTA
+loose-plugin_load_add = 'group_replication.so'
+`,
+		InitSQLKey: "SELECT 1;",
+	}
+	got := StaticConfigData(data)
+	want := map[string]string{
+		MysqlCnfKey: `[mysqld]
+innodb_log_file_size = 1G
+# max_connections = 10
+
+[client]
+max_connections = 5
+`,
+		PluginCnfKey: `[mysqld]
+loose-plugin_load_add = 'group_replication.so'
+`,
+		InitSQLKey: "SELECT 1;",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StaticConfigData =\n%v\nwant\n%v", got, want)
+	}
+
+	// a dynamic change keeps the hash, a static one changes it
+	dynamic := map[string]string{MysqlCnfKey: strings.Replace(data[MysqlCnfKey], "max_connections = 1000", "max_connections = 2000", 1),
+		PluginCnfKey: data[PluginCnfKey], InitSQLKey: data[InitSQLKey]}
+	if ConfigHash(StaticConfigData(dynamic)) != ConfigHash(got) {
+		t.Error("dynamic change changes the static config hash")
+	}
+	static := map[string]string{MysqlCnfKey: strings.Replace(data[MysqlCnfKey], "1G", "2G", 1),
+		PluginCnfKey: data[PluginCnfKey], InitSQLKey: data[InitSQLKey]}
+	if ConfigHash(StaticConfigData(static)) == ConfigHash(got) {
+		t.Error("static change keeps the static config hash")
+	}
+}
+
+func TestSQLValue(t *testing.T) {
+	for _, tc := range []struct {
+		value, want string
+	}{
+		{"1000", "1000"},
+		{"-1", "-1"},
+		{"0.5", "0.5"},
+		{"16K", "16384"},
+		{"128M", "134217728"},
+		{"1g", "1073741824"},
+		{"ON", "'ON'"},
+		{"O_DIRECT", "'O_DIRECT'"},
+		{"1.5G", "'1.5G'"},
+		{"it's", "'it''s'"},
+		{`C:\tmp`, `'C:\\tmp'`},
+		{"", "ON"},
+	} {
+		if got := sqlValue(tc.value); got != tc.want {
+			t.Errorf("sqlValue(%q) = %s, want %s", tc.value, got, tc.want)
+		}
+	}
+}
@@ -27,6 +27,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
@@ -35,6 +36,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
 	"axe/internal/controller"
 	//+kubebuilder:scaffold:imports
 )
@@ -57,6 +59,9 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var maxConcurrentReconciles int
+	var clusterBackend string
+	var shellExecutor string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -66,6 +71,15 @@ func main() {
 		"If set the metrics endpoint is served securely")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 4,
+		"The number of mysql clusters reconciled in parallel.")
+	flag.StringVar(&clusterBackend, "cluster-backend", innodbcluster.Backend,
+		"How the innodb clusters are managed, mysqlsh or sql. sql connects to the members from the operator.")
+	flag.StringVar(&shellExecutor, "shell-executor", innodbcluster.Executor,
+		"Where mysqlsh and the queries of the operator run: exec in the member containers, job in a job per "+
+			"command or local in the operator, which then needs mysqlsh and to reach the members.")
+	flag.StringVar(&innodbcluster.ClusterDomain, "cluster-domain", innodbcluster.ClusterDomain,
+		"The dns domain of the kubernetes cluster, used in the host names of the members.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -74,6 +88,19 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if clusterBackend != innodbcluster.BackendShell && clusterBackend != innodbcluster.BackendSQL {
+		setupLog.Error(nil, "unknown cluster backend", "cluster-backend", clusterBackend)
+		os.Exit(1)
+	}
+	innodbcluster.Backend = clusterBackend
+	switch shellExecutor {
+	case innodbcluster.ExecutorLocal, innodbcluster.ExecutorPod, innodbcluster.ExecutorJob:
+		innodbcluster.Executor = shellExecutor
+	default:
+		setupLog.Error(nil, "unknown shell executor", "shell-executor", shellExecutor)
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -122,13 +149,55 @@ func main() {
 		os.Exit(1)
 	}
 
+	innodbcluster.KubeConfig = mgr.GetConfig()
+	if innodbcluster.KubeClient, err = kubernetes.NewForConfig(mgr.GetConfig()); err != nil {
+		setupLog.Error(err, "unable to create kubernetes client")
+		os.Exit(1)
+	}
+
 	if err = (&controller.MysqlReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorderFor("mysql-controller"),
+		MaxConcurrentReconciles: maxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Mysql")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&databasev1.Mysql{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Mysql")
+			os.Exit(1)
+		}
+	}
+	if err = (&controller.MysqlBackupReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("mysqlbackup-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MysqlBackup")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&databasev1.MysqlBackup{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "MysqlBackup")
+			os.Exit(1)
+		}
+	}
+	if err = (&controller.MysqlBackupScheduleReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("mysqlbackupschedule-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MysqlBackupSchedule")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&databasev1.MysqlBackupSchedule{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "MysqlBackupSchedule")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	databasev1 "axe/api/v1"
+)
+
+const (
+	// FieldManager owns the fields of the objects applied by the operator.
+	FieldManager = "axe-operator"
+	// appliedHashAnnotation is the hash of the configuration last applied to an object.
+	appliedHashAnnotation = "database.wufan/applied-hash"
+)
+
+// Apply creates or updates obj with server-side apply, the fields set by other managers,
+// e.g. the allocated node ports, are left alone. obj is owned by the cluster, so it is
+// garbage collected with it.
+//
+// The write is skipped when the configuration is the one applied last and the object still
+// holds it, so a reconcile without changes does not reach the api server.
+func Apply(ctx context.Context, c client.Client, ins *databasev1.Mysql, obj client.Object) error {
+	if obj == nil {
+		return fmt.Errorf("object to apply must not be nil")
+	}
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return fmt.Errorf("failed to get kind of %s: %w", obj.GetName(), err)
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	if err := controllerutil.SetControllerReference(ins, obj, c.Scheme()); err != nil {
+		return fmt.Errorf("failed to set owner of %s: %w", obj.GetName(), err)
+	}
+	hash, err := appliedHash(obj)
+	if err != nil {
+		return err
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[appliedHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+
+	// a fresh object, decoding into obj would keep the fields removed from the existing one
+	existing := obj.DeepCopyObject().(client.Object)
+	reflect.ValueOf(existing).Elem().Set(reflect.Zero(reflect.TypeOf(existing).Elem()))
+	existing.GetObjectKind().SetGroupVersionKind(gvk)
+	err = c.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	switch {
+	case apierrors.IsNotFound(err):
+		log.Log.Info("create resource", "objspeace", obj.GetNamespace(), "objtype", gvk.Kind, "objname", obj.GetName())
+	case err != nil:
+		return fmt.Errorf("failed to get existing %s %s: %w", gvk.Kind, obj.GetName(), err)
+	default:
+		drifted, err := driftedFields(obj, existing)
+		if err != nil {
+			return err
+		}
+		if existing.GetAnnotations()[appliedHashAnnotation] == hash && len(drifted) == 0 {
+			return nil
+		}
+		log.Log.Info("apply resource", "objspeace", obj.GetNamespace(), "objtype", gvk.Kind, "objname", obj.GetName())
+		log.Log.V(1).Info("apply diff", "objname", obj.GetName(), "objtype", gvk.Kind,
+			"configChanged", existing.GetAnnotations()[appliedHashAnnotation] != hash, "fields", drifted)
+	}
+
+	obj.SetResourceVersion("")
+	obj.SetManagedFields(nil)
+	if err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+		return fmt.Errorf("failed to apply %s %s: %w", gvk.Kind, obj.GetName(), err)
+	}
+	return nil
+}
+
+// appliedHash returns a stable hash of the configuration of obj.
+func appliedHash(obj client.Object) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s: %w", obj.GetName(), err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// driftedFields returns the paths of the fields of desired that hold another value in
+// existing, e.g. after an edit by hand. Only the spec like fields and the labels,
+// annotations and owners are compared. Zero values are skipped, the server defaults them.
+func driftedFields(desired, existing client.Object) ([]string, error) {
+	d, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s: %w", desired.GetName(), err)
+	}
+	e, err := runtime.DefaultUnstructuredConverter.ToUnstructured(existing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s: %w", existing.GetName(), err)
+	}
+	for _, m := range []map[string]interface{}{d, e} {
+		delete(m, "status")
+		if meta, ok := m["metadata"].(map[string]interface{}); ok {
+			m["metadata"] = map[string]interface{}{
+				"labels":          meta["labels"],
+				"annotations":     meta["annotations"],
+				"ownerReferences": meta["ownerReferences"],
+			}
+		}
+	}
+	return drifted("", d, e), nil
+}
+
+func drifted(path string, desired, existing interface{}) []string {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		e, _ := existing.(map[string]interface{})
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var paths []string
+		for _, k := range keys {
+			paths = append(paths, drifted(path+"."+k, d[k], e[k])...)
+		}
+		return paths
+	case []interface{}:
+		e, _ := existing.([]interface{})
+		if len(d) != len(e) {
+			return []string{path}
+		}
+		var paths []string
+		for i := range d {
+			paths = append(paths, drifted(path+"["+strconv.Itoa(i)+"]", d[i], e[i])...)
+		}
+		return paths
+	}
+	if desired == nil || reflect.ValueOf(desired).IsZero() || reflect.DeepEqual(desired, existing) {
+		return nil
+	}
+	return []string{path}
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func testConfigMap(data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql-mysql", Namespace: "default", Labels: map[string]string{"app": "mysql"}},
+		Data:       data,
+	}
+}
+
+func TestApply(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// edit changes the applied object out of band
+		edit      func(cm *corev1.ConfigMap)
+		desired   map[string]string
+		wantWrite bool
+	}{
+		{
+			name:    "unchanged config without drift is skipped",
+			desired: map[string]string{"my.cnf": "a"},
+		},
+		{
+			name:      "changed config is written",
+			desired:   map[string]string{"my.cnf": "b"},
+			wantWrite: true,
+		},
+		{
+			name:      "edited field is written back",
+			edit:      func(cm *corev1.ConfigMap) { cm.Data["my.cnf"] = "edited" },
+			desired:   map[string]string{"my.cnf": "a"},
+			wantWrite: true,
+		},
+		{
+			name:      "removed label is written back",
+			edit:      func(cm *corev1.ConfigMap) { delete(cm.Labels, "app") },
+			desired:   map[string]string{"my.cnf": "a"},
+			wantWrite: true,
+		},
+		{
+			name: "fields set by others are left alone",
+			edit: func(cm *corev1.ConfigMap) {
+				cm.Data["other"] = "x"
+				cm.Labels["team"] = "db"
+			},
+			desired: map[string]string{"my.cnf": "a"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := newMemoryClient(t)
+			ins := tlsMysql()
+			if err := Apply(ctx, c, ins, testConfigMap(map[string]string{"my.cnf": "a"})); err != nil {
+				t.Fatal(err)
+			}
+			if c.writes != 1 {
+				t.Fatalf("create wrote %d times", c.writes)
+			}
+			if tc.edit != nil {
+				existing := &corev1.ConfigMap{}
+				if err := c.Get(ctx, client.ObjectKey{Name: "mysql-mysql", Namespace: "default"}, existing); err != nil {
+					t.Fatal(err)
+				}
+				tc.edit(existing)
+				if err := c.put(existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+			writes := c.writes
+
+			if err := Apply(ctx, c, ins, testConfigMap(tc.desired)); err != nil {
+				t.Fatal(err)
+			}
+			if wrote := c.writes > writes; wrote != tc.wantWrite {
+				t.Errorf("wrote = %v, want %v", wrote, tc.wantWrite)
+			}
+		})
+	}
+}
+
+func TestDriftedFields(t *testing.T) {
+	replicas := func(n int32) *int32 { return &n }
+	for _, tc := range []struct {
+		name     string
+		desired  *corev1.ReplicationController
+		existing *corev1.ReplicationController
+		want     []string
+	}{
+		{
+			name:     "equal",
+			desired:  &corev1.ReplicationController{Spec: corev1.ReplicationControllerSpec{Replicas: replicas(3)}},
+			existing: &corev1.ReplicationController{Spec: corev1.ReplicationControllerSpec{Replicas: replicas(3)}},
+		},
+		{
+			name:     "changed value",
+			desired:  &corev1.ReplicationController{Spec: corev1.ReplicationControllerSpec{Replicas: replicas(3)}},
+			existing: &corev1.ReplicationController{Spec: corev1.ReplicationControllerSpec{Replicas: replicas(1)}},
+			want:     []string{".spec.replicas"},
+		},
+		{
+			name:    "defaulted by the server",
+			desired: &corev1.ReplicationController{},
+			existing: &corev1.ReplicationController{Spec: corev1.ReplicationControllerSpec{Replicas: replicas(1),
+				MinReadySeconds: 5}},
+		},
+		{
+			name: "list length",
+			desired: &corev1.ReplicationController{Spec: corev1.ReplicationControllerSpec{Template: &corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "a"}, {Name: "b"}}}}}},
+			existing: &corev1.ReplicationController{Spec: corev1.ReplicationControllerSpec{Template: &corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "a"}}}}}},
+			want: []string{".spec.template.spec.containers"},
+		},
+		{
+			name: "status and server metadata are ignored",
+			desired: &corev1.ReplicationController{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "mysql"}},
+				Status: corev1.ReplicationControllerStatus{Replicas: 3}},
+			existing: &corev1.ReplicationController{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "mysql"},
+				ResourceVersion: "7", Generation: 2}},
+		},
+		{
+			name:     "label",
+			desired:  &corev1.ReplicationController{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "mysql"}}},
+			existing: &corev1.ReplicationController{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "other"}}},
+			want:     []string{".metadata.labels.app"},
+		},
+	} {
+		got, err := driftedFields(tc.desired, tc.existing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: driftedFields = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
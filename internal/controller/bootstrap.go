@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+	"axe/cluster/innodbcluster/dba"
+)
+
+// phaseInterval is how often a cluster that is not ready is reconciled again.
+const phaseInterval = 5 * time.Second
+
+// bootstrapState is the progress of the bootstrap, it is reported in status.bootstrap.
+type bootstrapState struct {
+	Phase  string
+	Status databasev1.BootstrapStatus
+}
+
+// BootstrapCluster does one step of creating the innodb cluster. It returns nil once the
+// bootstrap completed. A step is bounded, the cluster is created on the first member and
+// the others are added one per reconcile.
+//
+// Nothing but status.bootstrap.completed is trusted, the state is read from the members
+// on every step: a group that is running is adopted, with its metadata or without when
+// createCluster was interrupted, and a cluster whose members are all offline is rebooted.
+// A new cluster is only created once every member was checked to hold none.
+func BootstrapCluster(ctx context.Context, c client.Client, ins *databasev1.Mysql) (*bootstrapState, error) {
+	if ins.Status.Bootstrap.Completed {
+		return nil, nil
+	}
+	state := &bootstrapState{Phase: databasev1.PhaseProvisioning, Status: *ins.Status.Bootstrap.DeepCopy()}
+	statefulSet := &appsv1.StatefulSet{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(ins), statefulSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			return state, nil
+		}
+		return state, fmt.Errorf("failed to get StatefulSet %s: %w", ins.Name, err)
+	}
+	passwd, err := RootPassword(ctx, c, ins)
+	if err != nil {
+		return state, err
+	}
+
+	infos := make([]*innodbcluster.MemberInfo, ins.Spec.Replica)
+	registered := make([]map[string]bool, ins.Spec.Replica)
+	reachable := true
+	for i := range infos {
+		host := innodbcluster.MemberHost(ins, i)
+		queryCtx, cancel := context.WithTimeout(ctx, memberQueryTimeout)
+		info, err := innodbcluster.QueryMember(queryCtx, ins, host, passwd)
+		if err == nil {
+			infos[i] = info
+			registered[i], err = innodbcluster.ClusterMetadata(queryCtx, ins, host, passwd)
+		}
+		cancel()
+		if err != nil {
+			log.Log.Info("member is not reachable yet", "member", innodbcluster.MemberName(ins, i), "error", err.Error())
+			infos[i], reachable = nil, false
+		}
+	}
+
+	// the member the group runs on, one with the metadata if there is
+	seed := -1
+	for i, info := range infos {
+		if info != nil && info.State == databasev1.MemberStateOnline && (seed < 0 || registered[seed] == nil && registered[i] != nil) {
+			seed = i
+		}
+	}
+	var withMetadata []int
+	for i := range registered {
+		if len(registered[i]) > 0 {
+			withMetadata = append(withMetadata, i)
+		}
+	}
+
+	switch {
+	case seed >= 0 && registered[seed] != nil:
+		if state.Status.Seed == "" {
+			log.Log.Info("adopt innodb cluster", "clusterspace", ins.Namespace, "clustername", ins.Name, "seed", innodbcluster.MemberName(ins, seed))
+			state.Status.Seed, state.Status.Adopted = innodbcluster.MemberName(ins, seed), true
+		}
+	case seed >= 0:
+		// group replication runs without the metadata, createCluster was interrupted
+		state.Phase = databasev1.PhaseBootstrapping
+		if state.Status.Seed == "" {
+			state.Status.Adopted = true
+		}
+		state.Status.Seed = innodbcluster.MemberName(ins, seed)
+		return state, innodbcluster.CreateCluster(ctx, ins, passwd, seed, true)
+	case len(withMetadata) > 0:
+		// the cluster exists but no member is online, reboot it from the member with the
+		// most transactions once all of them can be compared
+		state.Phase = databasev1.PhaseBootstrapping
+		if !reachable {
+			return state, nil
+		}
+		seed, err = mostAdvancedMember(ctx, ins, passwd, infos)
+		if err != nil {
+			return state, err
+		}
+		if state.Status.Seed == "" {
+			state.Status.Adopted = true
+		}
+		state.Status.Seed = innodbcluster.MemberName(ins, seed)
+		return state, innodbcluster.RebootCluster(ctx, ins, passwd, seed)
+	case !reachable:
+		// a member that can not be checked may hold a cluster already
+		if infos[0] != nil {
+			state.Phase = databasev1.PhaseAddingMembers
+		}
+		return state, nil
+	default:
+		state.Phase = databasev1.PhaseBootstrapping
+		state.Status.Seed = innodbcluster.MemberName(ins, 0)
+		err := innodbcluster.CreateCluster(ctx, ins, passwd, 0, false)
+		if err != nil && !dba.IsReason(err, dba.ReasonAlreadyInCluster) {
+			return state, err
+		}
+		return state, nil
+	}
+
+	state.Phase = databasev1.PhaseAddingMembers
+	for i, info := range infos {
+		switch {
+		case info == nil:
+			return state, nil
+		case info.State == databasev1.MemberStateOnline:
+			continue
+		case memberJoining(ctx, ins, passwd, i, info):
+			// the member is cloning or catching up, wait for it before adding the next one
+			return state, nil
+		}
+		var err error
+		if registered[seed][innodbcluster.MemberAddress(ins, i)] {
+			// registered but not in the group, an add was interrupted or the member restarted
+			err = innodbcluster.RejoinInstance(ctx, ins, passwd, seed, i)
+		} else {
+			err = innodbcluster.AddInstance(ctx, ins, passwd, seed, i)
+		}
+		switch {
+		case dba.IsReason(err, dba.ReasonAlreadyInCluster):
+		case dba.IsReason(err, dba.ReasonUnreachable):
+			// the member restarts after the clone, wait for it
+			log.Log.Info("member is restarting", "member", innodbcluster.MemberName(ins, i), "error", err.Error())
+		case err != nil:
+			return state, err
+		}
+		return state, nil
+	}
+
+	now := metav1.Now()
+	state.Phase = ""
+	state.Status.Completed, state.Status.CompletionTime = true, &now
+	log.Log.Info("innodb cluster bootstrap completed", "clusterspace", ins.Namespace, "clustername", ins.Name, "seed", state.Status.Seed)
+	return state, nil
+}
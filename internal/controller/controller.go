@@ -3,143 +3,177 @@ package controller
 import (
 	"context"
 	"fmt"
-	"reflect"
-	"time"
+	"strconv"
 
-	"github.com/presslabs/controller-util/pkg/meta"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	databasev1 "axe/api/v1"
 	innodbcluster "axe/cluster/innodbcluster"
 )
 
-func (r *MysqlReconciler) cleanupRelatedResources(ctx context.Context, ins *databasev1.Mysql) error {
-
-	if ins == nil {
-		return fmt.Errorf("object to create or update must not be nil")
-	}
-
-	defer func() {
-		// 如果清理成功，删除 Finalizer（如果有）
-		meta.RemoveFinalizer(&ins.ObjectMeta, FinalizerName)
-		if err := r.Update(ctx, ins); err != nil {
-			log.Log.Error(err, "failed to update cluster")
+// ApplySecret makes sure the credentials secret exists. The operator managed secret is
+// created once with random passwords and never updated, a secret referenced by
+// spec.mysql.credentialsSecretRef is only checked.
+func ApplySecret(ctx context.Context, c client.Client, ins *databasev1.Mysql) error {
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: innodbcluster.SecretName(ins), Namespace: ins.Namespace}, secret)
+	switch {
+	case err == nil:
+		if len(secret.Data[innodbcluster.RootPasswordKey]) == 0 {
+			return fmt.Errorf("secret %s has no key %s", secret.Name, innodbcluster.RootPasswordKey)
 		}
-	}()
-	// cleanup StatefulSet
-	statefulSet := &appsv1.StatefulSet{}
-	if err := r.Get(ctx, client.ObjectKeyFromObject(ins), statefulSet); err == nil {
-		if err := r.Delete(ctx, statefulSet); err != nil {
-			return fmt.Errorf("failed to delete StatefulSet %s: %w", ins.Name, err)
+		return nil
+	case apierrors.IsNotFound(err) && ins.Spec.Mysql.CredentialsSecretRef != nil:
+		return fmt.Errorf("credentials secret %s not found", innodbcluster.SecretName(ins))
+	case apierrors.IsNotFound(err):
+		secret, err := innodbcluster.Mysqlsecret(ins)
+		if err != nil {
+			return fmt.Errorf("failed to generate secret: %w", err)
 		}
-	} else if !apierrors.IsNotFound(err) {
-		return fmt.Errorf("failed to get StatefulSet %s: %w", ins.Name, err)
-	}
-
-	// cleanup Headless Service
-	svc := &corev1.Service{}
-	if err := r.Get(ctx, client.ObjectKeyFromObject(ins), svc); err == nil {
-		if err := r.Delete(ctx, svc); err != nil {
-			return fmt.Errorf("failed to delete Service %s: %w", ins.Name, err)
+		if err := controllerutil.SetControllerReference(ins, secret, c.Scheme()); err != nil {
+			return fmt.Errorf("failed to set owner of secret %s: %w", secret.Name, err)
 		}
-	} else if !apierrors.IsNotFound(err) {
-		return fmt.Errorf("failed to get Service %s: %w", ins.Name, err)
+		log.Log.Info("create credentials secret", "objspeace", secret.Namespace, "objname", secret.Name)
+		return c.Create(ctx, secret)
+	default:
+		return fmt.Errorf("failed to get secret %s: %w", innodbcluster.SecretName(ins), err)
 	}
+}
 
-	// cleanup router Service
-	svc = &corev1.Service{}
-	if err := r.Get(ctx, types.NamespacedName{Name: ins.Name + "-router", Namespace: ins.Namespace}, svc); err == nil {
-		if err := r.Delete(ctx, svc); err != nil {
-			return fmt.Errorf("failed to delete Service %s: %w", ins.Name, err)
-		}
-	} else if !apierrors.IsNotFound(err) {
-		return fmt.Errorf("failed to get Service %s: %w", ins.Name, err)
+// ApplyServerIDBase records the server id base of the cluster in its annotation before the
+// members are created, so that their server_id never changes.
+func ApplyServerIDBase(ctx context.Context, c client.Client, ins *databasev1.Mysql) error {
+	if _, found := ins.Annotations[databasev1.ServerIDBaseAnnotation]; found {
+		return nil
 	}
-
-	// cleanup router Service
-	svc = &corev1.Service{}
-	if err := r.Get(ctx, types.NamespacedName{Name: ins.Name + "-router-node", Namespace: ins.Namespace}, svc); err == nil {
-		if err := r.Delete(ctx, svc); err != nil {
-			return fmt.Errorf("failed to delete Service %s: %w", ins.Name, err)
-		}
-	} else if !apierrors.IsNotFound(err) {
-		return fmt.Errorf("failed to get Service %s: %w", ins.Name, err)
+	patch := client.MergeFrom(ins.DeepCopy())
+	if ins.Annotations == nil {
+		ins.Annotations = map[string]string{}
+	}
+	base := innodbcluster.ServerIDBase(ins)
+	ins.Annotations[databasev1.ServerIDBaseAnnotation] = strconv.FormatInt(base, 10)
+	log.Log.Info("set server id base", "clusterspace", ins.Namespace, "clustername", ins.Name, "base", base)
+	if err := c.Patch(ctx, ins, patch); err != nil {
+		return fmt.Errorf("failed to set annotation %s: %w", databasev1.ServerIDBaseAnnotation, err)
 	}
+	return nil
+}
 
-	// cleanup deployment
-	deploy := &appsv1.Deployment{}
-	if err := r.Get(ctx, types.NamespacedName{Name: ins.Name + "-router", Namespace: ins.Namespace}, deploy); err == nil {
-		if err := r.Delete(ctx, deploy); err != nil {
-			return fmt.Errorf("failed to delete Service %s: %w", ins.Name, err)
-		}
-	} else if !apierrors.IsNotFound(err) {
-		return fmt.Errorf("failed to get Service %s: %w", ins.Name, err)
+// RootPassword reads the mysql root password from the credentials secret.
+func RootPassword(ctx context.Context, c client.Client, ins *databasev1.Mysql) (string, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: innodbcluster.SecretName(ins), Namespace: ins.Namespace}, secret); err != nil {
+		return "", fmt.Errorf("failed to get secret %s: %w", innodbcluster.SecretName(ins), err)
+	}
+	passwd, ok := secret.Data[innodbcluster.RootPasswordKey]
+	if !ok || len(passwd) == 0 {
+		return "", fmt.Errorf("secret %s has no key %s", secret.Name, innodbcluster.RootPasswordKey)
 	}
+	return string(passwd), nil
+}
 
-	// cleanup configmap
-	configname := fmt.Sprintf("%s-%s", ins.Name, "mysql")
-	configmap := &corev1.ConfigMap{}
-	if err := r.Get(ctx, types.NamespacedName{Name: configname, Namespace: ins.Namespace}, configmap); err == nil {
-		if err := r.Delete(ctx, configmap); err != nil {
-			return fmt.Errorf("failed to delete configmap %s: %w", configmap, err)
+// MysqlConfigTemplate reads the template configmaps referenced by spec.mysql. The
+// plugin.cnf of pluginConfTemplate takes precedence over the one of mysqlConfTemplate.
+func MysqlConfigTemplate(ctx context.Context, c client.Client, ins *databasev1.Mysql) (map[string]string, error) {
+	template := map[string]string{}
+	for _, ref := range []struct{ name, key string }{
+		{ins.Spec.Mysql.MysqlConfTemplate, ""},
+		{ins.Spec.Mysql.PluginConfTemplate, innodbcluster.PluginCnfKey},
+	} {
+		if ref.name == "" {
+			continue
+		}
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, types.NamespacedName{Name: ref.name, Namespace: ins.Namespace}, cm); err != nil {
+			return nil, fmt.Errorf("failed to get config template %s: %w", ref.name, err)
+		}
+		for k, v := range cm.Data {
+			if ref.key == "" || ref.key == k {
+				template[k] = v
+			}
 		}
-	} else if !apierrors.IsNotFound(err) {
-		return fmt.Errorf("failed to get configmap %s: %w", configmap, err)
 	}
-
-	return nil
+	return template, nil
 }
 
-// CreateOrUpdate performs a create-or-update operation on the given object.
-// If the object does not exist, it is created. If it already exists, it is updated.
-func CreateOrUpdate(ctx context.Context, c client.Client, obj client.Object) error {
-	if obj == nil {
-		return fmt.Errorf("object to create or update must not be nil")
+// RouterConfigTemplate reads the template configmap referenced by spec.router.
+func RouterConfigTemplate(ctx context.Context, c client.Client, ins *databasev1.Mysql) (map[string]string, error) {
+	if ins.Spec.Router.RouterConfTemplate == "" {
+		return nil, nil
 	}
-	// Check if the resource already exists
-	existingObj := obj.DeepCopyObject().(client.Object)
-	err := c.Get(ctx, client.ObjectKeyFromObject(obj), existingObj)
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ins.Spec.Router.RouterConfTemplate, Namespace: ins.Namespace}, cm); err != nil {
+		return nil, fmt.Errorf("failed to get config template %s: %w", ins.Spec.Router.RouterConfTemplate, err)
+	}
+	return cm.Data, nil
+}
 
-	switch {
-	case err == nil:
-		// Resource exists, check for updates before updating
-		if reflect.DeepEqual(existingObj, obj) {
-			log.Log.Info("No changes detected, skipping update", "namespace", obj.GetNamespace(), "kind", obj.GetObjectKind(), "name", obj.GetName())
-			return nil
-		}
-		log.Log.Info("update resource due to changes", "objspeace", obj.GetNamespace(), "objtype", obj.GetObjectKind(), "objname", obj.GetName())
-		return c.Update(ctx, obj)
-	case apierrors.IsNotFound(err):
-		// Resource doesn't exist, create it
-		log.Log.Info("create resource", "objspeace", obj.GetNamespace(), "objtype", obj.GetObjectKind(), "objname", obj.GetName())
-		return c.Create(ctx, obj)
-	default:
-		return fmt.Errorf("failed to get existing resource: %w", err)
+// ApplyPodDisruptionBudget creates or updates the pod disruption budget, or deletes it when
+// it is not wanted anymore.
+func ApplyPodDisruptionBudget(ctx context.Context, c client.Client, ins *databasev1.Mysql, pdb *policyv1.PodDisruptionBudget, wanted bool) error {
+	if wanted {
+		return Apply(ctx, c, ins, pdb)
 	}
+	if err := c.Delete(ctx, pdb); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete PodDisruptionBudget %s: %w", pdb.Name, err)
+	}
+	return nil
 }
 
-func ApplyResources(ctx context.Context, r client.Client, ins *databasev1.Mysql) (ctrl.Result, error) {
+// ApplyResources applies the mysql resources, tlsHash is the hash of the certificates of
+// spec.tls, empty without.
+func ApplyResources(ctx context.Context, r client.Client, ins *databasev1.Mysql, tlsHash string) (ctrl.Result, error) {
 	log.Log.Info("create or update resource", "clusterspace", ins.Namespace, "clustername", ins.Name)
 
-	if err := CreateOrUpdate(ctx, r, innodbcluster.MysqlHeadlesSVC(ins)); err != nil {
+	if err := ApplySecret(ctx, r, ins); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := Apply(ctx, r, ins, innodbcluster.MysqlHeadlesSVC(ins)); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	if err := CreateOrUpdate(ctx, r, innodbcluster.MysqlConfigmap(ins)); err != nil {
+	template, err := MysqlConfigTemplate(ctx, r, ins)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	config := innodbcluster.MysqlConfigData(ins, template)
+	if err := Apply(ctx, r, ins, innodbcluster.MysqlConfigmap(ins, config)); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	if err := CreateOrUpdate(ctx, r, innodbcluster.RouterConfigmap(ins)); err != nil {
+	statefulSet := innodbcluster.MysqlStatefulset(ins, innodbcluster.ConfigHash(innodbcluster.StaticConfigData(config)), tlsHash)
+	existing := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(ins), existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, fmt.Errorf("failed to get StatefulSet %s: %w", ins.Name, err)
+		}
+		existing = nil
+	}
+	// the volumes of the members stay where their data is, updateStatus reports it
+	keptVolumes := existing != nil && innodbcluster.KeepVolumeClaimTemplates(statefulSet, existing)
+	if keptVolumes {
+		log.Log.Info("volume claim templates can not change, keep the existing volumes", "clusterspace", ins.Namespace, "clustername", ins.Name)
+	}
+	if err := Apply(ctx, r, ins, statefulSet); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	if err := CreateOrUpdate(ctx, r, innodbcluster.MysqlStatefulset(ins)); err != nil {
+	if !keptVolumes {
+		if err := ApplyHostPathVolumes(ctx, r, ins); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := ApplyPodDisruptionBudget(ctx, r, ins, innodbcluster.MysqlPDB(ins), innodbcluster.PodDisruptionBudgetEnabled(ins)); err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -147,62 +181,30 @@ func ApplyResources(ctx context.Context, r client.Client, ins *databasev1.Mysql)
 	return ctrl.Result{}, nil
 }
 
-func CreateRouter(ctx context.Context, r client.Client, ins *databasev1.Mysql) (ctrl.Result, error) {
+func CreateRouter(ctx context.Context, r client.Client, ins *databasev1.Mysql, tlsHash string) (ctrl.Result, error) {
 	log.Log.Info("create  router resource", "clusterspace", ins.Namespace, "clustername", ins.Name)
 
-	if err := CreateOrUpdate(ctx, r, innodbcluster.RouterDeployment(ins)); err != nil {
+	template, err := RouterConfigTemplate(ctx, r, ins)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
-	if err := CreateOrUpdate(ctx, r, innodbcluster.RouterClusterSVC(ins)); err != nil {
+	config := innodbcluster.RouterConfigData(ins, template)
+	if err := Apply(ctx, r, ins, innodbcluster.RouterConfigmap(ins, config)); err != nil {
 		return ctrl.Result{}, err
 	}
-	if err := CreateOrUpdate(ctx, r, innodbcluster.RouterNodeSVC(ins)); err != nil {
+	if err := Apply(ctx, r, ins, innodbcluster.RouterDeployment(ins, config, tlsHash)); err != nil {
 		return ctrl.Result{}, err
 	}
-	log.Log.Info("Create Routers sucess ")
-	return ctrl.Result{}, nil
-}
-
-func CreateCluster(ctx context.Context, r client.Client, ins *databasev1.Mysql) (ctrl.Result, error) {
-	//create innodb cluster
-	statefulSet := &appsv1.StatefulSet{}
-	time.Sleep(10 * time.Second)
-
-	if err := r.Get(ctx, client.ObjectKeyFromObject(ins), statefulSet); err == nil {
-
-		// 检查 StatefulSet 是否正常运行
-		if statefulSet.Status.ReadyReplicas == statefulSet.Status.Replicas &&
-			statefulSet.Status.CurrentRevision == statefulSet.Status.UpdateRevision &&
-			statefulSet.ObjectMeta.Labels["clusterstatus"] == databasev1.MgrNOTinstalled {
-			// dba.createcluster()
-			log.Log.Info("StatefulSet is running and innodb cluster lables MGR_NOT_INSTALLED")
-			if err := innodbcluster.CreateMGR(ctx, ins); err == nil {
-				log.Log.Info("Create innodb cluster SUCCESS")
-
-				return ctrl.Result{}, nil
-			} else {
-				log.Log.Error(err, "Create innodb cluster FAILED")
-				return ctrl.Result{}, err
-			}
-
-		} else if statefulSet.Status.ReadyReplicas == statefulSet.Status.Replicas &&
-			statefulSet.Status.CurrentRevision == statefulSet.Status.UpdateRevision &&
-			statefulSet.ObjectMeta.Labels["clusterstatus"] == databasev1.MgrISinstall {
-			// innodb cluster has already installed
-			log.Log.Info("StatefulSet is running and innodb cluster lables MGR_INSTALLED")
-			return ctrl.Result{}, nil
-
-		} else {
-			log.Log.Error(err, "StatefulSet is not running normally ")
-			log.Log.Info("StatefulSet is not running normally", "ReadyReplicas", statefulSet.Status.ReadyReplicas, "Replicas", statefulSet.Status.Replicas)
-			log.Log.Info("StatefulSet is not running normally", "CurrentRevision", statefulSet.Status.CurrentRevision, "UpdateRevision", statefulSet.Status.UpdateRevision)
-			log.Log.Info("StatefulSet is not running normally", "clusterstatus", statefulSet.ObjectMeta.Labels["clusterstatus"])
-
-			return ctrl.Result{}, err
-		}
-
-	} else if !apierrors.IsNotFound(err) {
-		log.Log.Error(err, "statefulset", ins.Name, "not fondun")
+	if err := ApplyPodDisruptionBudget(ctx, r, ins, innodbcluster.RouterPDB(ins),
+		innodbcluster.PodDisruptionBudgetEnabled(ins) && ins.Spec.Router.Replica > 0); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := Apply(ctx, r, ins, innodbcluster.RouterClusterSVC(ins)); err != nil {
+		return ctrl.Result{}, err
 	}
+	if err := Apply(ctx, r, ins, innodbcluster.RouterNodeSVC(ins)); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.Log.Info("Create Routers sucess ")
 	return ctrl.Result{}, nil
 }
@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+// deletionInterval is how often a pending deletion step is checked.
+const deletionInterval = 10 * time.Second
+
+// cleanupRelatedResources carries out the deletion policy. It reports whether the cleanup
+// is done, the finalizer is kept until then and the progress is shown in the status.
+func (r *MysqlReconciler) cleanupRelatedResources(ctx context.Context, ins *databasev1.Mysql) (bool, error) {
+	switch ins.Spec.DeletionPolicy {
+	case databasev1.DeletionPolicyBackupThenDelete:
+		if done, err := r.finalBackup(ctx, ins); err != nil || !done {
+			return false, err
+		}
+		return r.deleteData(ctx, ins)
+	case databasev1.DeletionPolicyDelete:
+		return r.deleteData(ctx, ins)
+	default:
+		return true, RetainVolumes(ctx, r.Client, ins)
+	}
+}
+
+// setDeleting reports the current deletion step in the status.
+func (r *MysqlReconciler) setDeleting(ctx context.Context, ins *databasev1.Mysql, reason, message string) error {
+	status := ins.Status.DeepCopy()
+	status.State = databasev1.ClusterDeletingState
+	setCondition(status, ins, databasev1.ConditionDeleting, true, reason, message)
+	if equality.Semantic.DeepEqual(status, &ins.Status) {
+		return nil
+	}
+	ins.Status = *status
+	return r.Status().Update(ctx, ins)
+}
+
+// finalBackup runs the final backup job and reports whether it completed. A failed job
+// blocks the deletion, it is retried once deleted.
+func (r *MysqlReconciler) finalBackup(ctx context.Context, ins *databasev1.Mysql) (bool, error) {
+	host := innodbcluster.MemberHost(ins, 0)
+	for i := 0; i < int(ins.Spec.Replica); i++ {
+		if innodbcluster.MemberName(ins, i) == ins.Status.Leader {
+			host = innodbcluster.MemberHost(ins, i)
+		}
+	}
+
+	done, failed, err := runJob(ctx, r.Client, ins, innodbcluster.FinalBackupJob(ins, host))
+	switch {
+	case err != nil:
+		return false, err
+	case failed:
+		return false, r.setDeleting(ctx, ins, "BackupFailed",
+			fmt.Sprintf("job %s failed, delete it to retry", innodbcluster.FinalBackupJobName(ins)))
+	case !done:
+		return false, r.setDeleting(ctx, ins, "FinalBackup",
+			fmt.Sprintf("waiting for job %s", innodbcluster.FinalBackupJobName(ins)))
+	}
+	log.Log.Info("final backup completed", "clusterspace", ins.Namespace, "clustername", ins.Name)
+	return true, nil
+}
+
+// deleteData removes the mysql members and their volumes. The claims are only deleted
+// once the members are gone, host path data is removed on its node before the volume.
+func (r *MysqlReconciler) deleteData(ctx context.Context, ins *databasev1.Mysql) (bool, error) {
+	statefulSet := &appsv1.StatefulSet{}
+	statefulSet.Name, statefulSet.Namespace = ins.Name, ins.Namespace
+	if err := r.Delete(ctx, statefulSet); err != nil && !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to delete StatefulSet %s: %w", ins.Name, err)
+	}
+
+	selector := client.MatchingLabels{
+		"clustername": ins.Name,
+		"app":         databasev1.MYSQLAPP,
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(ins.Namespace), selector); err != nil {
+		return false, fmt.Errorf("failed to list pods: %w", err)
+	}
+	if len(pods.Items) > 0 {
+		return false, r.setDeleting(ctx, ins, "DeletingMembers",
+			fmt.Sprintf("waiting for %d members to terminate", len(pods.Items)))
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcs, client.InNamespace(ins.Namespace), selector); err != nil {
+		return false, fmt.Errorf("failed to list persistent volume claims: %w", err)
+	}
+	for i := range pvcs.Items {
+		log.Log.Info("delete persistent volume claim", "objspeace", ins.Namespace, "objname", pvcs.Items[i].Name)
+		if err := r.Delete(ctx, &pvcs.Items[i]); err != nil && !apierrors.IsNotFound(err) {
+			return false, fmt.Errorf("failed to delete persistent volume claim %s: %w", pvcs.Items[i].Name, err)
+		}
+	}
+
+	pvs, err := hostPathVolumes(ctx, r.Client, ins)
+	if err != nil {
+		return false, err
+	}
+	pending := 0
+	for i := range pvs {
+		nodes := pvNodes(&pvs[i])
+		if len(nodes) == 0 || pvs[i].Spec.HostPath == nil {
+			continue
+		}
+		done, failed, err := runJob(ctx, r.Client, ins, innodbcluster.HostPathCleanupJob(ins, &pvs[i], nodes[0]))
+		if err != nil {
+			return false, err
+		}
+		if failed {
+			return false, r.setDeleting(ctx, ins, "CleanupFailed",
+				fmt.Sprintf("job %s failed, delete it to retry", innodbcluster.HostPathCleanupJobName(ins, &pvs[i])))
+		}
+		if !done {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return false, r.setDeleting(ctx, ins, "DeletingData",
+			fmt.Sprintf("waiting for the data of %d host path volumes to be removed", pending))
+	}
+	if err := DeleteHostPathVolumes(ctx, r.Client, ins); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RetainVolumes labels the claims and host path volumes of the cluster as retained. The
+// claims are not owned by the cluster and outlive it, a new cluster of the same name
+// binds them again.
+func RetainVolumes(ctx context.Context, c client.Client, ins *databasev1.Mysql) error {
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := c.List(ctx, pvcs, client.InNamespace(ins.Namespace), client.MatchingLabels{
+		"clustername": ins.Name,
+		"app":         databasev1.MYSQLAPP,
+	}); err != nil {
+		return fmt.Errorf("failed to list persistent volume claims: %w", err)
+	}
+	for i := range pvcs.Items {
+		if err := retain(ctx, c, &pvcs.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	pvs, err := hostPathVolumes(ctx, c, ins)
+	if err != nil {
+		return err
+	}
+	for i := range pvs {
+		if err := retain(ctx, c, &pvs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func retain(ctx context.Context, c client.Client, obj client.Object) error {
+	if obj.GetLabels()[innodbcluster.RetainedLabel] == "true" {
+		return nil
+	}
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[innodbcluster.RetainedLabel] = "true"
+	obj.SetLabels(labels)
+	log.Log.Info("retain volume", "objspeace", obj.GetNamespace(), "objname", obj.GetName())
+	if err := c.Patch(ctx, obj, patch); err != nil {
+		return fmt.Errorf("failed to label %s as retained: %w", obj.GetName(), err)
+	}
+	return nil
+}
+
+// runJob creates the job if it does not exist and reports whether it completed or failed.
+func runJob(ctx context.Context, c client.Client, owner client.Object, job *batchv1.Job) (bool, bool, error) {
+	existing := &batchv1.Job{}
+	err := c.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, existing)
+	if apierrors.IsNotFound(err) {
+		if err := controllerutil.SetControllerReference(owner, job, c.Scheme()); err != nil {
+			return false, false, fmt.Errorf("failed to set owner of job %s: %w", job.Name, err)
+		}
+		log.Log.Info("create job", "objspeace", job.Namespace, "objname", job.Name)
+		if err := c.Create(ctx, job); err != nil {
+			return false, false, fmt.Errorf("failed to create job %s: %w", job.Name, err)
+		}
+		return false, false, nil
+	} else if err != nil {
+		return false, false, fmt.Errorf("failed to get job %s: %w", job.Name, err)
+	}
+
+	done, failed := jobFinished(existing)
+	return done, failed, nil
+}
+
+// jobFinished reports whether the job completed or failed.
+func jobFinished(job *batchv1.Job) (bool, bool) {
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			return true, false
+		case batchv1.JobFailed:
+			return false, true
+		}
+	}
+	return false, false
+}
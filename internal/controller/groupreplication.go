@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+	"axe/cluster/innodbcluster/dba"
+)
+
+// ApplyGroupReplication changes the cluster options of spec.mysql.groupReplication that
+// differ from the settings in effect on the primary. It returns the settings in effect,
+// nil if there is no online primary. messageCacheSize and flowControlMode are variables of
+// plugin.cnf and applied with the other mysqld variables.
+func (r *MysqlReconciler) ApplyGroupReplication(ctx context.Context, ins *databasev1.Mysql, members []*innodbcluster.MemberInfo) (*databasev1.GroupReplication, error) {
+	statefulSet, err := installedStatefulSet(ctx, r.Client, ins)
+	if err != nil || statefulSet == nil {
+		return nil, err
+	}
+	passwd, err := RootPassword(ctx, r.Client, ins)
+	if err != nil {
+		return nil, err
+	}
+
+	via := -1
+	for i := 0; i < int(ins.Spec.Replica) && via < 0; i++ {
+		if info := memberInfo(members, i); info.State == databasev1.MemberStateOnline && info.Role == databasev1.MemberRolePrimary {
+			via = i
+		}
+	}
+	if via < 0 {
+		return nil, nil
+	}
+	queryCtx, cancel := context.WithTimeout(ctx, memberQueryTimeout)
+	current, err := innodbcluster.GroupReplicationSettings(queryCtx, ins, innodbcluster.MemberHost(ins, via), passwd)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	want := ins.Spec.Mysql.GroupReplication
+	changes := map[string]interface{}{}
+	if want.Consistency != "" && want.Consistency != current.Consistency {
+		changes[dba.OptionConsistency] = want.Consistency
+		current.Consistency = want.Consistency
+	}
+	if want.ExpelTimeout != nil && *want.ExpelTimeout != *current.ExpelTimeout {
+		changes[dba.OptionExpelTimeout] = int(*want.ExpelTimeout)
+		current.ExpelTimeout = want.ExpelTimeout
+	}
+	if want.AutoRejoinTries != nil && *want.AutoRejoinTries != *current.AutoRejoinTries {
+		changes[dba.OptionAutoRejoinTries] = int(*want.AutoRejoinTries)
+		current.AutoRejoinTries = want.AutoRejoinTries
+	}
+	if want.ExitStateAction != "" && want.ExitStateAction != current.ExitStateAction {
+		changes[dba.OptionExitStateAction] = want.ExitStateAction
+		current.ExitStateAction = want.ExitStateAction
+	}
+	if want.IPAllowlist != "" && want.IPAllowlist != current.IPAllowlist {
+		changes[dba.OptionIPAllowlist] = want.IPAllowlist
+		current.IPAllowlist = want.IPAllowlist
+	}
+	for _, option := range []string{dba.OptionConsistency, dba.OptionExpelTimeout, dba.OptionAutoRejoinTries,
+		dba.OptionExitStateAction, dba.OptionIPAllowlist} {
+		value, ok := changes[option]
+		if !ok {
+			continue
+		}
+		if err := innodbcluster.SetClusterOption(ctx, ins, passwd, via, option, value); err != nil {
+			r.Recorder.Event(ins, corev1.EventTypeWarning, "GroupReplication", err.Error())
+			return nil, err
+		}
+	}
+	if size, err := resource.ParseQuantity(current.MessageCacheSize); err == nil {
+		current.MessageCacheSize = size.String()
+	}
+	return current, nil
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	databasev1 "axe/api/v1"
+)
+
+// memoryClient keeps the objects in memory, it implements the calls used by Apply and
+// the backup retention. The other calls panic.
+type memoryClient struct {
+	client.Client
+	scheme  *runtime.Scheme
+	objects map[string][]byte
+	writes  int
+	deleted []string
+}
+
+func newMemoryClient(t *testing.T) *memoryClient {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := databasev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return &memoryClient{scheme: scheme, objects: map[string][]byte{}}
+}
+
+func (c *memoryClient) key(obj client.Object, name client.ObjectKey) (string, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return "", err
+	}
+	return gvk.Kind + "/" + name.String(), nil
+}
+
+func (c *memoryClient) Scheme() *runtime.Scheme {
+	return c.scheme
+}
+
+func (c *memoryClient) Get(_ context.Context, name client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	key, err := c.key(obj, name)
+	if err != nil {
+		return err
+	}
+	data, ok := c.objects[key]
+	if !ok {
+		return apierrors.NewNotFound(schema.GroupResource{}, name.Name)
+	}
+	return json.Unmarshal(data, obj)
+}
+
+func (c *memoryClient) Patch(_ context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	return c.put(obj)
+}
+
+func (c *memoryClient) Delete(_ context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	key, err := c.key(obj, client.ObjectKeyFromObject(obj))
+	if err != nil {
+		return err
+	}
+	if _, ok := c.objects[key]; !ok {
+		return apierrors.NewNotFound(schema.GroupResource{}, obj.GetName())
+	}
+	delete(c.objects, key)
+	c.deleted = append(c.deleted, obj.GetName())
+	return nil
+}
+
+func (c *memoryClient) put(obj client.Object) error {
+	key, err := c.key(obj, client.ObjectKeyFromObject(obj))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	c.objects[key] = data
+	c.writes++
+	return nil
+}
@@ -18,11 +18,11 @@ package controller
 
 import (
 	"context"
-	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/presslabs/controller-util/pkg/meta"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -30,8 +30,10 @@ import (
 	databasev1 "axe/api/v1"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -40,6 +42,10 @@ type MysqlReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// Recorder records the recovery actions as events of the cluster.
+	Recorder record.EventRecorder
+	// MaxConcurrentReconciles is the number of clusters reconciled in parallel, 1 if unset.
+	MaxConcurrentReconciles int
 }
 
 var FinalizerName = "axe-finalizer"
@@ -47,13 +53,18 @@ var FinalizerName = "axe-finalizer"
 //+kubebuilder:rbac:groups=database.wufan,resources=mysqls,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=database.wufan,resources=mysqls/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=database.wufan,resources=mysqls/finalizers,verbs=update
-//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=statefulsets;deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=configmaps;secrets;services;pods;pods/exec;persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
+//+kubebuilder:rbac:groups=core,resources=persistentvolumes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=events,verbs=get;create;patch
 //+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update
 //+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update
 //+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -72,67 +83,170 @@ func (r *MysqlReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// Add finalizer if is not added on the resource.
-	if !meta.HasFinalizer(&ins.ObjectMeta, FinalizerName) {
-		meta.AddFinalizer(&ins.ObjectMeta, FinalizerName)
+	// the owned objects are garbage collected, the finalizer keeps the cluster until the
+	// deletion policy has been carried out for the data
+	if !ins.GetDeletionTimestamp().IsZero() {
+		if !meta.HasFinalizer(&ins.ObjectMeta, FinalizerName) {
+			return ctrl.Result{}, nil
+		}
+		log.Log.Info("mysql cluster is deleting", "clusterspace", ins.Namespace, "clustername", ins.Name, "deletionPolicy", ins.Spec.DeletionPolicy)
+		done, err := r.cleanupRelatedResources(ctx, ins)
+		if err != nil {
+			log.Log.Error(err, "cleanup failed", "clusterspace", ins.Namespace, "clustername", ins.Name)
+			return ctrl.Result{}, err
+		}
+		if !done {
+			return ctrl.Result{RequeueAfter: deletionInterval}, nil
+		}
+		meta.RemoveFinalizer(&ins.ObjectMeta, FinalizerName)
 		if err := r.Update(ctx, ins); err != nil {
 			return ctrl.Result{}, err
 		}
+		log.Log.Info("cleanup crd sucess ")
+		return ctrl.Result{}, nil
 	}
 
-	// delete cr relation resource 例如 StatefulSet、Headless Service 等
-	if !ins.GetDeletionTimestamp().IsZero() {
-		log.Log.Info("mysql cluster is deleting", "clusterspace", ins.Namespace, "clustername", ins.Name)
-		if err := r.cleanupRelatedResources(ctx, ins); err != nil {
+	if !meta.HasFinalizer(&ins.ObjectMeta, FinalizerName) {
+		meta.AddFinalizer(&ins.ObjectMeta, FinalizerName)
+		if err := r.Update(ctx, ins); err != nil {
 			return ctrl.Result{}, err
 		}
-		log.Log.Info("cleanup crd sucess ")
-		return ctrl.Result{}, nil
+	}
+
+	if err := ApplyServerIDBase(ctx, r.Client, ins); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// the webhook may not be deployed, never build resources from an invalid spec
+	ins.Default()
+	if _, errs := ins.ValidateSpec(); len(errs) > 0 {
+		return ctrl.Result{}, r.setInvalidSpec(ctx, ins, errs)
+	}
+
+	// the members are read once, the steps below act on what they reported
+	members, err := queryMembers(ctx, r.Client, ins)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// members must leave the group before the statefulset shrinks
+	scaling := ""
+	if scaleIn, err := ScaleIn(ctx, r.Client, ins, members); err != nil {
+		log.Log.Error(err, "scale in failed ")
+		return ctrl.Result{}, err
+	} else if scaleIn {
+		scaling = databasev1.ClusterScaleInState
+	}
+
+	// the config before it is rendered again, to find the changed variables
+	oldConfig, err := CurrentMysqlConfig(ctx, r.Client, ins)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// the certificates before the pods that mount them
+	tls, err := ApplyTLS(ctx, r.Client, ins)
+	if err != nil {
+		log.Log.Error(err, "apply tls failed ")
+		return ctrl.Result{}, err
+	}
+	tlsHash := ""
+	if tls != nil {
+		tlsHash = tls.Hash
 	}
 
 	// apply resources
-	if _, err := ApplyResources(ctx, r.Client, ins); err != nil {
+	if _, err := ApplyResources(ctx, r.Client, ins, tlsHash); err != nil {
 		log.Log.Error(err, "Apply Resources failed ")
 		return ctrl.Result{}, err
 	}
 
-	// // create cluster
-	if _, err := CreateCluster(ctx, r.Client, ins); err != nil {
-		log.Log.Error(err, "create cluster failed ")
+	variables, err := ApplyVariables(ctx, r.Client, ins, oldConfig)
+	if err != nil {
+		log.Log.Error(err, "apply variables failed ")
 		return ctrl.Result{}, err
 	}
 
-	// update lables
-	//fix the error : "the object has been modified; please apply your changes to the latest version and try again"
-	statefulSet := &appsv1.StatefulSet{}
-	r.Get(ctx, req.NamespacedName, statefulSet)
-	if statefulSet.Status.ReadyReplicas == statefulSet.Status.Replicas &&
-		statefulSet.Status.CurrentRevision == statefulSet.Status.UpdateRevision &&
-		statefulSet.ObjectMeta.Labels["clusterstatus"] == databasev1.MgrNOTinstalled {
-		statefulSet.ObjectMeta.Labels["clusterstatus"] = databasev1.Mgrinstalled
+	// members that left the group are recovered before it changes
+	recovery, err := r.RecoverCluster(ctx, ins, members)
+	if err != nil {
+		log.Log.Error(err, "recover cluster failed ")
+		return ctrl.Result{}, err
+	}
 
-		if err := r.Update(ctx, statefulSet); err != nil {
-			log.Log.Error(err, "update statefulset lables failed")
+	if !recovery.active() {
+		if scaleOut, err := ScaleOut(ctx, r.Client, ins, members); err != nil {
+			log.Log.Error(err, "scale out failed ")
 			return ctrl.Result{}, err
+		} else if scaleOut {
+			scaling = databasev1.ClusterScaleOutState
 		}
-		time.Sleep(3 * time.Second)
-		log.Log.Info("update statefulset lable MGR_INSTALLED")
+	}
+
+	// the primary is only moved while the group is stable
+	var switching *switchoverState
+	var groupReplication *databasev1.GroupReplication
+	topologyBlocked := ""
+	if !recovery.active() && scaling == "" {
+		if topologyBlocked, err = r.ApplyTopologyMode(ctx, ins, members); err != nil {
+			log.Log.Error(err, "apply topology mode failed ")
+			return ctrl.Result{}, err
+		}
+		if groupReplication, err = r.ApplyGroupReplication(ctx, ins, members); err != nil {
+			log.Log.Error(err, "apply group replication settings failed ")
+			return ctrl.Result{}, err
+		}
+		if err := ApplyMemberWeights(ctx, r.Client, ins, members); err != nil {
+			log.Log.Error(err, "apply member weights failed ")
+			return ctrl.Result{}, err
+		}
+		if switching, err = r.Switchover(ctx, ins, members); err != nil {
+			log.Log.Error(err, "switchover failed ")
+			return ctrl.Result{}, err
+		}
+	}
+
+	// create the innodb cluster one step at a time
+	bootstrap, err := BootstrapCluster(ctx, r.Client, ins)
+	if err != nil {
+		log.Log.Error(err, "create cluster failed ")
+		return ctrl.Result{}, err
 	}
 
 	// create router deployment
-	if _, err := CreateRouter(ctx, r.Client, ins); err != nil {
+	if _, err := CreateRouter(ctx, r.Client, ins, tlsHash); err != nil {
 		log.Log.Error(err, "create router failed ")
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	// update status, the member state changes without any event so poll it
+	if err := r.updateStatus(ctx, ins, members, progress{
+		bootstrap:        bootstrap,
+		scaling:          scaling,
+		recovery:         recovery,
+		switchover:       switching,
+		topology:         topologyBlocked,
+		variables:        variables,
+		groupReplication: groupReplication,
+		tls:              tls,
+	}); err != nil {
+		log.Log.Error(err, "update status failed")
+		return ctrl.Result{}, err
+	}
+
+	if ins.Status.Phase != databasev1.PhaseReady || switching != nil && switching.InProgress {
+		return ctrl.Result{RequeueAfter: phaseInterval}, nil
+	}
+	return ctrl.Result{RequeueAfter: statusInterval}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *MysqlReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&databasev1.Mysql{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Owns(&appsv1.StatefulSet{}).
+		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.ConfigMap{}).
 		Owns(&corev1.Service{}).
 		Owns(&rbacv1.Role{}).
@@ -140,5 +254,6 @@ func (r *MysqlReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Owns(&corev1.ServiceAccount{}).
 		Owns(&corev1.Secret{}).
 		Owns(&policyv1.PodDisruptionBudget{}).
+		Owns(&batchv1.Job{}).
 		Complete(r)
 }
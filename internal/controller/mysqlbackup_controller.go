@@ -0,0 +1,285 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/presslabs/controller-util/pkg/meta"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+// MysqlBackupReconciler reconciles a MysqlBackup object
+type MysqlBackupReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Recorder records the completion of the backups as events.
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=database.wufan,resources=mysqlbackups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=database.wufan,resources=mysqlbackups/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=database.wufan,resources=mysqlbackups/finalizers,verbs=update
+
+// Reconcile takes the backup once. The job is started when the cluster has a member to
+// back up, the result of the job is recorded in the status, a finished backup is left alone.
+// With the backup artifacts finalizer, the data of a deleted backup is deleted from its target.
+func (r *MysqlBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	backup := &databasev1.MysqlBackup{}
+	if err := r.Get(ctx, req.NamespacedName, backup); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !backup.GetDeletionTimestamp().IsZero() {
+		if !meta.HasFinalizer(&backup.ObjectMeta, databasev1.BackupArtifactsFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		done, err := r.deleteArtifacts(ctx, backup)
+		if err != nil || !done {
+			return ctrl.Result{RequeueAfter: deletionInterval}, err
+		}
+		meta.RemoveFinalizer(&backup.ObjectMeta, databasev1.BackupArtifactsFinalizer)
+		return ctrl.Result{}, r.Update(ctx, backup)
+	}
+	if backup.Finished() {
+		return ctrl.Result{}, nil
+	}
+
+	// the webhook may not be deployed
+	backup.Default()
+	if errs := backup.ValidateSpec(); len(errs) > 0 {
+		return ctrl.Result{}, r.setPhase(ctx, backup, databasev1.BackupPhaseFailed, errs.ToAggregate().Error())
+	}
+
+	status := backup.Status.DeepCopy()
+	if status.JobName == "" {
+		ins := &databasev1.Mysql{}
+		err := r.Get(ctx, types.NamespacedName{Name: backup.Spec.ClusterName, Namespace: backup.Namespace}, ins)
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{RequeueAfter: phaseInterval}, r.setPhase(ctx, backup, databasev1.BackupPhasePending,
+				fmt.Sprintf("cluster %s does not exist", backup.Spec.ClusterName))
+		} else if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to get cluster %s: %w", backup.Spec.ClusterName, err)
+		}
+		ordinal := backupSource(ins)
+		if ordinal < 0 {
+			return ctrl.Result{RequeueAfter: phaseInterval}, r.setPhase(ctx, backup, databasev1.BackupPhasePending,
+				fmt.Sprintf("cluster %s has no online member to back up", ins.Name))
+		}
+
+		job := innodbcluster.BackupJob(ins, backup, innodbcluster.MemberHost(ins, ordinal))
+		if _, _, err := runJob(ctx, r.Client, backup, job); err != nil {
+			return ctrl.Result{}, err
+		}
+		log.Log.Info("backup started", "clusterspace", ins.Namespace, "clustername", ins.Name,
+			"backup", backup.Name, "member", innodbcluster.MemberName(ins, ordinal))
+		now := metav1.Now()
+		status.Phase = databasev1.BackupPhaseRunning
+		status.Message = ""
+		status.JobName = job.Name
+		status.SourceMember = innodbcluster.MemberName(ins, ordinal)
+		status.StartTime = &now
+		status.Location = innodbcluster.BackupLocation(backup)
+		backup.Status = *status
+		return ctrl.Result{}, r.Status().Update(ctx, backup)
+	}
+
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Name: status.JobName, Namespace: backup.Namespace}, job); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, r.setPhase(ctx, backup, databasev1.BackupPhaseFailed, fmt.Sprintf("job %s was deleted", status.JobName))
+		}
+		return ctrl.Result{}, fmt.Errorf("failed to get job %s: %w", status.JobName, err)
+	}
+	done, failed := jobFinished(job)
+	switch {
+	case failed:
+		r.Recorder.Eventf(backup, corev1.EventTypeWarning, "BackupFailed", "job %s failed", job.Name)
+		return ctrl.Result{}, r.setPhase(ctx, backup, databasev1.BackupPhaseFailed, fmt.Sprintf("job %s failed", job.Name))
+	case !done:
+		return ctrl.Result{}, nil
+	}
+
+	result, err := r.backupResult(ctx, job)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	now := metav1.Now()
+	status.Phase = databasev1.BackupPhaseCompleted
+	status.Message = ""
+	status.CompletionTime = &now
+	status.GtidExecuted = result.GtidExecuted
+	status.Size = formatSize(result.Size)
+	backup.Status = *status
+	if err := r.Status().Update(ctx, backup); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.Log.Info("backup completed", "clusterspace", backup.Namespace, "clustername", backup.Spec.ClusterName,
+		"backup", backup.Name, "location", status.Location, "size", status.Size)
+	r.Recorder.Eventf(backup, corev1.EventTypeNormal, "BackupCompleted", "backup of %s written to %s", status.SourceMember, status.Location)
+	return ctrl.Result{}, nil
+}
+
+// setPhase sets the phase of the backup, a failed backup gets its completion time.
+func (r *MysqlBackupReconciler) setPhase(ctx context.Context, backup *databasev1.MysqlBackup, phase, message string) error {
+	status := backup.Status.DeepCopy()
+	status.Phase = phase
+	status.Message = message
+	if phase == databasev1.BackupPhaseFailed && status.CompletionTime == nil {
+		now := metav1.Now()
+		status.CompletionTime = &now
+	}
+	if equality.Semantic.DeepEqual(status, &backup.Status) {
+		return nil
+	}
+	log.Log.Info("backup "+strings.ToLower(phase), "clusterspace", backup.Namespace, "clustername", backup.Spec.ClusterName,
+		"backup", backup.Name, "message", message)
+	backup.Status = *status
+	return r.Status().Update(ctx, backup)
+}
+
+// deleteArtifacts deletes the data of the backup from its target and reports whether it is
+// gone. A running backup job is stopped first. A failed cleanup job blocks the deletion, it is
+// retried once deleted.
+func (r *MysqlBackupReconciler) deleteArtifacts(ctx context.Context, backup *databasev1.MysqlBackup) (bool, error) {
+	if backup.Status.JobName == "" {
+		return true, nil
+	}
+	if backup.Status.Phase == databasev1.BackupPhaseRunning {
+		job := &batchv1.Job{}
+		err := r.Get(ctx, types.NamespacedName{Name: backup.Status.JobName, Namespace: backup.Namespace}, job)
+		if err == nil {
+			if done, failed := jobFinished(job); !done && !failed {
+				// the job stays until its pod is gone, the cleanup must not race with it
+				log.Log.Info("stop backup job", "objspeace", job.Namespace, "objname", job.Name)
+				if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationForeground)); client.IgnoreNotFound(err) != nil {
+					return false, fmt.Errorf("failed to delete job %s: %w", job.Name, err)
+				}
+				return false, nil
+			}
+		} else if !apierrors.IsNotFound(err) {
+			return false, fmt.Errorf("failed to get job %s: %w", backup.Status.JobName, err)
+		}
+	}
+
+	// the volume claim is cleaned up with the image of the cluster if it still exists
+	image := databasev1.DefaultMysqlImage
+	ins := &databasev1.Mysql{}
+	if err := r.Get(ctx, types.NamespacedName{Name: backup.Spec.ClusterName, Namespace: backup.Namespace}, ins); err == nil {
+		image = ins.Spec.Mysql.MysqlImage
+	} else if !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to get cluster %s: %w", backup.Spec.ClusterName, err)
+	}
+	done, failed, err := runJob(ctx, r.Client, backup, innodbcluster.BackupCleanupJob(backup, image))
+	switch {
+	case err != nil:
+		return false, err
+	case failed:
+		message := fmt.Sprintf("job %s failed to delete %s, delete it to retry", innodbcluster.BackupCleanupJobName(backup), backup.Status.Location)
+		r.Recorder.Event(backup, corev1.EventTypeWarning, "CleanupFailed", message)
+		return false, r.setPhase(ctx, backup, backup.Status.Phase, message)
+	case !done:
+		return false, nil
+	}
+	log.Log.Info("backup data deleted", "clusterspace", backup.Namespace, "clustername", backup.Spec.ClusterName,
+		"backup", backup.Name, "location", backup.Status.Location)
+	return true, nil
+}
+
+// backupSource returns the ordinal of the member to back up, the online secondary with the
+// highest ordinal so the primary is not loaded. Without one, an online primary is used when
+// it is the only member, e.g. a single member or a multi-primary group. It returns -1 if no
+// member is online.
+func backupSource(ins *databasev1.Mysql) int {
+	primary := -1
+	for i := int(ins.Spec.Replica) - 1; i >= 0; i-- {
+		name := innodbcluster.MemberName(ins, i)
+		for _, member := range ins.Status.Members {
+			if member.Name != name || member.State != databasev1.MemberStateOnline {
+				continue
+			}
+			if member.Role == databasev1.MemberRoleSecondary {
+				return i
+			}
+			if primary < 0 {
+				primary = i
+			}
+		}
+	}
+	return primary
+}
+
+// backupResult reads the result the succeeded pod of the job wrote to its termination message.
+func (r *MysqlBackupReconciler) backupResult(ctx context.Context, job *batchv1.Job) (*innodbcluster.BackupResult, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return nil, fmt.Errorf("failed to list pods of job %s: %w", job.Name, err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		for _, container := range pod.Status.ContainerStatuses {
+			if container.State.Terminated == nil || container.State.Terminated.Message == "" {
+				continue
+			}
+			result := &innodbcluster.BackupResult{}
+			if err := json.Unmarshal([]byte(container.State.Terminated.Message), result); err != nil {
+				return nil, fmt.Errorf("failed to parse result of pod %s: %w", pod.Name, err)
+			}
+			return result, nil
+		}
+	}
+	return nil, fmt.Errorf("job %s has no pod with a backup result", job.Name)
+}
+
+// formatSize formats bytes with a binary unit, e.g. 1.5Gi.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d", size)
+	}
+	value, exp := float64(size)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ci", value, "KMGTP"[exp])
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MysqlBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&databasev1.MysqlBackup{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
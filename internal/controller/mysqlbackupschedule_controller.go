@@ -0,0 +1,342 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+// backupHistoryLimit is the number of backups in the history of a schedule. Failed backups
+// are deleted once they drop out of it.
+const backupHistoryLimit = 10
+
+// maxMissedSchedules is the number of missed backups walked through one by one, e.g. after
+// the schedule was suspended for long. Beyond it the latest is looked up from now.
+const maxMissedSchedules = 100
+
+// MysqlBackupScheduleReconciler reconciles a MysqlBackupSchedule object
+type MysqlBackupScheduleReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Recorder records the created and expired backups as events of the schedule.
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=database.wufan,resources=mysqlbackupschedules,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=database.wufan,resources=mysqlbackupschedules/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=database.wufan,resources=mysqlbackupschedules/finalizers,verbs=update
+
+// Reconcile creates the backup that is due, deletes the backups the retention expired and
+// records the latest backups in the status. The schedule is requeued for its next backup or
+// expiry, there is no CronJob. The backups are not owned by the schedule, they are kept when
+// it is deleted.
+func (r *MysqlBackupScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	schedule := &databasev1.MysqlBackupSchedule{}
+	if err := r.Get(ctx, req.NamespacedName, schedule); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !schedule.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	status := schedule.Status.DeepCopy()
+	// the webhook may not be deployed
+	schedule.Default()
+	if errs := schedule.ValidateSpec(); len(errs) > 0 {
+		status.Message = errs.ToAggregate().Error()
+		return ctrl.Result{}, r.updateStatus(ctx, schedule, status)
+	}
+	sched, err := cron.ParseStandard(schedule.Spec.Schedule)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	now := time.Now()
+
+	backups := &databasev1.MysqlBackupList{}
+	if err := r.List(ctx, backups, client.InNamespace(schedule.Namespace),
+		client.MatchingLabels{databasev1.BackupScheduleLabel: schedule.Name}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list backups of schedule %s: %w", schedule.Name, err)
+	}
+	items := backups.Items
+	sort.Slice(items, func(i, j int) bool {
+		return scheduledTime(&items[i]).After(scheduledTime(&items[j]))
+	})
+
+	var active []*databasev1.MysqlBackup
+	for i := range items {
+		if items[i].GetDeletionTimestamp().IsZero() && !items[i].Finished() {
+			active = append(active, &items[i])
+		}
+	}
+
+	// the latest missed backup is taken, the earlier ones are skipped
+	last := schedule.CreationTimestamp.Time
+	if status.LastScheduleTime != nil {
+		last = status.LastScheduleTime.Time
+	}
+	due := latestDue(sched, last, now)
+	if !due.IsZero() && !schedule.Spec.Suspend {
+		created, message, err := r.startBackup(ctx, schedule, active, due, now)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if created != nil {
+			items = append([]databasev1.MysqlBackup{*created}, items...)
+		}
+		dueTime := metav1.NewTime(due)
+		status.LastScheduleTime = &dueTime
+		status.Message = message
+	}
+
+	expiry, err := r.applyRetention(ctx, schedule, items, now)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	status.Active = nil
+	for i := range items {
+		backup := &items[i]
+		if backup.GetDeletionTimestamp().IsZero() && !backup.Finished() {
+			status.Active = append(status.Active, backup.Name)
+		}
+		if backup.Status.Phase == databasev1.BackupPhaseCompleted && backup.Status.CompletionTime != nil &&
+			(status.LastSuccessfulTime == nil || status.LastSuccessfulTime.Before(backup.Status.CompletionTime)) {
+			status.LastSuccessfulTime = backup.Status.CompletionTime.DeepCopy()
+		}
+	}
+	status.History = backupHistory(status.History, items)
+	next := metav1.NewTime(sched.Next(now))
+	status.NextScheduleTime = &next
+	if err := r.updateStatus(ctx, schedule, status); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	requeue := next.Sub(now)
+	if !expiry.IsZero() && expiry.Sub(now) < requeue {
+		requeue = expiry.Sub(now)
+	}
+	return ctrl.Result{RequeueAfter: requeue + time.Second}, nil
+}
+
+// startBackup creates the backup due at the given time unless the starting deadline passed or
+// the concurrency policy forbids it. It returns the created backup, or why it was skipped.
+func (r *MysqlBackupScheduleReconciler) startBackup(ctx context.Context, schedule *databasev1.MysqlBackupSchedule,
+	active []*databasev1.MysqlBackup, due, now time.Time) (*databasev1.MysqlBackup, string, error) {
+	if d := schedule.Spec.StartingDeadlineSeconds; d != nil && now.After(due.Add(time.Duration(*d)*time.Second)) {
+		message := fmt.Sprintf("skipped the backup of %s, the starting deadline passed", due.UTC().Format(time.RFC3339))
+		r.Recorder.Event(schedule, corev1.EventTypeWarning, "MissedSchedule", message)
+		return nil, message, nil
+	}
+	if len(active) > 0 {
+		switch schedule.Spec.ConcurrencyPolicy {
+		case databasev1.ConcurrencyPolicyForbid:
+			message := fmt.Sprintf("skipped the backup of %s, %s is still running", due.UTC().Format(time.RFC3339), active[0].Name)
+			r.Recorder.Event(schedule, corev1.EventTypeWarning, "SkippedSchedule", message)
+			return nil, message, nil
+		case databasev1.ConcurrencyPolicyReplace:
+			for _, backup := range active {
+				log.Log.Info("replace running backup", "clusterspace", schedule.Namespace, "schedule", schedule.Name, "backup", backup.Name)
+				if err := r.Delete(ctx, backup); client.IgnoreNotFound(err) != nil {
+					return nil, "", fmt.Errorf("failed to delete backup %s: %w", backup.Name, err)
+				}
+				backup.DeletionTimestamp = &metav1.Time{Time: now}
+			}
+		}
+	}
+
+	backup := innodbcluster.ScheduledBackup(schedule, due)
+	if err := r.Create(ctx, backup); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return nil, "", nil
+		}
+		return nil, "", fmt.Errorf("failed to create backup %s: %w", backup.Name, err)
+	}
+	log.Log.Info("create scheduled backup", "clusterspace", schedule.Namespace, "clustername", schedule.Spec.BackupTemplate.ClusterName,
+		"schedule", schedule.Name, "backup", backup.Name)
+	r.Recorder.Eventf(schedule, corev1.EventTypeNormal, "BackupCreated", "created backup %s", backup.Name)
+	return backup, "", nil
+}
+
+// applyRetention deletes the completed backups beyond keepLast or older than keepFor, and the
+// failed backups beyond the history, the backups are ordered newest first. The data of a
+// backup is deleted by its finalizer. It returns when the next completed backup expires.
+func (r *MysqlBackupScheduleReconciler) applyRetention(ctx context.Context, schedule *databasev1.MysqlBackupSchedule,
+	backups []databasev1.MysqlBackup, now time.Time) (time.Time, error) {
+	retention := schedule.Spec.Retention
+	var expiry time.Time
+	completed := 0
+	for i := range backups {
+		backup := &backups[i]
+		if !backup.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		expired := false
+		switch backup.Status.Phase {
+		case databasev1.BackupPhaseCompleted:
+			completed++
+			if retention.KeepLast != nil && completed > int(*retention.KeepLast) {
+				expired = true
+			} else if retention.KeepFor != nil && backup.Status.CompletionTime != nil {
+				expires := backup.Status.CompletionTime.Add(retention.KeepFor.Duration)
+				if !expires.After(now) {
+					expired = true
+				} else if expiry.IsZero() || expires.Before(expiry) {
+					expiry = expires
+				}
+			}
+		case databasev1.BackupPhaseFailed:
+			expired = i >= backupHistoryLimit
+		}
+		if !expired {
+			continue
+		}
+		log.Log.Info("delete expired backup", "clusterspace", schedule.Namespace, "schedule", schedule.Name,
+			"backup", backup.Name, "location", backup.Status.Location)
+		if err := r.Delete(ctx, backup); client.IgnoreNotFound(err) != nil {
+			return expiry, fmt.Errorf("failed to delete backup %s: %w", backup.Name, err)
+		}
+		r.Recorder.Eventf(schedule, corev1.EventTypeNormal, "BackupExpired", "deleted backup %s", backup.Name)
+		backup.DeletionTimestamp = &metav1.Time{Time: now}
+	}
+	return expiry, nil
+}
+
+// backupHistory returns the latest runs of the backups, newest first. The runs of deleted
+// backups are kept as Deleted until newer ones push them out.
+func backupHistory(history []databasev1.BackupRun, backups []databasev1.MysqlBackup) []databasev1.BackupRun {
+	runs := map[string]databasev1.BackupRun{}
+	for _, run := range history {
+		run.Phase = databasev1.BackupPhaseDeleted
+		runs[run.Name] = run
+	}
+	for i := range backups {
+		backup := &backups[i]
+		run := databasev1.BackupRun{
+			Name:          backup.Name,
+			ScheduledTime: metav1.NewTime(scheduledTime(backup)),
+			Phase:         backup.Status.Phase,
+			Size:          backup.Status.Size,
+			Location:      backup.Status.Location,
+		}
+		if run.Phase == "" {
+			run.Phase = databasev1.BackupPhasePending
+		}
+		if !backup.GetDeletionTimestamp().IsZero() {
+			run.Phase = databasev1.BackupPhaseDeleted
+		}
+		if backup.Status.CompletionTime != nil {
+			run.CompletionTime = backup.Status.CompletionTime.DeepCopy()
+		}
+		runs[run.Name] = run
+	}
+
+	result := make([]databasev1.BackupRun, 0, len(runs))
+	for _, run := range runs {
+		result = append(result, run)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].ScheduledTime.Equal(&result[j].ScheduledTime) {
+			return result[j].ScheduledTime.Before(&result[i].ScheduledTime)
+		}
+		return result[i].Name < result[j].Name
+	})
+	if len(result) > backupHistoryLimit {
+		result = result[:backupHistoryLimit]
+	}
+	return result
+}
+
+// latestDue returns the latest time a backup was due after last until now, zero if none was.
+func latestDue(sched cron.Schedule, last, now time.Time) time.Time {
+	var due time.Time
+	missed := 0
+	for t := sched.Next(last); !t.After(now); t = sched.Next(t) {
+		if missed++; missed > maxMissedSchedules {
+			return latestSince(sched, t, now)
+		}
+		due = t
+	}
+	return due
+}
+
+// latestSince returns the latest time of the schedule until now, from being one of them. The
+// window before now is doubled until it holds a time of the schedule.
+func latestSince(sched cron.Schedule, from, now time.Time) time.Time {
+	latest := from
+	for window := time.Minute; now.Add(-window).After(from); window *= 2 {
+		if t := sched.Next(now.Add(-window)); !t.After(now) {
+			latest = t
+			break
+		}
+	}
+	for t := sched.Next(latest); !t.After(now); t = sched.Next(t) {
+		latest = t
+	}
+	return latest
+}
+
+// scheduledTime returns the time the backup was due, its creation time if it has none.
+func scheduledTime(backup *databasev1.MysqlBackup) time.Time {
+	if t, err := time.Parse(time.RFC3339, backup.Annotations[databasev1.BackupScheduledTimeAnnotation]); err == nil {
+		return t
+	}
+	return backup.CreationTimestamp.Time
+}
+
+func (r *MysqlBackupScheduleReconciler) updateStatus(ctx context.Context, schedule *databasev1.MysqlBackupSchedule, status *databasev1.MysqlBackupScheduleStatus) error {
+	if equality.Semantic.DeepEqual(status, &schedule.Status) {
+		return nil
+	}
+	schedule.Status = *status
+	return r.Status().Update(ctx, schedule)
+}
+
+// SetupWithManager sets up the controller with the Manager. The backups of a schedule are
+// found by their label, they have no owner.
+func (r *MysqlBackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&databasev1.MysqlBackupSchedule{}).
+		Watches(&databasev1.MysqlBackup{}, handler.EnqueueRequestsFromMapFunc(
+			func(ctx context.Context, obj client.Object) []reconcile.Request {
+				name, ok := obj.GetLabels()[databasev1.BackupScheduleLabel]
+				if !ok {
+					return nil
+				}
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: obj.GetNamespace()}}}
+			})).
+		Complete(r)
+}
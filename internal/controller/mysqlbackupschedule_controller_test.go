@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+var scheduleNow = time.Date(2024, 6, 1, 12, 0, 30, 0, time.UTC)
+
+func testSchedule(retention databasev1.BackupRetention) *databasev1.MysqlBackupSchedule {
+	return &databasev1.MysqlBackupSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "daily", Namespace: "default"},
+		Spec: databasev1.MysqlBackupScheduleSpec{
+			Schedule:       "0 3 * * *",
+			Retention:      retention,
+			BackupTemplate: databasev1.MysqlBackupSpec{ClusterName: "mysql"},
+		},
+	}
+}
+
+// scheduledBackups returns a backup per phase, newest first, one hour apart.
+func scheduledBackups(schedule *databasev1.MysqlBackupSchedule, phases ...string) []databasev1.MysqlBackup {
+	backups := make([]databasev1.MysqlBackup, len(phases))
+	for i, phase := range phases {
+		due := scheduleNow.Add(-time.Duration(i+1) * time.Hour).Truncate(time.Minute)
+		backups[i] = *innodbcluster.ScheduledBackup(schedule, due)
+		backups[i].Status.Phase = phase
+		if phase == databasev1.BackupPhaseCompleted || phase == databasev1.BackupPhaseFailed {
+			completed := metav1.NewTime(due.Add(10 * time.Minute))
+			backups[i].Status.CompletionTime = &completed
+		}
+	}
+	return backups
+}
+
+func TestApplyRetention(t *testing.T) {
+	keepLast := int32(2)
+	const (
+		completed = databasev1.BackupPhaseCompleted
+		failed    = databasev1.BackupPhaseFailed
+		running   = databasev1.BackupPhaseRunning
+	)
+	for _, tc := range []struct {
+		name       string
+		retention  databasev1.BackupRetention
+		phases     []string
+		deleting   []int
+		wantDelete []int
+		wantExpiry time.Duration
+	}{
+		{
+			name:   "no retention keeps the completed backups",
+			phases: []string{completed, completed, completed},
+		},
+		{
+			name:       "keepLast counts the completed backups only",
+			retention:  databasev1.BackupRetention{KeepLast: &keepLast},
+			phases:     []string{running, completed, failed, completed, completed, completed},
+			wantDelete: []int{4, 5},
+		},
+		{
+			name:       "a deleted backup is not counted",
+			retention:  databasev1.BackupRetention{KeepLast: &keepLast},
+			phases:     []string{completed, completed, completed},
+			deleting:   []int{0},
+			wantDelete: nil,
+		},
+		{
+			name:       "keepFor deletes the older backups",
+			retention:  databasev1.BackupRetention{KeepFor: &metav1.Duration{Duration: 150 * time.Minute}},
+			phases:     []string{completed, completed, completed, completed},
+			wantDelete: []int{2, 3},
+			// the backup of two hours ago completed at 10:10
+			wantExpiry: 40*time.Minute - 30*time.Second,
+		},
+		{
+			name:       "both limits must keep a backup",
+			retention:  databasev1.BackupRetention{KeepLast: &keepLast, KeepFor: &metav1.Duration{Duration: 90 * time.Minute}},
+			phases:     []string{completed, completed, completed},
+			wantDelete: []int{1, 2},
+			wantExpiry: 40*time.Minute - 30*time.Second,
+		},
+		{
+			name: "failed backups are deleted once they drop out of the history",
+			phases: []string{failed, completed, failed, failed, failed, failed, failed, failed, failed, failed,
+				failed, completed, failed},
+			wantDelete: []int{10, 12},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newMemoryClient(t)
+			r := &MysqlBackupScheduleReconciler{Client: c, Scheme: c.Scheme(), Recorder: record.NewFakeRecorder(100)}
+			schedule := testSchedule(tc.retention)
+			backups := scheduledBackups(schedule, tc.phases...)
+			for i := range backups {
+				if err := c.put(&backups[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, i := range tc.deleting {
+				backups[i].DeletionTimestamp = &metav1.Time{Time: scheduleNow}
+			}
+
+			expiry, err := r.applyRetention(context.Background(), schedule, backups, scheduleNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for _, i := range tc.wantDelete {
+				want = append(want, backups[i].Name)
+			}
+			if !reflect.DeepEqual(c.deleted, want) {
+				t.Errorf("deleted %v, want %v", c.deleted, want)
+			}
+			for _, i := range tc.wantDelete {
+				if backups[i].GetDeletionTimestamp().IsZero() {
+					t.Errorf("backup %s is not marked deleted", backups[i].Name)
+				}
+			}
+			switch {
+			case tc.wantExpiry == 0 && !expiry.IsZero():
+				t.Errorf("expiry = %s, want none", expiry)
+			case tc.wantExpiry != 0 && !expiry.Equal(scheduleNow.Add(tc.wantExpiry)):
+				t.Errorf("expiry = %s, want %s", expiry, scheduleNow.Add(tc.wantExpiry))
+			}
+		})
+	}
+}
+
+func TestBackupHistory(t *testing.T) {
+	schedule := testSchedule(databasev1.BackupRetention{})
+	backups := scheduledBackups(schedule, "", databasev1.BackupPhaseRunning, databasev1.BackupPhaseCompleted)
+	backups[2].Status.Size, backups[2].Status.Location = "1Gi", "pvc://backup/default-daily"
+	backups[1].DeletionTimestamp = &metav1.Time{Time: scheduleNow}
+
+	// the run of a backup that is gone, and older runs of which the oldest fall out of the history
+	gone := databasev1.BackupRun{Name: "daily-gone", ScheduledTime: metav1.NewTime(scheduleNow.Add(-5 * time.Hour)),
+		Phase: databasev1.BackupPhaseCompleted}
+	history := []databasev1.BackupRun{gone}
+	for i := 0; i < backupHistoryLimit; i++ {
+		history = append(history, databasev1.BackupRun{Name: fmt.Sprintf("daily-old-%02d", i),
+			ScheduledTime: metav1.NewTime(scheduleNow.Add(-time.Duration(100+i) * time.Hour))})
+	}
+
+	got := backupHistory(history, backups)
+	if len(got) != backupHistoryLimit {
+		t.Fatalf("history has %d runs, want %d", len(got), backupHistoryLimit)
+	}
+	want := []struct{ name, phase string }{
+		{backups[0].Name, databasev1.BackupPhasePending},
+		{backups[1].Name, databasev1.BackupPhaseDeleted},
+		{backups[2].Name, databasev1.BackupPhaseCompleted},
+		{gone.Name, databasev1.BackupPhaseDeleted},
+		{"daily-old-00", databasev1.BackupPhaseDeleted},
+	}
+	for i, w := range want {
+		if got[i].Name != w.name || got[i].Phase != w.phase {
+			t.Errorf("run %d = %s %s, want %s %s", i, got[i].Name, got[i].Phase, w.name, w.phase)
+		}
+	}
+	if got[2].Size != "1Gi" || got[2].Location != "pvc://backup/default-daily" || got[2].CompletionTime == nil {
+		t.Errorf("completed run = %+v", got[2])
+	}
+	if last := got[len(got)-1].Name; last != "daily-old-05" {
+		t.Errorf("oldest run = %s, want daily-old-05", last)
+	}
+}
+
+func TestLatestDue(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		schedule string
+		last     time.Time
+		want     time.Time
+	}{
+		{"nothing due", "0 3 * * *", time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC), time.Time{}},
+		{"one due", "0 3 * * *", time.Date(2024, 5, 31, 3, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)},
+		{"some missed", "0 * * * *", time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{"a year missed", "* * * * *", scheduleNow.AddDate(-1, 0, 0), time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{"a year of weekdays missed", "30 1 * * 1-5", scheduleNow.AddDate(-1, 0, 0), time.Date(2024, 5, 31, 1, 30, 0, 0, time.UTC)},
+	} {
+		sched, err := cron.ParseStandard(tc.schedule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := latestDue(sched, tc.last, scheduleNow); !got.Equal(tc.want) {
+			t.Errorf("%s: latestDue = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+const (
+	// RecoveryRejoin rejoins a member that left the group.
+	RecoveryRejoin = "RejoinInstance"
+	// RecoveryRebuild clones the data of a member that has transactions the group does not have.
+	RecoveryRebuild = "RebuildInstance"
+	// RecoveryReboot restarts the group after all members went offline.
+	RecoveryReboot = "RebootCluster"
+	// RecoveryWaiting waits for the members to be reachable before the group is rebooted.
+	RecoveryWaiting = "WaitingForMembers"
+	// RecoveryMissing reports registered members that can not be reached, they are left to
+	// kubernetes.
+	RecoveryMissing = "MembersMissing"
+)
+
+// rebootTimeout is how long the reboot of the group waits for a majority of the members,
+// after it the group is rebooted on the reachable members.
+const rebootTimeout = 5 * time.Minute
+
+// recoveryAction is a recovery step taken on the group, it is recorded as an event and
+// in the Recovery condition.
+type recoveryAction struct {
+	Reason  string
+	Message string
+}
+
+// active reports whether the group is being recovered, missing members are only reported
+// and the group can still change without them.
+func (a *recoveryAction) active() bool {
+	return a != nil && a.Reason != RecoveryMissing
+}
+
+// RecoverCluster checks the members of an installed cluster and takes at most one recovery
+// action per reconcile:
+//   - a registered member that left the group is rejoined,
+//   - a member with transactions the group does not have is rebuilt with a clone,
+//   - when no member is online the group is rebooted on the member with the most advanced
+//     gtid set, once a majority of the members is reachable or after rebootTimeout.
+//
+// Unreachable members are left to kubernetes, which restarts their pods, the registered ones
+// are reported in the Recovery condition. It returns the action taken, nil if there was none.
+func (r *MysqlReconciler) RecoverCluster(ctx context.Context, ins *databasev1.Mysql, members []*innodbcluster.MemberInfo) (*recoveryAction, error) {
+	statefulSet, err := installedStatefulSet(ctx, r.Client, ins)
+	if err != nil || statefulSet == nil {
+		return nil, err
+	}
+	passwd, err := RootPassword(ctx, r.Client, ins)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*innodbcluster.MemberInfo, ins.Spec.Replica)
+	reachable, online, primary := 0, 0, -1
+	for i := range infos {
+		info := memberInfo(members, i)
+		if info.State == databasev1.MemberStateMissing {
+			continue
+		}
+		infos[i] = info
+		reachable++
+		if info.State == databasev1.MemberStateOnline {
+			online++
+			if info.Role == databasev1.MemberRolePrimary {
+				primary = i
+			}
+		}
+	}
+
+	if online == 0 {
+		if reachable == 0 {
+			return r.waitForMembers(ins, reachable), nil
+		}
+		if reachable <= len(infos)/2 {
+			current := meta.FindStatusCondition(ins.Status.Conditions, databasev1.ConditionRecovery)
+			if current == nil || current.Status != metav1.ConditionTrue || current.Reason != RecoveryWaiting ||
+				time.Since(current.LastTransitionTime.Time) < rebootTimeout {
+				return r.waitForMembers(ins, reachable), nil
+			}
+		}
+		seed, err := mostAdvancedMember(ctx, ins, passwd, infos)
+		if err != nil {
+			return nil, err
+		}
+		action := &recoveryAction{Reason: RecoveryReboot,
+			Message: fmt.Sprintf("reboot the cluster from complete outage on %s, %d of %d members reachable",
+				innodbcluster.MemberName(ins, seed), reachable, len(infos))}
+		return action, r.recover(ins, action, innodbcluster.RebootCluster(ctx, ins, passwd, seed))
+	}
+	if primary < 0 {
+		// the online members have no quorum, this needs an operator
+		return nil, nil
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, memberQueryTimeout)
+	instances, err := innodbcluster.ClusterInstances(queryCtx, ins, innodbcluster.MemberHost(ins, primary), passwd)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster metadata: %w", err)
+	}
+	var missing []string
+	for i, info := range infos {
+		if !instances[innodbcluster.MemberAddress(ins, i)] {
+			continue
+		}
+		name := innodbcluster.MemberName(ins, i)
+		if info == nil {
+			missing = append(missing, name)
+			continue
+		}
+		if info.State != databasev1.MemberStateOffline && info.State != databasev1.MemberStateError {
+			continue
+		}
+		subset, err := innodbcluster.GtidSubset(ctx, ins, innodbcluster.MemberHost(ins, primary), passwd,
+			info.GtidExecuted, infos[primary].GtidExecuted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare gtid set of %s: %w", name, err)
+		}
+		if !subset {
+			action := &recoveryAction{Reason: RecoveryRebuild,
+				Message: fmt.Sprintf("member %s has transactions the group does not have, clone it", name)}
+			return action, r.recover(ins, action, innodbcluster.RebuildInstance(ctx, ins, passwd, primary, i))
+		}
+		action := &recoveryAction{Reason: RecoveryRejoin, Message: fmt.Sprintf("member %s is %s, rejoin it", name, info.State)}
+		return action, r.recover(ins, action, innodbcluster.RejoinInstance(ctx, ins, passwd, primary, i))
+	}
+	if len(missing) > 0 {
+		log.Log.Info("registered members are not reachable", "clusterspace", ins.Namespace, "clustername", ins.Name, "members", missing)
+		return &recoveryAction{Reason: RecoveryMissing,
+			Message: fmt.Sprintf("registered members are not reachable: [%s]", strings.Join(missing, ","))}, nil
+	}
+	return nil, nil
+}
+
+// waitForMembers records that the reboot of the group waits for the members to be
+// reachable, the event is only recorded when the wait starts.
+func (r *MysqlReconciler) waitForMembers(ins *databasev1.Mysql, reachable int) *recoveryAction {
+	action := &recoveryAction{Reason: RecoveryWaiting,
+		Message: fmt.Sprintf("no member is online, %d of %d members reachable, the cluster is rebooted once a majority is or after %s",
+			reachable, ins.Spec.Replica, rebootTimeout)}
+	if current := meta.FindStatusCondition(ins.Status.Conditions, databasev1.ConditionRecovery); current == nil ||
+		current.Status != metav1.ConditionTrue || current.Reason != RecoveryWaiting {
+		log.Log.Info("wait for members to reboot the cluster", "clusterspace", ins.Namespace, "clustername", ins.Name, "reachable", reachable)
+		r.Recorder.Event(ins, corev1.EventTypeWarning, action.Reason, action.Message)
+	}
+	return action
+}
+
+// recover records the outcome of action as an event.
+func (r *MysqlReconciler) recover(ins *databasev1.Mysql, action *recoveryAction, err error) error {
+	if err != nil {
+		r.Recorder.Event(ins, corev1.EventTypeWarning, action.Reason, fmt.Sprintf("%s failed: %v", action.Message, err))
+		return err
+	}
+	log.Log.Info("recovery action", "clusterspace", ins.Namespace, "clustername", ins.Name, "reason", action.Reason, "message", action.Message)
+	r.Recorder.Event(ins, corev1.EventTypeNormal, action.Reason, action.Message)
+	return nil
+}
+
+// mostAdvancedMember returns the ordinal of the member whose gtid set contains the ones
+// of all other members, the members that could not be read are nil and skipped.
+func mostAdvancedMember(ctx context.Context, ins *databasev1.Mysql, passwd string, infos []*innodbcluster.MemberInfo) (int, error) {
+	for i, candidate := range infos {
+		if candidate == nil {
+			continue
+		}
+		advanced := true
+		for j, other := range infos {
+			if i == j || other == nil {
+				continue
+			}
+			subset, err := innodbcluster.GtidSubset(ctx, ins, innodbcluster.MemberHost(ins, i), passwd, other.GtidExecuted, candidate.GtidExecuted)
+			if err != nil {
+				return 0, fmt.Errorf("failed to compare gtid sets: %w", err)
+			}
+			if !subset {
+				advanced = false
+				break
+			}
+		}
+		if advanced {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("the gtid sets of the members diverged, no member has all transactions")
+}
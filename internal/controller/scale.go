@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+	"axe/cluster/innodbcluster/dba"
+)
+
+// installedStatefulSet returns the statefulset once the bootstrap of the innodb cluster completed.
+func installedStatefulSet(ctx context.Context, c client.Client, ins *databasev1.Mysql) (*appsv1.StatefulSet, error) {
+	statefulSet := &appsv1.StatefulSet{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(ins), statefulSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get StatefulSet %s: %w", ins.Name, err)
+	}
+	if !ins.Status.Bootstrap.Completed {
+		return nil, nil
+	}
+	return statefulSet, nil
+}
+
+// onlinePrimary returns the ordinal of the first online primary below limit, -1 if there
+// is none.
+func onlinePrimary(members []*innodbcluster.MemberInfo, limit int) int {
+	for i := 0; i < limit && i < len(members); i++ {
+		if info := memberInfo(members, i); info.State == databasev1.MemberStateOnline && info.Role == databasev1.MemberRolePrimary {
+			return i
+		}
+	}
+	return -1
+}
+
+// primaryCandidate returns the ordinal of the online secondary below limit with the
+// smallest applier queue, -1 if no secondary caught up with the group.
+func primaryCandidate(members []*innodbcluster.MemberInfo, limit int) int {
+	candidate := -1
+	for i := 0; i < limit && i < len(members); i++ {
+		info := memberInfo(members, i)
+		if info.State != databasev1.MemberStateOnline || info.Role != databasev1.MemberRoleSecondary ||
+			info.Lag >= laggedTransactions {
+			continue
+		}
+		if candidate < 0 || info.Lag < members[candidate].Lag {
+			candidate = i
+		}
+	}
+	return candidate
+}
+
+// ScaleIn removes the members above spec.replica from the group, highest ordinal first,
+// before the statefulset shrinks. They are removed through the online primary, a removed
+// primary is moved to a secondary that caught up beforehand. Without an online primary it
+// waits. It reports whether a scale in is in progress.
+func ScaleIn(ctx context.Context, c client.Client, ins *databasev1.Mysql, members []*innodbcluster.MemberInfo) (bool, error) {
+	statefulSet, err := installedStatefulSet(ctx, c, ins)
+	if err != nil || statefulSet == nil || statefulSet.Spec.Replicas == nil {
+		return false, err
+	}
+	current := int(*statefulSet.Spec.Replicas)
+	if current <= int(ins.Spec.Replica) {
+		return false, nil
+	}
+	log.Log.Info("scale in innodb cluster", "clustername", ins.Name, "from", current, "to", ins.Spec.Replica)
+
+	passwd, err := RootPassword(ctx, c, ins)
+	if err != nil {
+		return true, err
+	}
+
+	primary := onlinePrimary(members, int(ins.Spec.Replica))
+	if removed := onlinePrimary(members, current); primary < 0 && removed >= 0 && memberInfo(members, removed).SinglePrimary {
+		target := primaryCandidate(members, int(ins.Spec.Replica))
+		if target < 0 {
+			log.Log.Info("wait for a secondary to catch up to move the primary to", "clustername", ins.Name,
+				"primary", innodbcluster.MemberName(ins, removed))
+			return true, nil
+		}
+		if err := innodbcluster.SetPrimaryInstance(ctx, ins, passwd, target); err != nil {
+			return true, err
+		}
+		primary = target
+	}
+	if primary < 0 {
+		log.Log.Info("wait for an online primary to remove the members through", "clustername", ins.Name)
+		return true, nil
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, memberQueryTimeout)
+	instances, err := innodbcluster.ClusterInstances(queryCtx, ins, innodbcluster.MemberHost(ins, primary), passwd)
+	cancel()
+	if err != nil {
+		log.Log.Info("read cluster metadata failed", "clustername", ins.Name, "error", err.Error())
+		return true, nil
+	}
+	// a member that is registered but not in the group can not be removed, its registration
+	// is dropped by a rescan
+	var stale []int
+	for i := current - 1; i >= int(ins.Spec.Replica); i-- {
+		if !instances[innodbcluster.MemberAddress(ins, i)] {
+			continue
+		}
+		missing := memberInfo(members, i).State == databasev1.MemberStateMissing
+		err := innodbcluster.RemoveInstance(ctx, ins, passwd, primary, i, missing)
+		switch {
+		case dba.IsReason(err, dba.ReasonNotInCluster):
+			stale = append(stale, i)
+		case err != nil:
+			return true, err
+		}
+	}
+	if len(stale) > 0 {
+		return true, innodbcluster.RescanCluster(ctx, ins, passwd, primary, stale)
+	}
+	return true, nil
+}
+
+// ScaleOut adds the members of new ordinals to the group with clone recovery once
+// their pods are ready, through the online primary. Without an online primary the members
+// can not be compared with the metadata, it waits for one. It reports whether a scale out
+// is in progress.
+func ScaleOut(ctx context.Context, c client.Client, ins *databasev1.Mysql, members []*innodbcluster.MemberInfo) (bool, error) {
+	statefulSet, err := installedStatefulSet(ctx, c, ins)
+	if err != nil || statefulSet == nil {
+		return false, err
+	}
+
+	passwd, err := RootPassword(ctx, c, ins)
+	if err != nil {
+		return false, err
+	}
+	primary := onlinePrimary(members, int(ins.Spec.Replica))
+	if primary < 0 {
+		log.Log.Info("wait for an online primary to read the cluster metadata", "clustername", ins.Name)
+		return false, nil
+	}
+	queryCtx, cancel := context.WithTimeout(ctx, memberQueryTimeout)
+	instances, err := innodbcluster.ClusterInstances(queryCtx, ins, innodbcluster.MemberHost(ins, primary), passwd)
+	cancel()
+	if err != nil {
+		log.Log.Info("read cluster metadata failed", "clustername", ins.Name, "error", err.Error())
+		return false, nil
+	}
+
+	// an added member is registered while its data is still cloned
+	var missing []int
+	joining := false
+	for i := 0; i < int(ins.Spec.Replica); i++ {
+		if !instances[innodbcluster.MemberAddress(ins, i)] {
+			missing = append(missing, i)
+		} else if memberJoining(ctx, ins, passwd, i, memberInfo(members, i)) {
+			joining = true
+		}
+	}
+	if len(missing) == 0 {
+		return joining, nil
+	}
+	if statefulSet.Status.ReadyReplicas < ins.Spec.Replica {
+		log.Log.Info("wait for new members to be ready", "clustername", ins.Name, "ReadyReplicas", statefulSet.Status.ReadyReplicas)
+		return true, nil
+	}
+	if joining || memberJoining(ctx, ins, passwd, missing[0], memberInfo(members, missing[0])) {
+		log.Log.Info("wait for members to join", "clustername", ins.Name)
+		return true, nil
+	}
+
+	// one member per reconcile, the others are added on the next ones
+	log.Log.Info("scale out innodb cluster", "clustername", ins.Name, "member", strconv.Itoa(missing[0]))
+	if err := innodbcluster.AddInstance(ctx, ins, passwd, primary, missing[0]); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// memberJoining reports whether the member of ordinal is still joining the group after it
+// was added: its data is cloned or it recovers the missing transactions. A member restarting
+// with the cloned data can not be reached, adding it fails until it is ready. A failed clone
+// is logged, the member is added again. info is the state of the member.
+func memberJoining(ctx context.Context, ins *databasev1.Mysql, passwd string, ordinal int, info *innodbcluster.MemberInfo) bool {
+	switch info.State {
+	case databasev1.MemberStateMissing, databasev1.MemberStateOnline:
+		return false
+	case databasev1.MemberStateRecovering:
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, memberQueryTimeout)
+	defer cancel()
+	clone, err := innodbcluster.CloneStatus(ctx, ins, innodbcluster.MemberHost(ins, ordinal), passwd)
+	if err != nil || clone == nil {
+		return false
+	}
+	switch clone.State {
+	case innodbcluster.CloneStateInProgress:
+		log.Log.Info("member is cloning", "member", innodbcluster.MemberName(ins, ordinal), "donor", clone.Source)
+		return true
+	case innodbcluster.CloneStateFailed:
+		log.Log.Info("clone failed", "member", innodbcluster.MemberName(ins, ordinal), "donor", clone.Source, "error", clone.Error)
+	}
+	return false
+}
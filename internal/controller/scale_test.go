@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"testing"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+func TestPrimaryCandidate(t *testing.T) {
+	online := func(role string, lag int64) *innodbcluster.MemberInfo {
+		return &innodbcluster.MemberInfo{State: databasev1.MemberStateOnline, Role: role, Lag: lag}
+	}
+	for _, tc := range []struct {
+		name    string
+		members []*innodbcluster.MemberInfo
+		limit   int
+		want    int
+	}{
+		{
+			name: "secondary with the smallest queue",
+			members: []*innodbcluster.MemberInfo{
+				online(databasev1.MemberRoleSecondary, 20),
+				online(databasev1.MemberRoleSecondary, 5),
+				online(databasev1.MemberRolePrimary, 0),
+			},
+			limit: 2,
+			want:  1,
+		},
+		{
+			name: "lagged and offline members are skipped",
+			members: []*innodbcluster.MemberInfo{
+				online(databasev1.MemberRoleSecondary, laggedTransactions),
+				{State: databasev1.MemberStateOffline},
+				online(databasev1.MemberRoleSecondary, 0),
+				online(databasev1.MemberRolePrimary, 0),
+			},
+			limit: 3,
+			want:  2,
+		},
+		{
+			name: "members above the limit are not candidates",
+			members: []*innodbcluster.MemberInfo{
+				{State: databasev1.MemberStateMissing},
+				online(databasev1.MemberRolePrimary, 0),
+				online(databasev1.MemberRoleSecondary, 0),
+			},
+			limit: 1,
+			want:  -1,
+		},
+		{
+			name:  "members not read",
+			limit: 3,
+			want:  -1,
+		},
+	} {
+		if got := primaryCandidate(tc.members, tc.limit); got != tc.want {
+			t.Errorf("%s: primaryCandidate = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
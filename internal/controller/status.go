@@ -0,0 +1,331 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+const (
+	// statusInterval is how often the member status is refreshed.
+	statusInterval = 30 * time.Second
+	// laggedTransactions is the applier queue size from which a member is lagged.
+	laggedTransactions = 100
+	// memberQueryTimeout bounds the status query of a single member.
+	memberQueryTimeout = 5 * time.Second
+)
+
+// progress is what a reconcile did to the cluster, it is reported in the status.
+type progress struct {
+	// bootstrap is the progress of the bootstrap, nil once it completed.
+	bootstrap *bootstrapState
+	// scaling is the ScaleIn or ScaleOut state when members are being removed or added.
+	scaling string
+	// recovery is the recovery action taken, if any.
+	recovery *recoveryAction
+	// switchover is the state of the switchover, nil without one.
+	switchover *switchoverState
+	// topology is why the topology mode can not be switched, if it is blocked.
+	topology string
+	// variables is the state of the changed mysqld variables.
+	variables []databasev1.VariableStatus
+	// groupReplication are the group replication settings in effect, nil if they were not read.
+	groupReplication *databasev1.GroupReplication
+	// tls is the certificate in use, nil without spec.tls.
+	tls *tlsState
+}
+
+// queryMembers reads the state of the members in parallel, up to spec.replica or the
+// replicas of the statefulset if it has more. The members are read once per reconcile and
+// passed to its steps, a member that can not be reached is MISSING. It returns nil before
+// the statefulset exists.
+func queryMembers(ctx context.Context, c client.Client, ins *databasev1.Mysql) ([]*innodbcluster.MemberInfo, error) {
+	statefulSet := &appsv1.StatefulSet{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(ins), statefulSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get StatefulSet %s: %w", ins.Name, err)
+	}
+	passwd, err := RootPassword(ctx, c, ins)
+	if err != nil {
+		return nil, err
+	}
+
+	count := int(ins.Spec.Replica)
+	if statefulSet.Spec.Replicas != nil && int(*statefulSet.Spec.Replicas) > count {
+		count = int(*statefulSet.Spec.Replicas)
+	}
+	members := make([]*innodbcluster.MemberInfo, count)
+	var wg sync.WaitGroup
+	for i := range members {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			queryCtx, cancel := context.WithTimeout(ctx, memberQueryTimeout)
+			defer cancel()
+			info, err := innodbcluster.QueryMember(queryCtx, ins, innodbcluster.MemberHost(ins, i), passwd)
+			if err != nil {
+				log.Log.Info("query member failed", "member", innodbcluster.MemberName(ins, i), "error", err.Error())
+			}
+			members[i] = info
+		}(i)
+	}
+	wg.Wait()
+	return members, nil
+}
+
+// memberInfo returns the state of the member of ordinal, MISSING if it was not read.
+func memberInfo(members []*innodbcluster.MemberInfo, ordinal int) *innodbcluster.MemberInfo {
+	if ordinal < 0 || ordinal >= len(members) || members[ordinal] == nil {
+		return &innodbcluster.MemberInfo{State: databasev1.MemberStateMissing}
+	}
+	return members[ordinal]
+}
+
+// updateStatus refreshes the cluster and member status from the statefulset and from the
+// members read by queryMembers, along with the progress of the reconcile.
+func (r *MysqlReconciler) updateStatus(ctx context.Context, ins *databasev1.Mysql, infos []*innodbcluster.MemberInfo, p progress) error {
+	status := ins.Status.DeepCopy()
+	status.ObservedGeneration = ins.Generation
+	status.Persistence = innodbcluster.PersistenceMode(ins)
+	status.Selector = labels.SelectorFromSet(labels.Set{
+		"clustername": ins.Name,
+		"app":         databasev1.MYSQLAPP,
+	}).String()
+	status.Variables = p.variables
+	if p.groupReplication != nil {
+		status.GroupReplication = p.groupReplication
+	}
+	status.TLS = nil
+	if p.tls != nil {
+		status.TLS = p.tls.Status
+	}
+
+	statefulSet := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(ins), statefulSet); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get StatefulSet %s: %w", ins.Name, err)
+	}
+
+	members := make([]databasev1.MemberStatus, 0, ins.Spec.Replica)
+	online, recovering, leader, mode := 0, 0, "", ""
+	var failed []string
+	for i := 0; i < int(ins.Spec.Replica); i++ {
+		name := innodbcluster.MemberName(ins, i)
+		info := memberInfo(infos, i)
+		member := memberStatus(ins, name, findMember(ins.Status.Members, name), info)
+		switch member.State {
+		case databasev1.MemberStateOnline:
+			online++
+		case databasev1.MemberStateRecovering:
+			recovering++
+		case databasev1.MemberStateError:
+			failed = append(failed, name)
+		}
+		if member.State == databasev1.MemberStateOnline {
+			mode = databasev1.TopologyMultiPrimary
+			if info.SinglePrimary {
+				mode = databasev1.TopologySinglePrimary
+			}
+			if member.Role == databasev1.MemberRolePrimary && info.SinglePrimary {
+				leader = name
+			}
+		}
+		members = append(members, member)
+	}
+	status.Members = members
+	status.ReadyNodes = online
+	status.Leader = leader
+	if mode != "" {
+		status.TopologyMode = mode
+	}
+
+	if p.bootstrap != nil {
+		status.Bootstrap = p.bootstrap.Status
+	}
+	bootstrapped := status.Bootstrap.Completed
+	updating := statefulSet.Status.UpdatedReplicas < statefulSet.Status.Replicas ||
+		statefulSet.Status.CurrentRevision != statefulSet.Status.UpdateRevision
+
+	setCondition(status, ins, databasev1.ConditionInit, !bootstrapped, "Bootstrapping", "innodb cluster is not created yet")
+	setCondition(status, ins, databasev1.ConditionUpdate, bootstrapped && updating, "RollingUpdate", "statefulset is rolling out a new revision")
+	setCondition(status, ins, databasev1.ConditionReady, bootstrapped && online == int(ins.Spec.Replica), "MembersOnline",
+		fmt.Sprintf("%d of %d members online", online, ins.Spec.Replica))
+	setCondition(status, ins, databasev1.ConditionError, len(failed) > 0, "MemberError",
+		fmt.Sprintf("members in error state: [%s]", strings.Join(failed, ",")))
+	setCondition(status, ins, databasev1.ConditionScaleIn, p.scaling == databasev1.ClusterScaleInState, "RemoveInstance",
+		fmt.Sprintf("scaling in to %d members", ins.Spec.Replica))
+	setCondition(status, ins, databasev1.ConditionScaleOut, p.scaling == databasev1.ClusterScaleOutState, "AddInstance",
+		fmt.Sprintf("scaling out to %d members", ins.Spec.Replica))
+	if p.recovery != nil {
+		// the wait for the members is timed from the transition of the condition, it starts
+		// again with each reason
+		if c := meta.FindStatusCondition(status.Conditions, databasev1.ConditionRecovery); c != nil && c.Reason != p.recovery.Reason {
+			meta.RemoveStatusCondition(&status.Conditions, databasev1.ConditionRecovery)
+		}
+		setCondition(status, ins, databasev1.ConditionRecovery, true, p.recovery.Reason, p.recovery.Message)
+	} else {
+		setCondition(status, ins, databasev1.ConditionRecovery, false, "NoAction", "no member needs to be recovered")
+	}
+
+	topologyReason, topologyMessage := "Switching", fmt.Sprintf("switching to %s mode", ins.Spec.Mysql.TopologyMode)
+	if p.topology != "" {
+		topologyReason, topologyMessage = "Blocked", p.topology
+	}
+	setCondition(status, ins, databasev1.ConditionTopology, bootstrapped && status.TopologyMode != "" &&
+		status.TopologyMode != ins.Spec.Mysql.TopologyMode, topologyReason, topologyMessage)
+	if p.switchover != nil {
+		setCondition(status, ins, databasev1.ConditionSwitchover, p.switchover.InProgress, p.switchover.Reason, p.switchover.Message)
+	}
+	if statefulSet.Name != "" {
+		setCondition(status, ins, databasev1.ConditionLegacyVolumes,
+			!innodbcluster.VolumeClaimTemplatesEqual(innodbcluster.VolumeTmp(ins), statefulSet.Spec.VolumeClaimTemplates), "ImmutableClaimTemplates",
+			fmt.Sprintf("volume claim templates of statefulset %s can not change, the existing volumes are kept", statefulSet.Name))
+	}
+	recordPrimaryChange(status, leader)
+
+	switch {
+	case !bootstrapped:
+		status.State = databasev1.ClusterInitState
+	case p.scaling != "":
+		status.State = p.scaling
+	case updating || online < int(ins.Spec.Replica):
+		status.State = databasev1.ClusterUpdateState
+	default:
+		status.State = databasev1.ClusterReadyState
+	}
+
+	switch {
+	case !bootstrapped && p.bootstrap != nil && p.bootstrap.Phase != "":
+		status.Phase = p.bootstrap.Phase
+	case !bootstrapped:
+		status.Phase = databasev1.PhaseProvisioning
+	case p.scaling == databasev1.ClusterScaleOutState:
+		status.Phase = databasev1.PhaseAddingMembers
+	case p.recovery.active() || recovering > 0:
+		status.Phase = databasev1.PhaseRecovering
+	case online < int(ins.Spec.Replica):
+		status.Phase = databasev1.PhaseDegraded
+	default:
+		status.Phase = databasev1.PhaseReady
+	}
+
+	if equality.Semantic.DeepEqual(status, &ins.Status) {
+		return nil
+	}
+	ins.Status = *status
+	return r.Status().Update(ctx, ins)
+}
+
+// setInvalidSpec reports the field errors of an invalid spec in the Error condition and as a
+// warning event. Nothing is applied until the spec is fixed.
+func (r *MysqlReconciler) setInvalidSpec(ctx context.Context, ins *databasev1.Mysql, errs field.ErrorList) error {
+	message := errs.ToAggregate().Error()
+	status := ins.Status.DeepCopy()
+	status.ObservedGeneration = ins.Generation
+	setCondition(status, ins, databasev1.ConditionError, true, "InvalidSpec", message)
+	if equality.Semantic.DeepEqual(status, &ins.Status) {
+		return nil
+	}
+	log.Log.Info("invalid spec", "clusterspace", ins.Namespace, "clustername", ins.Name, "errors", message)
+	r.Recorder.Event(ins, corev1.EventTypeWarning, "InvalidSpec", message)
+	ins.Status = *status
+	return r.Status().Update(ctx, ins)
+}
+
+// recordPrimaryChange appends a change to the primary history when leader is a new primary.
+// The change is a switchover while one is in progress, an election of the group otherwise.
+func recordPrimaryChange(status *databasev1.MysqlStatus, leader string) {
+	previous := ""
+	if n := len(status.PrimaryChanges); n > 0 {
+		previous = status.PrimaryChanges[n-1].To
+	}
+	if leader == "" || leader == previous {
+		return
+	}
+	reason := databasev1.PrimaryChangeElection
+	if c := meta.FindStatusCondition(status.Conditions, databasev1.ConditionSwitchover); c != nil && c.Status == metav1.ConditionTrue {
+		reason = c.Reason
+	}
+	status.PrimaryChanges = append(status.PrimaryChanges, databasev1.PrimaryChange{
+		From:   previous,
+		To:     leader,
+		Reason: reason,
+		Time:   metav1.Now(),
+	})
+	if n := len(status.PrimaryChanges); n > databasev1.MaxPrimaryChanges {
+		status.PrimaryChanges = status.PrimaryChanges[n-databasev1.MaxPrimaryChanges:]
+	}
+}
+
+func findMember(members []databasev1.MemberStatus, name string) *databasev1.MemberStatus {
+	for i := range members {
+		if members[i].Name == name {
+			return &members[i]
+		}
+	}
+	return nil
+}
+
+// memberStatus builds the status of a member, keeping the transition times of old.
+func memberStatus(ins *databasev1.Mysql, name string, old *databasev1.MemberStatus, info *innodbcluster.MemberInfo) databasev1.MemberStatus {
+	member := databasev1.MemberStatus{Name: name}
+	if old != nil {
+		member = *old.DeepCopy()
+	}
+	member.State = info.State
+	member.Role = info.Role
+	member.GtidExecuted = info.GtidExecuted
+	member.Lag = info.Lag
+
+	replicating := info.State == databasev1.MemberStateOnline || info.State == databasev1.MemberStateRecovering
+	setMemberCondition(&member, ins, databasev1.NodeConditionLeader, info.Role == databasev1.MemberRolePrimary, "Role", "member role is "+info.Role)
+	setMemberCondition(&member, ins, databasev1.NodeConditionReadOnly, info.ReadOnly, "SuperReadOnly", "super_read_only is set")
+	setMemberCondition(&member, ins, databasev1.NodeConditionReplicating, replicating, "MemberState", "member state is "+info.State)
+	setMemberCondition(&member, ins, databasev1.NodeConditionLagged, info.Lag >= laggedTransactions, "ApplierQueue",
+		fmt.Sprintf("%d transactions in applier queue", info.Lag))
+	return member
+}
+
+func conditionStatus(ok bool) metav1.ConditionStatus {
+	if ok {
+		return metav1.ConditionTrue
+	}
+	return metav1.ConditionFalse
+}
+
+func setCondition(status *databasev1.MysqlStatus, ins *databasev1.Mysql, conditionType string, ok bool, reason, message string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus(ok),
+		ObservedGeneration: ins.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+func setMemberCondition(member *databasev1.MemberStatus, ins *databasev1.Mysql, conditionType string, ok bool, reason, message string) {
+	meta.SetStatusCondition(&member.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus(ok),
+		ObservedGeneration: ins.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
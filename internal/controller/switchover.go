@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+	"axe/cluster/innodbcluster/dba"
+)
+
+const (
+	// switchoverTimeout bounds how long a switchover waits for its target to catch up and
+	// for the routers to follow the new primary.
+	switchoverTimeout = 5 * time.Minute
+)
+
+// switchoverState is the state of a switchover, it is reported in the Switchover condition.
+// Reason is the kind of primary change while in progress, Completed or Failed after.
+type switchoverState struct {
+	InProgress bool
+	Reason     string
+	Message    string
+}
+
+// ApplyMemberWeights sets group_replication_member_weight of the online members to
+// spec.mysql.memberWeights, or groupReplication.memberWeight for the members not listed.
+func ApplyMemberWeights(ctx context.Context, c client.Client, ins *databasev1.Mysql, members []*innodbcluster.MemberInfo) error {
+	statefulSet, err := installedStatefulSet(ctx, c, ins)
+	if err != nil || statefulSet == nil {
+		return err
+	}
+	passwd, err := RootPassword(ctx, c, ins)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < int(ins.Spec.Replica); i++ {
+		want := innodbcluster.DesiredMemberWeight(ins, i)
+		if info := memberInfo(members, i); info.State != databasev1.MemberStateOnline || info.Weight == want {
+			continue
+		}
+		if err := innodbcluster.SetInstanceOption(ctx, ins, passwd, i, i, dba.OptionMemberWeight, int(want)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Switchover moves the primary to the member of the switchover annotation, or back to
+// spec.mysql.preferredPrimary. The primary is only moved to an online member that caught
+// up with the group, the switchover completes once every router routes writes to it.
+// It returns nil when there is no switchover.
+func (r *MysqlReconciler) Switchover(ctx context.Context, ins *databasev1.Mysql, members []*innodbcluster.MemberInfo) (*switchoverState, error) {
+	statefulSet, err := installedStatefulSet(ctx, r.Client, ins)
+	if err != nil || statefulSet == nil || ins.Spec.Mysql.TopologyMode == databasev1.TopologyMultiPrimary {
+		return nil, err
+	}
+
+	current := meta.FindStatusCondition(ins.Status.Conditions, databasev1.ConditionSwitchover)
+	inProgress := current != nil && current.Status == metav1.ConditionTrue
+	kind := databasev1.PrimaryChangeSwitchover
+	target, err := ins.SwitchoverTarget()
+	if err != nil {
+		return r.finishSwitchover(ctx, ins, kind, false, err.Error())
+	}
+	if target < 0 {
+		preferred := ins.Spec.Mysql.PreferredPrimary
+		switch {
+		case preferred != nil && (inProgress || ins.Status.Phase == databasev1.PhaseReady):
+			kind, target = databasev1.PrimaryChangePreferred, int(*preferred)
+		case inProgress:
+			return r.finishSwitchover(ctx, ins, current.Reason, false, "the switchover was cancelled")
+		default:
+			return nil, nil
+		}
+	}
+	name := innodbcluster.MemberName(ins, target)
+	if inProgress && time.Since(current.LastTransitionTime.Time) > switchoverTimeout {
+		return r.finishSwitchover(ctx, ins, kind, false, fmt.Sprintf("switchover to %s timed out", name))
+	}
+
+	passwd, err := RootPassword(ctx, r.Client, ins)
+	if err != nil {
+		return nil, err
+	}
+	info := memberInfo(members, target)
+	caughtUp := info.State == databasev1.MemberStateOnline && info.Lag < laggedTransactions
+
+	if info.Role != databasev1.MemberRolePrimary || info.State != databasev1.MemberStateOnline {
+		switch {
+		case kind == databasev1.PrimaryChangePreferred && !caughtUp:
+			// the preferred primary is restarting or catching up, wait for it quietly
+			return nil, nil
+		case info.State != databasev1.MemberStateOnline:
+			return r.finishSwitchover(ctx, ins, kind, false, fmt.Sprintf("member %s is %s", name, info.State))
+		case !caughtUp:
+			return &switchoverState{InProgress: true, Reason: kind,
+				Message: fmt.Sprintf("waiting for %s to apply %d queued transactions", name, info.Lag)}, nil
+		}
+		if err := innodbcluster.SetPrimaryInstance(ctx, ins, passwd, target); err != nil {
+			r.Recorder.Event(ins, corev1.EventTypeWarning, kind, fmt.Sprintf("switchover to %s failed: %v", name, err))
+			return &switchoverState{InProgress: true, Reason: kind, Message: err.Error()}, err
+		}
+		r.Recorder.Event(ins, corev1.EventTypeNormal, kind, fmt.Sprintf("switched the primary to %s", name))
+		return &switchoverState{InProgress: true, Reason: kind,
+			Message: fmt.Sprintf("waiting for the routers to route writes to %s", name)}, nil
+	}
+
+	if !inProgress && kind == databasev1.PrimaryChangePreferred {
+		return nil, nil
+	}
+	following, err := routersFollow(ctx, r.Client, ins, passwd, target)
+	if err != nil {
+		return nil, err
+	}
+	if !following {
+		return &switchoverState{InProgress: true, Reason: kind,
+			Message: fmt.Sprintf("waiting for the routers to route writes to %s", name)}, nil
+	}
+	return r.finishSwitchover(ctx, ins, kind, true, fmt.Sprintf("%s is the primary", name))
+}
+
+// finishSwitchover removes the switchover annotation and records the result of the switchover.
+func (r *MysqlReconciler) finishSwitchover(ctx context.Context, ins *databasev1.Mysql, kind string, ok bool, message string) (*switchoverState, error) {
+	if _, found := ins.Annotations[databasev1.SwitchoverAnnotation]; found {
+		patch := client.MergeFrom(ins.DeepCopy())
+		delete(ins.Annotations, databasev1.SwitchoverAnnotation)
+		if err := r.Patch(ctx, ins, patch); err != nil {
+			return nil, fmt.Errorf("failed to remove annotation %s: %w", databasev1.SwitchoverAnnotation, err)
+		}
+	}
+	if !ok {
+		r.Recorder.Event(ins, corev1.EventTypeWarning, kind, message)
+		return &switchoverState{Reason: "Failed", Message: message}, nil
+	}
+	log.Log.Info("switchover completed", "clusterspace", ins.Namespace, "clustername", ins.Name, "message", message)
+	r.Recorder.Event(ins, corev1.EventTypeNormal, kind, message)
+	return &switchoverState{Reason: "Completed", Message: message}, nil
+}
+
+// routersFollow reports whether every running router routes writes to the member of target,
+// the routers are queried from that member.
+func routersFollow(ctx context.Context, c client.Client, ins *databasev1.Mysql, passwd string, target int) (bool, error) {
+	name := innodbcluster.MemberName(ins, target)
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace(ins.Namespace),
+		client.MatchingLabels{"clustername": ins.Name, "app": databasev1.MYSQLROUTERAPP}); err != nil {
+		return false, fmt.Errorf("failed to list router pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		port := int32(6446)
+		for _, container := range pod.Spec.Containers {
+			for _, p := range container.Ports {
+				if p.Name == innodbcluster.RouterRWPortName {
+					port = p.ContainerPort
+				}
+			}
+		}
+		queryCtx, cancel := context.WithTimeout(ctx, memberQueryTimeout)
+		host, err := innodbcluster.RoutedHost(queryCtx, ins, innodbcluster.MemberHost(ins, target), net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port))), passwd)
+		cancel()
+		if err != nil {
+			log.Log.Info("query router failed", "router", pod.Name, "error", err.Error())
+			return false, nil
+		}
+		if host != name {
+			return false, nil
+		}
+	}
+	return true, nil
+}
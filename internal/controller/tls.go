@@ -0,0 +1,272 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+// tlsState is the certificate in use, it is reported in status.tls.
+type tlsState struct {
+	Status *databasev1.TLSStatus
+	// Hash is the hash of the certificates, a new one rolls the members and routers.
+	Hash string
+}
+
+// ApplyTLS makes sure the certificates of spec.tls exist and are not about to expire. A
+// secret of the user is only checked, a cert-manager Certificate is applied and renewed by
+// cert-manager, otherwise the operator generates a CA and issues the certificate itself,
+// again renewBefore its expiry. It returns nil without spec.tls once the members no
+// longer verify each other.
+func ApplyTLS(ctx context.Context, c client.Client, ins *databasev1.Mysql) (*tlsState, error) {
+	done, err := persistTLSVariables(ctx, c, ins)
+	if err != nil {
+		return nil, err
+	}
+	tls := ins.Spec.TLS
+	if tls == nil {
+		if !done && ins.Status.TLS != nil {
+			return &tlsState{Status: ins.Status.TLS}, nil
+		}
+		return nil, nil
+	}
+
+	now := time.Now()
+	var secret *corev1.Secret
+	var rotation string
+	switch {
+	case tls.SecretName != "":
+		secret, err = tlsSecret(ctx, c, ins, tls.SecretName)
+	case tls.IssuerRef != nil:
+		if err := Apply(ctx, c, ins, innodbcluster.Certificate(ins)); err != nil {
+			return nil, err
+		}
+		secret, err = tlsSecret(ctx, c, ins, innodbcluster.TLSSecretName(ins))
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("certificate %s is not issued yet by %s %s", innodbcluster.TLSSecretName(ins), tls.IssuerRef.Kind, tls.IssuerRef.Name)
+		}
+	default:
+		secret, rotation, err = issueCertificate(ctx, c, ins, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range []string{innodbcluster.CACertKey, corev1.TLSCertKey, corev1.TLSPrivateKeyKey} {
+		if len(secret.Data[key]) == 0 {
+			return nil, fmt.Errorf("secret %s has no key %s", secret.Name, key)
+		}
+	}
+	cert, err := innodbcluster.ParseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate of secret %s: %w", secret.Name, err)
+	}
+	ca, err := innodbcluster.ParseCertificate(secret.Data[innodbcluster.CACertKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA of secret %s: %w", secret.Name, err)
+	}
+	if err := innodbcluster.VerifyCertificate(ins, cert, now); err != nil {
+		return nil, fmt.Errorf("secret %s can not be used: %w", secret.Name, err)
+	}
+
+	notAfter, caNotAfter := metav1.NewTime(cert.NotAfter), metav1.NewTime(ca.NotAfter)
+	return &tlsState{
+		Status: &databasev1.TLSStatus{SecretName: secret.Name, NotAfter: &notAfter, CANotAfter: &caNotAfter, CARotation: rotation},
+		Hash:   innodbcluster.TLSHash(secret.Data),
+	}, nil
+}
+
+func tlsSecret(ctx context.Context, c client.Client, ins *databasev1.Mysql, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: ins.Namespace}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get secret %s: %w", name, err)
+	}
+	return secret, nil
+}
+
+// issueCertificate returns the certificate secret of the operator generated CA. The CA is
+// renewed once it would not outlive a new certificate, the certificate once it expires
+// within renewBefore or was not signed by the CA.
+//
+// The members and routers read ca.crt when they start and only accept the peers presenting
+// a certificate signed by a CA of it. A new CA is therefore rolled out in two phases, the
+// phase is returned for status.tls. First ca.crt trusts the new and the previous CA while
+// the certificate signed by the previous CA is kept. Once every member and router restarted
+// with it, the certificate is issued by the new CA, ca.crt still trusts the previous CA for
+// the members that did not restart with the new certificate yet.
+func issueCertificate(ctx context.Context, c client.Client, ins *databasev1.Mysql, now time.Time) (*corev1.Secret, string, error) {
+	tls := ins.Spec.TLS
+	caSecret, err := tlsSecret(ctx, c, ins, innodbcluster.CASecretName(ins))
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, "", err
+	}
+	var ca *x509.Certificate
+	if caSecret != nil {
+		if ca, err = innodbcluster.ParseCertificate(caSecret.Data[corev1.TLSCertKey]); err != nil {
+			log.Log.Info("CA is invalid, generate a new one", "secret", caSecret.Name, "error", err.Error())
+		}
+	}
+	if ca == nil || now.Add(tls.Duration.Duration).After(ca.NotAfter) {
+		log.Log.Info("generate CA", "clusterspace", ins.Namespace, "clustername", ins.Name)
+		caCert, caKey, err := innodbcluster.GenerateCA(ins, now)
+		if err != nil {
+			return nil, "", err
+		}
+		caSecret = innodbcluster.TLSSecret(ins, innodbcluster.CASecretName(ins), map[string][]byte{
+			corev1.TLSCertKey:       caCert,
+			corev1.TLSPrivateKeyKey: caKey,
+		})
+		if err := Apply(ctx, c, ins, caSecret); err != nil {
+			return nil, "", err
+		}
+		if ca, err = innodbcluster.ParseCertificate(caCert); err != nil {
+			return nil, "", err
+		}
+	}
+	caCert := caSecret.Data[corev1.TLSCertKey]
+
+	secret, err := tlsSecret(ctx, c, ins, innodbcluster.TLSSecretName(ins))
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, "", err
+	}
+	var previousCA []byte
+	if secret != nil {
+		cert, err := innodbcluster.ParseCertificate(secret.Data[corev1.TLSCertKey])
+		if err == nil && innodbcluster.VerifyCertificate(ins, cert, now) == nil {
+			signer := trustedSigner(secret.Data[innodbcluster.CACertKey], cert, now)
+			switch {
+			case cert.CheckSignatureFrom(ca) == nil:
+				if now.Add(tls.RenewBefore.Duration).Before(cert.NotAfter) {
+					return secret, "", nil
+				}
+			case signer != nil && !bytes.Contains(secret.Data[innodbcluster.CACertKey], caCert):
+				log.Log.Info("trust new CA", "clusterspace", ins.Namespace, "clustername", ins.Name)
+				secret = innodbcluster.TLSSecret(ins, innodbcluster.TLSSecretName(ins), map[string][]byte{
+					innodbcluster.CACertKey: bytes.Join([][]byte{caCert, signer}, nil),
+					corev1.TLSCertKey:       secret.Data[corev1.TLSCertKey],
+					corev1.TLSPrivateKeyKey: secret.Data[corev1.TLSPrivateKeyKey],
+				})
+				if err := Apply(ctx, c, ins, secret); err != nil {
+					return nil, "", err
+				}
+				return secret, databasev1.CARotationTrusting, nil
+			case signer != nil:
+				rolledOut, err := tlsRolledOut(ctx, c, ins, innodbcluster.TLSHash(secret.Data))
+				if err != nil || !rolledOut {
+					return secret, databasev1.CARotationTrusting, err
+				}
+				previousCA = signer
+			}
+		}
+	}
+
+	log.Log.Info("issue certificate", "clusterspace", ins.Namespace, "clustername", ins.Name)
+	cert, key, err := innodbcluster.IssueCertificate(ins, caCert, caSecret.Data[corev1.TLSPrivateKeyKey], now)
+	if err != nil {
+		return nil, "", err
+	}
+	secret = innodbcluster.TLSSecret(ins, innodbcluster.TLSSecretName(ins), map[string][]byte{
+		innodbcluster.CACertKey: bytes.Join([][]byte{caCert, previousCA}, nil),
+		corev1.TLSCertKey:       cert,
+		corev1.TLSPrivateKeyKey: key,
+	})
+	if err := Apply(ctx, c, ins, secret); err != nil {
+		return nil, "", err
+	}
+	return secret, "", nil
+}
+
+// trustedSigner returns the CA of the bundle that signed cert, PEM encoded, nil if none did
+// or it expired.
+func trustedSigner(bundle []byte, cert *x509.Certificate, now time.Time) []byte {
+	cas, err := innodbcluster.ParseCertificates(bundle)
+	if err != nil {
+		return nil
+	}
+	for _, ca := range cas {
+		if cert.CheckSignatureFrom(ca) == nil && now.Before(ca.NotAfter) {
+			return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+		}
+	}
+	return nil
+}
+
+// tlsRolledOut reports whether every member and router runs with the certificates of hash.
+func tlsRolledOut(ctx context.Context, c client.Client, ins *databasev1.Mysql, hash string) (bool, error) {
+	statefulSet := &appsv1.StatefulSet{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(ins), statefulSet); err == nil {
+		s := statefulSet.Status
+		if statefulSet.Spec.Template.Annotations[innodbcluster.TLSHashAnnotation] != hash || s.ObservedGeneration < statefulSet.Generation ||
+			s.UpdatedReplicas != s.Replicas || s.ReadyReplicas != s.Replicas || s.CurrentRevision != s.UpdateRevision {
+			return false, nil
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to get StatefulSet %s: %w", ins.Name, err)
+	}
+
+	router := &appsv1.Deployment{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ins.Name + "-router", Namespace: ins.Namespace}, router); err == nil {
+		s := router.Status
+		if router.Spec.Template.Annotations[innodbcluster.TLSHashAnnotation] != hash || s.ObservedGeneration < router.Generation ||
+			s.UpdatedReplicas != s.Replicas || s.AvailableReplicas != s.Replicas {
+			return false, nil
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to get Deployment %s-router: %w", ins.Name, err)
+	}
+	return true, nil
+}
+
+// persistTLSVariables persists the group replication TLS variables of spec.tls on the
+// members, they take effect when the members restart with the new certificates. It reports
+// whether every member was checked.
+func persistTLSVariables(ctx context.Context, c client.Client, ins *databasev1.Mysql) (bool, error) {
+	if ins.Spec.TLS == nil && ins.Status.TLS == nil {
+		return true, nil
+	}
+	statefulSet, err := installedStatefulSet(ctx, c, ins)
+	if err != nil || statefulSet == nil {
+		return true, err
+	}
+	passwd, err := RootPassword(ctx, c, ins)
+	if err != nil {
+		return false, err
+	}
+
+	done := true
+	for i := 0; i < int(ins.Spec.Replica); i++ {
+		host := innodbcluster.MemberHost(ins, i)
+		queryCtx, cancel := context.WithTimeout(ctx, memberQueryTimeout)
+		persisted, err := innodbcluster.PersistedVariables(queryCtx, ins, host, passwd, "group_replication_%ssl%")
+		cancel()
+		if err != nil {
+			log.Log.Info("member is not reachable", "member", innodbcluster.MemberName(ins, i), "error", err.Error())
+			done = false
+			continue
+		}
+		for _, change := range innodbcluster.TLSVariableChanges(ins, persisted) {
+			log.Log.Info("persist tls variable", "member", innodbcluster.MemberName(ins, i), "variable", change.Name, "value", change.Value)
+			if err := innodbcluster.PersistOnlyVariable(ctx, ins, host, passwd, change); err != nil {
+				return false, err
+			}
+		}
+	}
+	return done, nil
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+func tlsMysql() *databasev1.Mysql {
+	return &databasev1.Mysql{
+		ObjectMeta: metav1.ObjectMeta{Name: "mysql", Namespace: "default", UID: "uid"},
+		Spec: databasev1.MysqlSpec{
+			Replica:     3,
+			Persistence: databasev1.Persistence{Size: "10Gi"},
+			TLS: &databasev1.TLS{
+				Duration:    &metav1.Duration{Duration: 2160 * time.Hour},
+				RenewBefore: &metav1.Duration{Duration: 720 * time.Hour},
+			},
+		},
+	}
+}
+
+func TestIssueCertificateCARotation(t *testing.T) {
+	ctx := context.Background()
+	c := newMemoryClient(t)
+	ins := tlsMysql()
+
+	issue := func(now time.Time, wantRotation string) *corev1.Secret {
+		t.Helper()
+		secret, rotation, err := issueCertificate(ctx, c, ins, now)
+		if err != nil {
+			t.Fatalf("issueCertificate: %v", err)
+		}
+		if rotation != wantRotation {
+			t.Fatalf("rotation = %q, want %q", rotation, wantRotation)
+		}
+		return secret
+	}
+	currentCA := func() []byte {
+		t.Helper()
+		secret, err := tlsSecret(ctx, c, ins, innodbcluster.CASecretName(ins))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return secret.Data[corev1.TLSCertKey]
+	}
+	signedBy := func(secret *corev1.Secret, caCert []byte) bool {
+		t.Helper()
+		cert, err := innodbcluster.ParseCertificate(secret.Data[corev1.TLSCertKey])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ca, err := innodbcluster.ParseCertificate(caCert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.CheckSignatureFrom(ca) == nil
+	}
+	// rollOut restarts the members with the certificates of secret
+	rollOut := func(secret *corev1.Secret, done bool) {
+		t.Helper()
+		statefulSet := innodbcluster.MysqlStatefulset(ins, "", innodbcluster.TLSHash(secret.Data))
+		statefulSet.Status = appsv1.StatefulSetStatus{Replicas: 3, ReadyReplicas: 3, UpdatedReplicas: 1, CurrentRevision: "1", UpdateRevision: "2"}
+		if done {
+			statefulSet.Status.UpdatedReplicas, statefulSet.Status.CurrentRevision = 3, "2"
+		}
+		if err := c.put(statefulSet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	issue(start, "")
+	oldCA := currentCA()
+	ca, err := innodbcluster.ParseCertificate(oldCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificate is renewed by the same CA shortly before the CA is due
+	due := ca.NotAfter.Add(-ins.Spec.TLS.Duration.Duration)
+	secret := issue(due.Add(-24*time.Hour), "")
+	if !signedBy(secret, oldCA) || !bytes.Equal(secret.Data[innodbcluster.CACertKey], oldCA) {
+		t.Fatal("certificate is not renewed by the current CA")
+	}
+	rollOut(secret, true)
+	leaf := secret.Data[corev1.TLSCertKey]
+
+	// phase 1: the new CA is trusted along with the previous one, the certificate is kept
+	now := due.Add(24 * time.Hour)
+	secret = issue(now, databasev1.CARotationTrusting)
+	newCA := currentCA()
+	if bytes.Equal(newCA, oldCA) {
+		t.Fatal("CA is not renewed")
+	}
+	if !bytes.Equal(secret.Data[corev1.TLSCertKey], leaf) {
+		t.Error("certificate is reissued before the members trust the new CA")
+	}
+	bundle := secret.Data[innodbcluster.CACertKey]
+	if !bytes.Contains(bundle, newCA) || !bytes.Contains(bundle, oldCA) {
+		t.Error("ca.crt does not trust both CAs")
+	}
+
+	// the certificate is kept while the members restart
+	rollOut(secret, false)
+	secret = issue(now.Add(time.Hour), databasev1.CARotationTrusting)
+	if !bytes.Equal(secret.Data[corev1.TLSCertKey], leaf) {
+		t.Error("certificate is reissued while the members restart")
+	}
+
+	// phase 2: every member trusts the new CA, the certificate is issued by it
+	rollOut(secret, true)
+	secret = issue(now.Add(2*time.Hour), "")
+	if !signedBy(secret, newCA) {
+		t.Error("certificate is not issued by the new CA")
+	}
+	bundle = secret.Data[innodbcluster.CACertKey]
+	if !bytes.Contains(bundle, newCA) || !bytes.Contains(bundle, oldCA) {
+		t.Error("ca.crt does not trust the previous CA while the members restart")
+	}
+
+	// the rotation is done
+	writes := c.writes
+	if secret = issue(now.Add(3*time.Hour), ""); !signedBy(secret, newCA) || c.writes != writes {
+		t.Error("certificate is changed after the rotation")
+	}
+}
+
+func TestIssueCertificateExpiredCA(t *testing.T) {
+	ctx := context.Background()
+	c := newMemoryClient(t)
+	ins := tlsMysql()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, _, err := issueCertificate(ctx, c, ins, start); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing can verify the expired certificate anymore, there is nothing to roll out first
+	secret, rotation, err := issueCertificate(ctx, c, ins, start.Add(11*365*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotation != "" {
+		t.Errorf("rotation = %q, want none", rotation)
+	}
+	caSecret, err := tlsSecret(ctx, c, ins, innodbcluster.CASecretName(ins))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret.Data[innodbcluster.CACertKey], caSecret.Data[corev1.TLSCertKey]) {
+		t.Error("ca.crt trusts the expired CA")
+	}
+}
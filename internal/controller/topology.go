@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+// ApplyTopologyMode switches the group to spec.mysql.topologyMode when it runs in the other
+// mode. It returns why the switch is blocked, empty if it is not.
+func (r *MysqlReconciler) ApplyTopologyMode(ctx context.Context, ins *databasev1.Mysql, members []*innodbcluster.MemberInfo) (string, error) {
+	statefulSet, err := installedStatefulSet(ctx, r.Client, ins)
+	if err != nil || statefulSet == nil {
+		return "", err
+	}
+	passwd, err := RootPassword(ctx, r.Client, ins)
+	if err != nil {
+		return "", err
+	}
+
+	via, singlePrimary := -1, false
+	for i := 0; i < int(ins.Spec.Replica) && via < 0; i++ {
+		if info := memberInfo(members, i); info.State == databasev1.MemberStateOnline && info.Role == databasev1.MemberRolePrimary {
+			via, singlePrimary = i, info.SinglePrimary
+		}
+	}
+	multiPrimary := ins.Spec.Mysql.TopologyMode == databasev1.TopologyMultiPrimary
+	if via < 0 || singlePrimary != multiPrimary {
+		return "", nil
+	}
+
+	if multiPrimary {
+		keys, err := innodbcluster.CascadingForeignKeys(ctx, ins, innodbcluster.MemberHost(ins, via), passwd)
+		if err != nil {
+			return "", fmt.Errorf("failed to check foreign keys: %w", err)
+		}
+		if len(keys) > 0 {
+			blocked := fmt.Sprintf("foreign keys with cascading actions are not supported in multi-primary mode: [%s]", strings.Join(keys, ","))
+			r.Recorder.Event(ins, corev1.EventTypeWarning, databasev1.ConditionTopology, blocked)
+			return blocked, nil
+		}
+	}
+	if err := innodbcluster.SetTopologyMode(ctx, ins, passwd, via); err != nil {
+		r.Recorder.Event(ins, corev1.EventTypeWarning, databasev1.ConditionTopology, err.Error())
+		return "", err
+	}
+	r.Recorder.Event(ins, corev1.EventTypeNormal, databasev1.ConditionTopology,
+		fmt.Sprintf("switched to %s mode", ins.Spec.Mysql.TopologyMode))
+	return "", nil
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+// CurrentMysqlConfig returns the data of the mysql configmap, nil if it does not exist yet.
+func CurrentMysqlConfig(ctx context.Context, c client.Client, ins *databasev1.Mysql) (map[string]string, error) {
+	cm := &corev1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName{Name: innodbcluster.MysqlConfigName(ins), Namespace: ins.Namespace}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get configmap %s: %w", innodbcluster.MysqlConfigName(ins), err)
+	}
+	return cm.Data, nil
+}
+
+// ApplyVariables sets the dynamic variables changed from the old to the current config on
+// every member with SET PERSIST. Static variables are in effect once the statefulset rolled
+// out. Variables that could not be set on every member stay pending and are retried.
+func ApplyVariables(ctx context.Context, c client.Client, ins *databasev1.Mysql, old map[string]string) ([]databasev1.VariableStatus, error) {
+	variables := append([]databasev1.VariableStatus(nil), ins.Status.Variables...)
+	if old == nil {
+		return variables, nil
+	}
+
+	template, err := MysqlConfigTemplate(ctx, c, ins)
+	if err != nil {
+		return variables, err
+	}
+	changes := innodbcluster.DiffMysqlConfig(old, innodbcluster.MysqlConfigData(ins, template))
+
+	// retry the variables of previous reconciles
+	changed := map[string]bool{}
+	for _, change := range changes {
+		changed[change.Name] = true
+	}
+	for _, v := range variables {
+		if v.State == databasev1.VariablePending && !changed[v.Name] {
+			changes = append(changes, innodbcluster.VariableChange{Name: v.Name, Value: v.Value, Removed: v.Removed, Dynamic: true})
+		}
+	}
+
+	statefulSet := &appsv1.StatefulSet{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(ins), statefulSet); err != nil && !apierrors.IsNotFound(err) {
+		return variables, fmt.Errorf("failed to get StatefulSet %s: %w", ins.Name, err)
+	}
+	rolledOut := statefulSet.Status.ObservedGeneration >= statefulSet.Generation &&
+		statefulSet.Status.UpdatedReplicas == statefulSet.Status.Replicas &&
+		statefulSet.Status.CurrentRevision == statefulSet.Status.UpdateRevision
+
+	var passwd string
+	for _, change := range changes {
+		state := databasev1.VariableRestartRequired
+		if change.Dynamic {
+			if passwd == "" {
+				if passwd, err = RootPassword(ctx, c, ins); err != nil {
+					return variables, err
+				}
+			}
+			state = databasev1.VariableApplied
+			for i := 0; i < int(ins.Spec.Replica); i++ {
+				if err := innodbcluster.SetPersistVariable(ctx, ins, innodbcluster.MemberHost(ins, i), passwd, change); err != nil {
+					log.Log.Info("set variable failed", "clustername", ins.Name, "variable", change.Name, "error", err.Error())
+					state = databasev1.VariablePending
+				}
+			}
+		}
+		log.Log.Info("mysql variable changed", "clustername", ins.Name, "variable", change.Name, "value", change.Value, "state", state)
+		variables = setVariable(variables, databasev1.VariableStatus{Name: change.Name, Value: change.Value, Removed: change.Removed, State: state})
+	}
+
+	for i := range variables {
+		if variables[i].State == databasev1.VariableRestartRequired && !changed[variables[i].Name] && rolledOut {
+			variables[i].State = databasev1.VariableApplied
+		}
+	}
+	return variables, nil
+}
+
+func setVariable(variables []databasev1.VariableStatus, variable databasev1.VariableStatus) []databasev1.VariableStatus {
+	for i := range variables {
+		if variables[i].Name == variable.Name {
+			variables[i] = variable
+			return variables
+		}
+	}
+	return append(variables, variable)
+}
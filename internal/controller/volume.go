@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	databasev1 "axe/api/v1"
+	innodbcluster "axe/cluster/innodbcluster"
+)
+
+// ApplyHostPathVolumes creates the host path volume of every member that has none yet.
+// A new volume is placed on a ready node that holds no other member of the cluster if
+// possible, and the member is pinned to that node from then on.
+func ApplyHostPathVolumes(ctx context.Context, c client.Client, ins *databasev1.Mysql) error {
+	if innodbcluster.PersistenceMode(ins) != databasev1.PersistenceModeHostPath {
+		return nil
+	}
+
+	pvs, err := hostPathVolumes(ctx, c, ins)
+	if err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for _, pv := range pvs {
+		for _, node := range pvNodes(&pv) {
+			used[node] = true
+		}
+	}
+
+	for i := 0; i < int(ins.Spec.Replica); i++ {
+		pv := &corev1.PersistentVolume{}
+		err := c.Get(ctx, types.NamespacedName{Name: innodbcluster.HostPathPVName(ins, i)}, pv)
+		if err == nil {
+			continue
+		} else if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get persistent volume %s: %w", innodbcluster.HostPathPVName(ins, i), err)
+		}
+
+		node, err := pickNode(ctx, c, used)
+		if err != nil {
+			return err
+		}
+		used[node] = true
+
+		pv = innodbcluster.HostPathPV(ins, i, node)
+		log.Log.Info("create host path volume", "objname", pv.Name, "node", node)
+		if err := c.Create(ctx, pv); err != nil {
+			return fmt.Errorf("failed to create persistent volume %s: %w", pv.Name, err)
+		}
+	}
+	return nil
+}
+
+// DeleteHostPathVolumes deletes the host path volumes of the cluster. The data is left on
+// the nodes.
+func DeleteHostPathVolumes(ctx context.Context, c client.Client, ins *databasev1.Mysql) error {
+	pvs, err := hostPathVolumes(ctx, c, ins)
+	if err != nil {
+		return err
+	}
+	for i := range pvs {
+		log.Log.Info("delete host path volume", "objname", pvs[i].Name)
+		if err := c.Delete(ctx, &pvs[i]); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete persistent volume %s: %w", pvs[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// hostPathVolumes lists the host path volumes created for the cluster.
+func hostPathVolumes(ctx context.Context, c client.Client, ins *databasev1.Mysql) ([]corev1.PersistentVolume, error) {
+	pvs := &corev1.PersistentVolumeList{}
+	if err := c.List(ctx, pvs, client.MatchingLabels{
+		"clustername":      ins.Name,
+		"clusternamespace": ins.Namespace,
+		"app":              databasev1.MYSQLAPP,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %w", err)
+	}
+	return pvs.Items, nil
+}
+
+// pickNode returns the hostname of a ready and schedulable node, preferring nodes not in used.
+func pickNode(ctx context.Context, c client.Client, used map[string]bool) (string, error) {
+	nodes := &corev1.NodeList{}
+	if err := c.List(ctx, nodes); err != nil {
+		return "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	fallback := ""
+	for _, node := range nodes.Items {
+		hostname := node.Labels[corev1.LabelHostname]
+		if hostname == "" || node.Spec.Unschedulable || !nodeReady(&node) {
+			continue
+		}
+		if !used[hostname] {
+			return hostname, nil
+		}
+		if fallback == "" {
+			fallback = hostname
+		}
+	}
+	if fallback == "" {
+		return "", fmt.Errorf("no ready node for host path volume")
+	}
+	return fallback, nil
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// pvNodes returns the hostnames a persistent volume is pinned to.
+func pvNodes(pv *corev1.PersistentVolume) []string {
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return nil
+	}
+	var nodes []string
+	for _, term := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms {
+		for _, expr := range term.MatchExpressions {
+			if expr.Key == corev1.LabelHostname {
+				nodes = append(nodes, expr.Values...)
+			}
+		}
+	}
+	return nodes
+}